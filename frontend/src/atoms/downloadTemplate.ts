@@ -6,10 +6,8 @@ import { serverSideCookiesState, serverURL } from './settings'
 import { atom } from 'jotai'
 import { atomWithStorage } from 'jotai/utils'
 
-export const cookiesTemplateState = atom<Promise<string>>(async (get) =>
-  await get(serverSideCookiesState)
-    ? '--cookies=cookies.txt'
-    : ''
+export const serverCookiesState = atom<Promise<boolean>>(async (get) =>
+  !!await get(serverSideCookiesState)
 )
 
 export const customArgsState = atomWithStorage(
@@ -22,8 +20,8 @@ export const filenameTemplateState = atomWithStorage(
   localStorage.getItem('lastFilenameTemplate') ?? ''
 )
 
-export const downloadTemplateState = atom<Promise<string>>(async (get) =>
-  `${get(customArgsState)} ${await get(cookiesTemplateState)}`
+export const downloadTemplateState = atom<string>((get) =>
+  get(customArgsState)
     .replace(/  +/g, ' ')
     .trim()
 )
@@ -33,6 +33,7 @@ import {
 import {
   customArgsState,
   downloadTemplateState,
+  serverCookiesState,
   filenameTemplateState,
   savedTemplatesState
 } from '../atoms/downloadTemplate'
@@ -67,6 +68,7 @@ const DownloadDialog: FC<Props> = ({ open, onClose, onDownloadStart }) => {
   const isConnected = useAtomValue(connectedState)
   const availableDownloadPaths = useAtomValue(availableDownloadPathsState)
   const downloadTemplate = useAtomValue(downloadTemplateState)
+  const serverCookies = useAtomValue(serverCookiesState)
   const savedTemplates = useAtomValue(savedTemplatesState)
 
   const [downloadFormats, setDownloadFormats] = useState<DLMetadata>()
@@ -117,6 +119,7 @@ const DownloadDialog: FC<Props> = ({ open, onClose, onDownloadStart }) => {
         pathOverride: downloadPath ?? '',
         renameTo: settings.fileRenaming ? filenameTemplate : '',
         playlist: isPlaylist,
+        cookies: serverCookies,
       })
 
       setTimeout(() => {
@@ -133,7 +133,8 @@ const DownloadsTableView: React.FC = () => {
     window.open(`${serverAddr}/filebrowser/d/${encoded}?token=${localStorage.getItem('token')}`)
   }
 
-  const stop = (r: RPCResult) => r.progress.process_status === ProcessStatus.COMPLETED
+  const stop = (r: RPCResult) => (r.progress.process_status === ProcessStatus.COMPLETED ||
+    r.progress.process_status === ProcessStatus.ERRORED)
     ? client.clear(r.id)
     : client.kill(r.id)
 
@@ -8,7 +8,8 @@ type DownloadRequestArgs = {
   args: string,
   pathOverride?: string,
   renameTo?: string,
-  playlist?: boolean
+  playlist?: boolean,
+  cookies?: boolean
 }
 
 export class RPCClient {
@@ -95,6 +96,7 @@ export class RPCClient {
           Params: sanitizedArgs,
           Path: req.pathOverride,
           Rename: req.renameTo || rename,
+          Cookies: req.cookies,
         }]
       })
     }
@@ -105,6 +107,7 @@ export class RPCClient {
         Params: sanitizedArgs,
         Path: req.pathOverride,
         Rename: req.renameTo || rename,
+        Cookies: req.cookies,
       }]
     })
   }
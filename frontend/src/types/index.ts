@@ -13,6 +13,10 @@ export type RPCMethods =
   | "Service.ProgressLivestream"
   | "Service.KillLivestream"
   | "Service.KillAllLivestream"
+  | "Service.Pause"
+  | "Service.Resume"
+  | "Service.Schedule"
+  | "Service.StartNow"
 
 export type RPCRequest = {
   method: RPCMethods
@@ -44,6 +48,9 @@ export enum ProcessStatus {
   COMPLETED,
   ERRORED,
   LIVESTREAM,
+  PAUSED,
+  SCHEDULED,
+  HELD,
 }
 
 type DownloadProgress = {
@@ -60,6 +67,10 @@ export type RPCResult = Readonly<{
   output: {
     savedFilePath: string
   }
+  error?: {
+    exit_code: number
+    stderr: string[]
+  }
 }>
 
 export type RPCParams = {
@@ -68,6 +68,12 @@ export function mapProcessStatus(status: ProcessStatus) {
       return 'Error'
     case ProcessStatus.LIVESTREAM:
       return 'Livestream'
+    case ProcessStatus.PAUSED:
+      return 'Paused'
+    case ProcessStatus.SCHEDULED:
+      return 'Scheduled'
+    case ProcessStatus.HELD:
+      return 'Held'
     default:
       return 'Pending'
   }
@@ -17,6 +17,7 @@ import (
 var (
 	host              string
 	port              int
+	grpcPort          int
 	queueSize         int
 	configFile        string
 	downloadPath      string
@@ -46,6 +47,7 @@ var (
 func init() {
 	flag.StringVar(&host, "host", "0.0.0.0", "Host where server will listen at")
 	flag.IntVar(&port, "port", 3033, "Port where server will listen at")
+	flag.IntVar(&grpcPort, "grpc-port", 0, "Port where the gRPC server will listen at (default: same as the web server)")
 	flag.IntVar(&queueSize, "qs", 2, "Queue size (concurrent downloads)")
 
 	flag.StringVar(&configFile, "conf", "./config.yml", "Config file path")
@@ -59,8 +61,8 @@ func init() {
 	flag.StringVar(&logFile, "lf", "yt-dlp-webui.log", "set log file location")
 
 	flag.BoolVar(&requireAuth, "auth", false, "Enable RPC authentication")
-	flag.StringVar(&username, "user", userFromEnv, "Username required for auth")
-	flag.StringVar(&password, "pass", passFromEnv, "Password required for auth")
+	flag.StringVar(&username, "user", userFromEnv, "Username of the first admin, created if there are no users yet")
+	flag.StringVar(&password, "pass", passFromEnv, "Password of the first admin")
 
 	flag.Parse()
 }
@@ -82,6 +84,7 @@ func main() {
 		// TODO: find an alternative way to populate the config struct from flags or config file
 		c.Host = host
 		c.Port = port
+		c.GRPCPort = grpcPort
 
 		c.QueueSize = queueSize
 
@@ -108,6 +111,14 @@ func main() {
 		log.Println(cli.BgRed, "config", cli.Reset, err)
 	}
 
+	// maintenance commands, e.g. archive export and import
+	if flag.NArg() > 0 {
+		if err := server.RunCommand(flag.Args()); err != nil {
+			log.Fatalln(cli.BgRed, flag.Arg(0), cli.Reset, err)
+		}
+		return
+	}
+
 	openid.Configure()
 
 	server.RunBlocking(&server.RunConfig{
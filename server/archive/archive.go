@@ -1,10 +1,16 @@
 package archive
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"net/url"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/rest"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 )
 
 // alias type
@@ -12,6 +18,47 @@ import (
 type Service = domain.Service
 type Entity = domain.ArchiveEntry
 
+// The filters of a listing from a query string, as taken by the routes
+func ParseFilter(query string) (domain.ListFilter, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return domain.ListFilter{}, err
+	}
+	return rest.ParseFilter(values)
+}
+
+// Reconcile the archive with the download directory at the configured
+// interval, until ctx is done
+func Schedule(ctx context.Context, db *sql.DB) {
+	every := config.Instance().Reconcile.Interval
+	if every == "" {
+		return
+	}
+
+	interval, err := time.ParseDuration(every)
+	if err != nil || interval <= 0 {
+		slog.Error("invalid reconcile interval", slog.String("interval", every))
+		return
+	}
+
+	_, s := Container(db)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.Reconcile(ctx, false); err != nil {
+			slog.Error("failed to reconcile the archive", slog.String("err", err.Error()))
+		}
+	}
+}
+
 func ApplyRouter(db *sql.DB) func(chi.Router) {
 	handler, _ := Container(db)
 	return handler.ApplyRouter()
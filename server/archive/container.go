@@ -4,13 +4,15 @@ import (
 	"database/sql"
 
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash"
 )
 
 func Container(db *sql.DB) (domain.RestHandler, domain.Service) {
 	var (
-		r = provideRepository(db)
-		s = provideService(r)
-		h = provideHandler(s)
+		r    = provideRepository(db)
+		_, t = trash.Container(db)
+		s    = provideService(r, t)
+		h    = provideHandler(s)
 	)
 	return h, s
 }
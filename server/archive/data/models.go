@@ -1,6 +1,9 @@
 package data
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
 type ArchiveEntry struct {
 	Id        string
@@ -10,4 +13,53 @@ type ArchiveEntry struct {
 	Source    string
 	Metadata  string
 	CreatedAt time.Time
+	Owner     string
+	Extractor string
+	Ext       string
+	Duration  float64
+	Size      int64
+	Tags      []string
+	Missing   bool
+
+	LastWatchedAt sql.NullTime
+	EvictedAt     sql.NullTime
+	EvictedBy     string
+
+	// position in the archive, only set by List
+	RowId int64
+}
+
+// An entry a cleanup policy can evict
+type Candidate struct {
+	Id            string
+	Title         string
+	Path          string
+	Size          int64
+	CreatedAt     time.Time
+	LastWatchedAt sql.NullTime
+	Uploader      string
+	// the id of the subscription it was downloaded by, if any
+	Subscription string
+}
+
+type Tag struct {
+	Name    string
+	Entries int
+}
+
+type Collection struct {
+	Id        string
+	Name      string
+	Owner     string
+	Entries   int
+	CreatedAt time.Time
+}
+
+type Note struct {
+	Id        string
+	EntryId   string
+	Author    string
+	Content   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
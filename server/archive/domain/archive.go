@@ -2,13 +2,36 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
 )
 
+var (
+	ErrInvalidFilter      = errors.New("invalid archive filter")
+	ErrNotFound           = errors.New("archive entry not found")
+	ErrInvalidTag         = errors.New("invalid tag")
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("a collection with this name already exists")
+	ErrNoteNotFound       = errors.New("note not found")
+	ErrInvalidCollection  = errors.New("invalid collection")
+	ErrInvalidNote        = errors.New("invalid note")
+	ErrInvalidBundle      = errors.New("invalid archive bundle")
+	ErrReconcileRunning   = errors.New("a reconciliation is already running")
+)
+
 type ArchiveEntry struct {
 	Id        string    `json:"id"`
 	Title     string    `json:"title"`
@@ -17,28 +40,245 @@ type ArchiveEntry struct {
 	Source    string    `json:"source"`
 	Metadata  string    `json:"metadata"`
 	CreatedAt time.Time `json:"created_at"`
+	Owner     string    `json:"owner,omitempty"`
+	Extractor string    `json:"extractor"`
+	Ext       string    `json:"ext"`
+	Duration  float64   `json:"duration"`
+	Size      int64     `json:"size"`
+	Tags      []string  `json:"tags"`
+	// the file is gone, found by a reconciliation
+	Missing bool `json:"missing"`
+	// when the file was last streamed or downloaded
+	LastWatchedAt *time.Time `json:"last_watched_at,omitempty"`
+	// when, and by which policy, the file was removed by a cleanup
+	EvictedAt *time.Time `json:"evicted_at,omitempty"`
+	EvictedBy string     `json:"evicted_by,omitempty"`
+}
+
+// An entry whose file a cleanup policy can remove
+type Candidate struct {
+	Id            string     `json:"id"`
+	Title         string     `json:"title"`
+	Path          string     `json:"path"`
+	Size          int64      `json:"size"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastWatchedAt *time.Time `json:"last_watched_at,omitempty"`
+	Uploader      string     `json:"uploader,omitempty"`
+	// the id of the subscription it was downloaded by, if any
+	Subscription string `json:"subscription,omitempty"`
+}
+
+type Tag struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+}
+
+// A named group of archive entries, owned by the user who created it
+type Collection struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	Entries   int       `json:"entries"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Note struct {
+	Id        string    `json:"id"`
+	EntryId   string    `json:"entry_id"`
+	Author    string    `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type PaginatedResponse[T any] struct {
 	First int64 `json:"first"`
 	Next  int64 `json:"next"`
 	Data  T     `json:"data"`
+	// cursor of the following page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// What an archive listing is filtered and sorted by, zero values match
+// every entry
+type ListFilter struct {
+	// full text search on title, source, uploader and description
+	Query       string
+	From        time.Time
+	To          time.Time // exclusive
+	Extractor   string
+	Exts        []string
+	MinDuration float64
+	MaxDuration float64
+	Owner       string
+	// entries whose file is gone, or still there, if set
+	Missing *bool
+	// entries removed by a cleanup policy, or not, if set
+	Evicted *bool
+	// only these entries, if any
+	Ids []string
+	// entries with all of them
+	Tags       []string
+	Collection string
+	// created_at, title or size, the archive order if empty
+	SortBy string
+	Desc   bool
+}
+
+// What an export bundle carries besides the archive entries
+type ExportOptions struct {
+	// tar or zip
+	Format     string
+	Media      bool
+	Thumbnails bool
+	// the .info.json files written by yt-dlp
+	Info bool
+}
+
+type ImportReport struct {
+	Imported int `json:"imported"`
+	// already in the archive
+	Skipped int      `json:"skipped"`
+	Files   int      `json:"files"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// What a reconciliation of the archive with the download directory found,
+// and changed unless it's a dry run
+type ReconcileReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	// entries whose file is gone
+	Missing []ReconciledFile `json:"missing"`
+	// entries marked as missing whose file is back
+	Restored []ReconciledFile `json:"restored"`
+	// entries created for the media files the archive didn't have
+	Imported []ReconciledFile `json:"imported"`
+	Errors   []string         `json:"errors,omitempty"`
+}
+
+// A media file of the download directory without an archive entry
+type OrphanFile struct {
+	Path string
+	Info fs.FileInfo
+}
+
+// The orphan files found walking the download directory
+type OrphanScan struct {
+	Files []OrphanFile
+	// the files and directories that couldn't be read
+	Errors []string
+}
+
+type ReconciledFile struct {
+	Id    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+	Path  string `json:"path"`
+}
+
+// Position in a listing: the sort key and the rowid of the last entry of
+// the previous page, ties are broken by the rowid.
+type Cursor struct {
+	RowId int64
+	Value any
 }
 
 type Repository interface {
 	Archive(ctx context.Context, model *data.ArchiveEntry) error
-	SoftDelete(ctx context.Context, id string) (*data.ArchiveEntry, error)
-	HardDelete(ctx context.Context, id string) (*data.ArchiveEntry, error)
-	List(ctx context.Context, startRowId int, limit int) (*[]data.ArchiveEntry, error)
+	// an empty owner matches every entry
+	Get(ctx context.Context, id string, owner string) (*data.ArchiveEntry, error)
+	SoftDelete(ctx context.Context, id string, owner string) (*data.ArchiveEntry, error)
+	// entries after the cursor, from the first one if nil
+	List(ctx context.Context, filter ListFilter, after *Cursor, limit int) (*[]data.ArchiveEntry, error)
 	GetCursor(ctx context.Context, id string) (int64, error)
+
+	// tags of the entries, by entry id
+	Tags(ctx context.Context, ids []string) (map[string][]string, error)
+	ListTags(ctx context.Context, owner string) (*[]data.Tag, error)
+	AddTags(ctx context.Context, id string, owner string, tags []string) error
+	RemoveTag(ctx context.Context, id string, owner string, tag string) error
+
+	CreateCollection(ctx context.Context, model *data.Collection) error
+	ListCollections(ctx context.Context, owner string) (*[]data.Collection, error)
+	DeleteCollection(ctx context.Context, id string, owner string) error
+	AddToCollection(ctx context.Context, collectionId string, id string, owner string) error
+	RemoveFromCollection(ctx context.Context, collectionId string, id string, owner string) error
+
+	// the notes of the entries the owner can see
+	ListNotes(ctx context.Context, id string, owner string) (*[]data.Note, error)
+	AddNote(ctx context.Context, model *data.Note, owner string) error
+	// only their author, or an admin, can change the notes
+	UpdateNote(ctx context.Context, model *data.Note, owner string) error
+	DeleteNote(ctx context.Context, id string, noteId string, owner string) error
+
+	// Reports whether an entry with the id, or downloaded from the source,
+	// is already archived
+	Exists(ctx context.Context, id string, source string) (bool, error)
+	// names of the collections of the entries, by entry id
+	EntryCollections(ctx context.Context, ids []string) (map[string][]string, error)
+
+	// id, path and missing flag of every entry
+	Files(ctx context.Context) (*[]data.ArchiveEntry, error)
+	SetMissing(ctx context.Context, ids []string, missing bool) error
+
+	// the entry of a file, whoever owns it
+	GetByPath(ctx context.Context, path string) (*data.ArchiveEntry, error)
+	Watched(ctx context.Context, path string, at time.Time) error
+	// the entries whose file is still there and wasn't evicted
+	Candidates(ctx context.Context) (*[]data.Candidate, error)
+	// flags the entry as evicted by the policy and its file as missing, a
+	// nil time clears the flags
+	SetEvicted(ctx context.Context, id string, policy string, at *time.Time) error
 }
 
 type Service interface {
 	Archive(ctx context.Context, entity *ArchiveEntry) error
 	SoftDelete(ctx context.Context, id string) (*ArchiveEntry, error)
+	// the file is moved to the trash, restoring it archives the entry again
 	HardDelete(ctx context.Context, id string) (*ArchiveEntry, error)
-	List(ctx context.Context, startRowId int, limit int) (*PaginatedResponse[[]ArchiveEntry], error)
+	// the cursor is the next_cursor of the previous page, or the rowid of
+	// its last entry for the archive order
+	List(ctx context.Context, filter ListFilter, cursor string, limit int) (*PaginatedResponse[[]ArchiveEntry], error)
 	GetCursor(ctx context.Context, id string) (int64, error)
+
+	Tags(ctx context.Context, id string) ([]string, error)
+	ListTags(ctx context.Context) (*[]Tag, error)
+	AddTags(ctx context.Context, id string, tags []string) ([]string, error)
+	RemoveTag(ctx context.Context, id string, tag string) error
+
+	CreateCollection(ctx context.Context, name string) (*Collection, error)
+	ListCollections(ctx context.Context) (*[]Collection, error)
+	DeleteCollection(ctx context.Context, id string) error
+	AddToCollection(ctx context.Context, collectionId string, id string) error
+	RemoveFromCollection(ctx context.Context, collectionId string, id string) error
+
+	ListNotes(ctx context.Context, id string) (*[]Note, error)
+	AddNote(ctx context.Context, id string, content string) (*Note, error)
+	UpdateNote(ctx context.Context, id string, noteId string, content string) (*Note, error)
+	DeleteNote(ctx context.Context, id string, noteId string) error
+
+	// Write the entries matching the filter as a bundle
+	Export(ctx context.Context, w io.Writer, filter ListFilter, opts ExportOptions) error
+	// Add the entries of a bundle, and their files, to the archive
+	Import(ctx context.Context, r io.ReaderAt, size int64) (*ImportReport, error)
+
+	// Mark the entries whose file is gone and archive the media files of the
+	// download directory without an entry. One runs at a time.
+	Reconcile(ctx context.Context, dryRun bool) (*ReconcileReport, error)
+	// the report of the last reconciliation, nil if none ran yet
+	LastReconcile() *ReconcileReport
+	// The settled media files of the download directory, outside of the
+	// hidden directories, whose absolute path isn't known
+	Orphans(ctx context.Context, known map[string]bool) (*OrphanScan, error)
+
+	// Record that the file of an entry was streamed or downloaded
+	Watched(ctx context.Context, path string) error
+	Candidates(ctx context.Context) (*[]Candidate, error)
+	// Remove the file of the entry for a cleanup policy, the entry is kept
+	// and flagged as evicted. Without an id the file at path is archived
+	// first.
+	Evict(ctx context.Context, id string, path string, policy string) (*ArchiveEntry, error)
 }
 
 type RestHandler interface {
@@ -47,5 +287,85 @@ type RestHandler interface {
 	SoftDelete() http.HandlerFunc
 	HardDelete() http.HandlerFunc
 	GetCursor() http.HandlerFunc
+
+	Tags() http.HandlerFunc
+	ListTags() http.HandlerFunc
+	AddTags() http.HandlerFunc
+	RemoveTag() http.HandlerFunc
+
+	CreateCollection() http.HandlerFunc
+	ListCollections() http.HandlerFunc
+	DeleteCollection() http.HandlerFunc
+	AddToCollection() http.HandlerFunc
+	RemoveFromCollection() http.HandlerFunc
+
+	ListNotes() http.HandlerFunc
+	AddNote() http.HandlerFunc
+	UpdateNote() http.HandlerFunc
+	DeleteNote() http.HandlerFunc
+
+	Export() http.HandlerFunc
+	Import() http.HandlerFunc
+
+	Reconcile() http.HandlerFunc
+	LastReconcile() http.HandlerFunc
+
 	ApplyRouter() func(chi.Router)
 }
+
+// Media files yt-dlp wrote, the other ones like thumbnails, metadata or
+// partial downloads aren't
+var mediaExts = []string{
+	".mp4", ".webm", ".mkv", ".mov", ".avi", ".flv",
+	".m4a", ".mp3", ".opus", ".ogg", ".flac", ".wav", ".aac",
+}
+
+// the formats downloaded apart, before yt-dlp merges them
+var formatFileRe = regexp.MustCompile(`\.f\d+(-\d+)?\.\w+$`)
+
+// Reports whether the file is a finished download, from its name
+func IsMediaFile(name string) bool {
+	return !strings.HasPrefix(name, ".") &&
+		!strings.Contains(name, ".temp.") &&
+		!formatFileRe.MatchString(name) &&
+		slices.Contains(mediaExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// How many tags an entry or a download request can carry
+const MaxTags = 32
+
+// Tags are trimmed and lower cased, duplicates are dropped
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("%w: at most %d tags", ErrInvalidTag, MaxTags)
+	}
+
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	switch {
+	case tag == "":
+		return "", fmt.Errorf("%w: empty tag", ErrInvalidTag)
+	case utf8.RuneCountInString(tag) > 64:
+		return "", fmt.Errorf("%w: %q is longer than 64 characters", ErrInvalidTag, tag)
+	case strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || unicode.IsControl(r) }):
+		return "", fmt.Errorf("%w: %q can't contain commas or control characters", ErrInvalidTag, tag)
+	}
+
+	return tag, nil
+}
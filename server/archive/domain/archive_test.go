@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" Research ", "project-x", "research"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(tags, []string{"research", "project-x"}) {
+		t.Errorf("NormalizeTags() = %q", tags)
+	}
+
+	for _, invalid := range [][]string{{""}, {"a,b"}, {"tab\there"}, {strings.Repeat("x", 65)}} {
+		if _, err := NormalizeTags(invalid); err == nil {
+			t.Errorf("NormalizeTags(%q) should fail", invalid)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/repository"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/rest"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/service"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash"
 )
 
 var (
@@ -27,9 +28,9 @@ func provideRepository(db *sql.DB) domain.Repository {
 	return repo
 }
 
-func provideService(r domain.Repository) domain.Service {
+func provideService(r domain.Repository, t trash.Service) domain.Service {
 	svcOnce.Do(func() {
-		svc = service.New(r)
+		svc = service.New(r, t)
 	})
 	return svc
 }
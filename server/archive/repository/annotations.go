@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+// Tags, collections and notes of the archive entries. An empty owner, an
+// admin, can see and change every one of them.
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Reports whether the entry exists and the owner can see it
+func visible(ctx context.Context, q querier, id string, owner string) error {
+	var count int
+
+	err := q.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM archive WHERE id = ? AND (? = '' OR owner = ?)",
+		id,
+		owner,
+		owner,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func collectionVisible(ctx context.Context, q querier, id string, owner string) error {
+	var count int
+
+	err := q.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM collections WHERE id = ? AND (? = '' OR owner = ?)",
+		id,
+		owner,
+		owner,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return domain.ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) Tags(ctx context.Context, ids []string) (map[string][]string, error) {
+	tags := make(map[string][]string, len(ids))
+
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT entry_id, tag FROM archive_tags WHERE entry_id IN (?"+strings.Repeat(", ?", len(ids)-1)+") ORDER BY tag",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+
+		tags[id] = append(tags[id], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (r *Repository) ListTags(ctx context.Context, owner string) (*[]data.Tag, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		`SELECT t.tag, COUNT(*) FROM archive_tags t
+		JOIN archive a ON a.id = t.entry_id
+		WHERE ? = '' OR a.owner = ?
+		GROUP BY t.tag
+		ORDER BY t.tag`,
+		owner,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []data.Tag{}
+
+	for rows.Next() {
+		var tag data.Tag
+
+		if err := rows.Scan(&tag.Name, &tag.Entries); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return &tags, rows.Err()
+}
+
+func (r *Repository) AddTags(ctx context.Context, id string, owner string, tags []string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := visible(ctx, tx, id, owner); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO archive_tags (entry_id, tag) VALUES (?, ?)", id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) RemoveTag(ctx context.Context, id string, owner string, tag string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := visible(ctx, conn, id, owner); err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "DELETE FROM archive_tags WHERE entry_id = ? AND tag = ?", id, tag)
+	return err
+}
+
+func (r *Repository) CreateCollection(ctx context.Context, model *data.Collection) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	var count int
+
+	err = conn.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM collections WHERE owner = ? AND name = ? COLLATE NOCASE",
+		model.Owner,
+		model.Name,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return domain.ErrCollectionExists
+	}
+
+	model.Id = uuid.NewString()
+	model.CreatedAt = time.Now()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO collections (id, name, owner, created_at) VALUES (?, ?, ?, ?)",
+		model.Id,
+		model.Name,
+		model.Owner,
+		model.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *Repository) ListCollections(ctx context.Context, owner string) (*[]data.Collection, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		`SELECT c.id, c.name, c.owner, c.created_at, COUNT(e.entry_id) FROM collections c
+		LEFT JOIN collection_entries e ON e.collection_id = c.id
+		WHERE ? = '' OR c.owner = ?
+		GROUP BY c.id
+		ORDER BY c.name COLLATE NOCASE`,
+		owner,
+		owner,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collections := []data.Collection{}
+
+	for rows.Next() {
+		var c data.Collection
+
+		if err := rows.Scan(&c.Id, &c.Name, &c.Owner, &c.CreatedAt, &c.Entries); err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, c)
+	}
+
+	return &collections, rows.Err()
+}
+
+// The entries are kept, only the collection is deleted
+func (r *Repository) DeleteCollection(ctx context.Context, id string, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := collectionVisible(ctx, tx, id, owner); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM collection_entries WHERE collection_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM collections WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) AddToCollection(ctx context.Context, collectionId string, id string, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := collectionVisible(ctx, conn, collectionId, owner); err != nil {
+		return err
+	}
+
+	if err := visible(ctx, conn, id, owner); err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT OR IGNORE INTO collection_entries (collection_id, entry_id, added_at) VALUES (?, ?, ?)",
+		collectionId,
+		id,
+		time.Now(),
+	)
+
+	return err
+}
+
+func (r *Repository) RemoveFromCollection(ctx context.Context, collectionId string, id string, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := collectionVisible(ctx, conn, collectionId, owner); err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		"DELETE FROM collection_entries WHERE collection_id = ? AND entry_id = ?",
+		collectionId,
+		id,
+	)
+
+	return err
+}
+
+func (r *Repository) ListNotes(ctx context.Context, id string, owner string) (*[]data.Note, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := visible(ctx, conn, id, owner); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT id, entry_id, author, content, created_at, updated_at FROM archive_notes WHERE entry_id = ? ORDER BY rowid",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	notes := []data.Note{}
+
+	for rows.Next() {
+		var n data.Note
+
+		if err := rows.Scan(&n.Id, &n.EntryId, &n.Author, &n.Content, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, n)
+	}
+
+	return &notes, rows.Err()
+}
+
+func (r *Repository) AddNote(ctx context.Context, model *data.Note, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if err := visible(ctx, conn, model.EntryId, owner); err != nil {
+		return err
+	}
+
+	model.Id = uuid.NewString()
+	model.CreatedAt = time.Now()
+	model.UpdatedAt = model.CreatedAt
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO archive_notes (id, entry_id, author, content, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		model.Id,
+		model.EntryId,
+		model.Author,
+		model.Content,
+		model.CreatedAt,
+		model.UpdatedAt,
+	)
+
+	return err
+}
+
+func (r *Repository) UpdateNote(ctx context.Context, model *data.Note, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	model.UpdatedAt = time.Now()
+
+	err = conn.QueryRowContext(
+		ctx,
+		`UPDATE archive_notes SET content = ?, updated_at = ?
+		WHERE id = ? AND entry_id = ? AND (? = '' OR author = ?)
+		RETURNING author, created_at`,
+		model.Content,
+		model.UpdatedAt,
+		model.Id,
+		model.EntryId,
+		owner,
+		owner,
+	).Scan(&model.Author, &model.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrNoteNotFound
+	}
+
+	return err
+}
+
+func (r *Repository) DeleteNote(ctx context.Context, id string, noteId string, owner string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM archive_notes WHERE id = ? AND entry_id = ? AND (? = '' OR author = ?)",
+		noteId,
+		id,
+		owner,
+		owner,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return domain.ErrNoteNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) Exists(ctx context.Context, id string, source string) (bool, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer conn.Close()
+
+	var count int
+
+	err = conn.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM archive WHERE id = ? OR (? != '' AND source = ?)",
+		id,
+		source,
+		source,
+	).Scan(&count)
+
+	return count > 0, err
+}
+
+func (r *Repository) EntryCollections(ctx context.Context, ids []string) (map[string][]string, error) {
+	collections := make(map[string][]string, len(ids))
+
+	if len(ids) == 0 {
+		return collections, nil
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := conn.QueryContext(
+		ctx,
+		`SELECT e.entry_id, c.name FROM collection_entries e
+		JOIN collections c ON c.id = e.collection_id
+		WHERE e.entry_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY c.name COLLATE NOCASE`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, name string
+
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+
+		collections[id] = append(collections[id], name)
+	}
+
+	return collections, rows.Err()
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+func (r *Repository) GetByPath(ctx context.Context, path string) (*data.ArchiveEntry, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	var id string
+
+	// the same file may have been archived again, e.g. by a reconciliation
+	row := conn.QueryRowContext(
+		ctx,
+		"SELECT id FROM archive WHERE path = ? ORDER BY evicted_at IS NOT NULL, rowid DESC LIMIT 1",
+		path,
+	)
+
+	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return r.Get(ctx, id, "")
+}
+
+func (r *Repository) Watched(ctx context.Context, path string, at time.Time) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "UPDATE archive SET last_watched_at = ? WHERE path = ?", at, path)
+	return err
+}
+
+func (r *Repository) Candidates(ctx context.Context) (*[]data.Candidate, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	// the uploader is in the yt-dlp metadata, the subscription is the one
+	// which listed the source of the entry
+	rows, err := conn.QueryContext(ctx, `
+		SELECT
+			a.id,
+			a.title,
+			a.path,
+			a.size,
+			a.created_at,
+			a.last_watched_at,
+			CASE WHEN json_valid(a.metadata) THEN COALESCE(json_extract(a.metadata, '$.uploader'), '') ELSE '' END,
+			COALESCE((SELECT s.subscription_id FROM subscription_entries s WHERE s.url = a.source LIMIT 1), '')
+		FROM archive a
+		WHERE a.evicted_at IS NULL AND a.missing = 0`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var candidates []data.Candidate
+
+	for rows.Next() {
+		var c data.Candidate
+
+		if err := rows.Scan(
+			&c.Id,
+			&c.Title,
+			&c.Path,
+			&c.Size,
+			&c.CreatedAt,
+			&c.LastWatchedAt,
+			&c.Uploader,
+			&c.Subscription,
+		); err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return &candidates, rows.Err()
+}
+
+func (r *Repository) SetEvicted(ctx context.Context, id string, policy string, at *time.Time) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	evictedAt := sql.NullTime{}
+	if at != nil {
+		evictedAt = sql.NullTime{Time: *at, Valid: true}
+	}
+
+	_, err = conn.ExecContext(
+		ctx,
+		"UPDATE archive SET evicted_at = ?, evicted_by = ?, missing = ? WHERE id = ?",
+		evictedAt,
+		policy,
+		at != nil,
+		id,
+	)
+
+	return err
+}
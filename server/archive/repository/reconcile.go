@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+)
+
+func (r *Repository) Files(ctx context.Context) (*[]data.ArchiveEntry, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT id, path, missing FROM archive")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []data.ArchiveEntry
+
+	for rows.Next() {
+		var entry data.ArchiveEntry
+
+		if err := rows.Scan(&entry.Id, &entry.Path, &entry.Missing); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return &entries, rows.Err()
+}
+
+func (r *Repository) SetMissing(ctx context.Context, ids []string, missing bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, "UPDATE archive SET missing = ? WHERE id = ?", missing, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
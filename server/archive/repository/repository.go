@@ -3,13 +3,26 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"os"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
 )
 
+const columns = "id, title, path, thumbnail, source, metadata, created_at, owner, extractor, ext, duration, size, missing, last_watched_at, evicted_at, evicted_by"
+
+// what the listings can be sorted by, the archive order is the rowid
+var sortKeys = map[string]string{
+	"":           "rowid",
+	"created_at": "created_at",
+	"title":      "title COLLATE NOCASE",
+	"size":       "size",
+}
+
 type Repository struct {
 	db *sql.DB
 }
@@ -28,22 +41,105 @@ func (r *Repository) Archive(ctx context.Context, entry *data.ArchiveEntry) erro
 
 	defer conn.Close()
 
-	_, err = conn.ExecContext(
+	// entries archived by a download share its id
+	if entry.Id == "" {
+		entry.Id = uuid.NewString()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
 		ctx,
-		"INSERT INTO archive (id, title, path, thumbnail, source, metadata, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		uuid.NewString(),
+		"INSERT INTO archive ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.Id,
 		entry.Title,
 		entry.Path,
 		entry.Thumbnail,
 		entry.Source,
 		entry.Metadata,
 		entry.CreatedAt,
+		entry.Owner,
+		entry.Extractor,
+		entry.Ext,
+		entry.Duration,
+		entry.Size,
+		entry.Missing,
+		entry.LastWatchedAt,
+		entry.EvictedAt,
+		entry.EvictedBy,
 	)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range entry.Tags {
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO archive_tags (entry_id, tag) VALUES (?, ?)", entry.Id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) Get(ctx context.Context, id string, owner string) (*data.ArchiveEntry, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	var model data.ArchiveEntry
+
+	row := conn.QueryRowContext(
+		ctx,
+		"SELECT "+columns+" FROM archive WHERE id = ? AND (? = '' OR owner = ?)",
+		id,
+		owner,
+		owner,
+	)
+
+	err = row.Scan(
+		&model.Id,
+		&model.Title,
+		&model.Path,
+		&model.Thumbnail,
+		&model.Source,
+		&model.Metadata,
+		&model.CreatedAt,
+		&model.Owner,
+		&model.Extractor,
+		&model.Ext,
+		&model.Duration,
+		&model.Size,
+		&model.Missing,
+		&model.LastWatchedAt,
+		&model.EvictedAt,
+		&model.EvictedBy,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := r.Tags(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	model.Tags = tags[id]
 
-	return err
+	return &model, nil
 }
 
-func (r *Repository) SoftDelete(ctx context.Context, id string) (*data.ArchiveEntry, error) {
+func (r *Repository) SoftDelete(ctx context.Context, id string, owner string) (*data.ArchiveEntry, error) {
 	conn, err := r.db.Conn(ctx)
 	if err != nil {
 		return nil, err
@@ -59,7 +155,13 @@ func (r *Repository) SoftDelete(ctx context.Context, id string) (*data.ArchiveEn
 
 	var model data.ArchiveEntry
 
-	row := tx.QueryRowContext(ctx, "SELECT * FROM archive WHERE id = ?", id)
+	row := tx.QueryRowContext(
+		ctx,
+		"SELECT "+columns+" FROM archive WHERE id = ? AND (? = '' OR owner = ?)",
+		id,
+		owner,
+		owner,
+	)
 
 	if err := row.Scan(
 		&model.Id,
@@ -69,6 +171,15 @@ func (r *Repository) SoftDelete(ctx context.Context, id string) (*data.ArchiveEn
 		&model.Source,
 		&model.Metadata,
 		&model.CreatedAt,
+		&model.Owner,
+		&model.Extractor,
+		&model.Ext,
+		&model.Duration,
+		&model.Size,
+		&model.Missing,
+		&model.LastWatchedAt,
+		&model.EvictedAt,
+		&model.EvictedBy,
 	); err != nil {
 		return nil, err
 	}
@@ -85,20 +196,115 @@ func (r *Repository) SoftDelete(ctx context.Context, id string) (*data.ArchiveEn
 	return &model, nil
 }
 
-func (r *Repository) HardDelete(ctx context.Context, id string) (*data.ArchiveEntry, error) {
-	entry, err := r.SoftDelete(ctx, id)
-	if err != nil {
-		return nil, err
+func (r *Repository) List(
+	ctx context.Context,
+	filter domain.ListFilter,
+	after *domain.Cursor,
+	limit int,
+) (*[]data.ArchiveEntry, error) {
+	key, ok := sortKeys[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: can't sort by %q", domain.ErrInvalidFilter, filter.SortBy)
 	}
 
-	if err := os.Remove(entry.Path); err != nil {
-		return nil, err
+	var (
+		where []string
+		args  []any
+	)
+
+	if filter.Owner != "" {
+		where = append(where, "owner = ?")
+		args = append(args, filter.Owner)
+	}
+	if len(filter.Ids) > 0 {
+		where = append(where, "id IN (?"+strings.Repeat(", ?", len(filter.Ids)-1)+")")
+		for _, id := range filter.Ids {
+			args = append(args, id)
+		}
+	}
+	if query := ftsQuery(filter.Query); query != "" {
+		where = append(where, "id IN (SELECT id FROM archive_fts WHERE archive_fts MATCH ?)")
+		args = append(args, query)
+	}
+	for _, tag := range filter.Tags {
+		where = append(where, "id IN (SELECT entry_id FROM archive_tags WHERE tag = ?)")
+		args = append(args, tag)
+	}
+	if filter.Collection != "" {
+		where = append(where, "id IN (SELECT entry_id FROM collection_entries WHERE collection_id = ?)")
+		args = append(args, filter.Collection)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From.Local())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To.Local())
+	}
+	if filter.Extractor != "" {
+		where = append(where, "extractor = ? COLLATE NOCASE")
+		args = append(args, filter.Extractor)
+	}
+	if len(filter.Exts) > 0 {
+		where = append(where, "LOWER(ext) IN (?"+strings.Repeat(", ?", len(filter.Exts)-1)+")")
+		for _, ext := range filter.Exts {
+			args = append(args, strings.ToLower(strings.TrimPrefix(ext, ".")))
+		}
+	}
+	if filter.MinDuration > 0 {
+		where = append(where, "duration >= ?")
+		args = append(args, filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		where = append(where, "duration <= ?")
+		args = append(args, filter.MaxDuration)
+	}
+	if filter.Missing != nil {
+		where = append(where, "missing = ?")
+		args = append(args, *filter.Missing)
+	}
+	if filter.Evicted != nil {
+		if *filter.Evicted {
+			where = append(where, "evicted_at IS NOT NULL")
+		} else {
+			where = append(where, "evicted_at IS NULL")
+		}
 	}
 
-	return entry, nil
-}
+	order, cmp := "ASC", ">"
+	if filter.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	// keyset pagination: stable while entries are added or removed
+	if after != nil {
+		if filter.SortBy == "" {
+			where = append(where, "rowid "+cmp+" ?")
+			args = append(args, after.RowId)
+		} else {
+			value := after.Value
+			if t, ok := value.(time.Time); ok {
+				value = t.Local()
+			}
+
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND rowid %[2]s ?))", key, cmp))
+			args = append(args, value, value, after.RowId)
+		}
+	}
+
+	query := "SELECT rowid, " + columns + " FROM archive"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if filter.SortBy == "" {
+		query += " ORDER BY rowid " + order
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, rowid %s", key, order, order)
+	}
+	query += " LIMIT ?"
+	args = append(args, limit)
 
-func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]data.ArchiveEntry, error) {
 	conn, err := r.db.Conn(ctx)
 	if err != nil {
 		return nil, err
@@ -108,18 +314,18 @@ func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]da
 
 	var entries []data.ArchiveEntry
 
-	// cursor based pagination
-	rows, err := conn.QueryContext(ctx, "SELECT rowid, * FROM archive WHERE rowid > ? LIMIT ?", startRowId, limit)
+	rows, err := conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
-		var rowId int64
 		var entry data.ArchiveEntry
 
 		if err := rows.Scan(
-			&rowId,
+			&entry.RowId,
 			&entry.Id,
 			&entry.Title,
 			&entry.Path,
@@ -127,6 +333,15 @@ func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]da
 			&entry.Source,
 			&entry.Metadata,
 			&entry.CreatedAt,
+			&entry.Owner,
+			&entry.Extractor,
+			&entry.Ext,
+			&entry.Duration,
+			&entry.Size,
+			&entry.Missing,
+			&entry.LastWatchedAt,
+			&entry.EvictedAt,
+			&entry.EvictedBy,
 		); err != nil {
 			return &entries, err
 		}
@@ -134,7 +349,19 @@ func (r *Repository) List(ctx context.Context, startRowId int, limit int) (*[]da
 		entries = append(entries, entry)
 	}
 
-	return &entries, err
+	return &entries, rows.Err()
+}
+
+// Turn what the user typed into a full text query: every word must match,
+// as a prefix, and the FTS5 syntax is escaped.
+func ftsQuery(q string) string {
+	words := strings.Fields(q)
+
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+
+	return strings.Join(words, " ")
 }
 
 func (r *Repository) GetCursor(ctx context.Context, id string) (int64, error) {
@@ -0,0 +1,17 @@
+package repository
+
+import "testing"
+
+func TestFtsQuery(t *testing.T) {
+	for q, want := range map[string]string{
+		"":                 "",
+		"  ":               "",
+		"cats":             `"cats"*`,
+		"funny  cats":      `"funny"* "cats"*`,
+		`say "hi" OR NEAR`: `"say"* """hi"""* "OR"* "NEAR"*`,
+	} {
+		if got := ftsQuery(q); got != want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", q, got, want)
+		}
+	}
+}
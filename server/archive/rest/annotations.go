@@ -0,0 +1,282 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type collectionRequest struct {
+	Name string `json:"name"`
+}
+
+type noteRequest struct {
+	Content string `json:"content"`
+}
+
+// Tags implements domain.RestHandler.
+func (h *Handler) Tags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Tags(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ListTags implements domain.RestHandler.
+func (h *Handler) ListTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.ListTags(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// AddTags implements domain.RestHandler.
+func (h *Handler) AddTags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req tagsRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.AddTags(r.Context(), chi.URLParam(r, "id"), req.Tags)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RemoveTag implements domain.RestHandler.
+func (h *Handler) RemoveTag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		err := h.service.RemoveTag(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "tag"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// ListCollections implements domain.RestHandler.
+func (h *Handler) ListCollections() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.ListCollections(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// CreateCollection implements domain.RestHandler.
+func (h *Handler) CreateCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req collectionRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.CreateCollection(r.Context(), req.Name)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DeleteCollection implements domain.RestHandler.
+func (h *Handler) DeleteCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.DeleteCollection(r.Context(), chi.URLParam(r, "collection")); err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// AddToCollection implements domain.RestHandler.
+func (h *Handler) AddToCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		err := h.service.AddToCollection(r.Context(), chi.URLParam(r, "collection"), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// RemoveFromCollection implements domain.RestHandler.
+func (h *Handler) RemoveFromCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		err := h.service.RemoveFromCollection(r.Context(), chi.URLParam(r, "collection"), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// ListNotes implements domain.RestHandler.
+func (h *Handler) ListNotes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.ListNotes(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// AddNote implements domain.RestHandler.
+func (h *Handler) AddNote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req noteRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.AddNote(r.Context(), chi.URLParam(r, "id"), req.Content)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// UpdateNote implements domain.RestHandler.
+func (h *Handler) UpdateNote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req noteRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.UpdateNote(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "note"), req.Content)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DeleteNote implements domain.RestHandler.
+func (h *Handler) DeleteNote() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.DeleteNote(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "note")); err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
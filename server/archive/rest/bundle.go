@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+// Export implements domain.RestHandler.
+//
+// Takes the filters of the listing, plus the entry ids as entry, and what to
+// bundle besides the entries: media, thumbnails and info.
+func (h *Handler) Export() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		q := r.URL.Query()
+
+		filter, err := ParseFilter(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filter.Ids = q["entry"]
+
+		opts := domain.ExportOptions{Format: q.Get("format")}
+
+		if opts.Format == "" {
+			opts.Format = "tar"
+		}
+		if opts.Format != "tar" && opts.Format != "zip" {
+			http.Error(w, "format must be tar or zip", http.StatusBadRequest)
+			return
+		}
+
+		for param, dst := range map[string]*bool{
+			"media":      &opts.Media,
+			"thumbnails": &opts.Thumbnails,
+			"info":       &opts.Info,
+		} {
+			if v := q.Get(param); v != "" {
+				if *dst, err = strconv.ParseBool(v); err != nil {
+					http.Error(w, fmt.Sprintf("%s: %s", param, err.Error()), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		filename := fmt.Sprintf("archive-%s.%s", time.Now().Format("20060102-150405"), opts.Format)
+
+		w.Header().Set("Content-Type", "application/"+opts.Format)
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+		// the status is already sent once the bundle is being written
+		if err := h.service.Export(r.Context(), w, filter, opts); err != nil {
+			slog.Error("failed to export the archive", slog.String("err", err.Error()))
+		}
+	}
+}
+
+// Largest bundle accepted by an import, it's spooled to a temporary file
+const maxBundleSize = 64 << 30
+
+// Import implements domain.RestHandler.
+//
+// The bundle is the request body or the bundle field of a multipart form.
+func (h *Handler) Import() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBundleSize)
+
+		var (
+			bundle io.ReaderAt
+			size   int64
+		)
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, header, err := r.FormFile("bundle")
+			if err != nil {
+				http.Error(w, err.Error(), bodyStatusCode(err))
+				return
+			}
+
+			defer file.Close()
+			defer r.MultipartForm.RemoveAll()
+
+			bundle, size = file, header.Size
+		} else {
+			// zip bundles are read from their end
+			tmp, err := os.CreateTemp("", "archive-import-*")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+
+			if size, err = io.Copy(tmp, r.Body); err != nil {
+				http.Error(w, err.Error(), bodyStatusCode(err))
+				return
+			}
+
+			bundle = tmp
+		}
+
+		res, err := h.service.Import(r.Context(), bundle, size)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Bodies past maxBundleSize are too large, the other errors are bad requests
+func bodyStatusCode(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -2,15 +2,21 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
 
 	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+	trash "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
 )
 
 type Handler struct {
@@ -29,24 +35,26 @@ func (h *Handler) List() http.HandlerFunc {
 		defer r.Body.Close()
 		w.Header().Set("Content-Type", "application/json")
 
-		var (
-			startRowIdParam = r.URL.Query().Get("id")
-			LimitParam      = r.URL.Query().Get("limit")
-		)
-
-		startRowId, err := strconv.Atoi(startRowIdParam)
+		filter, err := ParseFilter(r.URL.Query())
 		if err != nil {
-			startRowId = 0
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		limit, err := strconv.Atoi(LimitParam)
-		if err != nil {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
 			limit = 50
 		}
 
-		res, err := h.service.List(r.Context(), startRowId, limit)
+		// id is the rowid cursor of the unsorted listing
+		cursor := r.URL.Query().Get("cursor")
+		if cursor == "" && filter.SortBy == "" {
+			cursor = r.URL.Query().Get("id")
+		}
+
+		res, err := h.service.List(r.Context(), filter, cursor, limit)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), statusCode(err))
 			return
 		}
 
@@ -57,6 +65,115 @@ func (h *Handler) List() http.HandlerFunc {
 	}
 }
 
+// The filters of a listing from the query string. Dates are RFC 3339 or
+// YYYY-MM-DD, inclusive, durations are in seconds and ext can be repeated.
+func ParseFilter(q url.Values) (domain.ListFilter, error) {
+	filter := domain.ListFilter{
+		Query:     q.Get("q"),
+		Extractor: q.Get("extractor"),
+		Exts:      q["ext"],
+		Owner:     q.Get("owner"),
+		Tags:      q["tag"],
+		// the ones of other users match no entries
+		Collection: q.Get("collection"),
+		SortBy:     q.Get("sort"),
+	}
+
+	invalid := func(param string, err error) error {
+		return fmt.Errorf("%w: %s: %s", domain.ErrInvalidFilter, param, err.Error())
+	}
+
+	var err error
+
+	if filter.From, err = parseDate(q.Get("from"), false); err != nil {
+		return filter, invalid("from", err)
+	}
+	if filter.To, err = parseDate(q.Get("to"), true); err != nil {
+		return filter, invalid("to", err)
+	}
+
+	for param, dst := range map[string]*float64{
+		"min_duration": &filter.MinDuration,
+		"max_duration": &filter.MaxDuration,
+	} {
+		if v := q.Get(param); v != "" {
+			if *dst, err = strconv.ParseFloat(v, 64); err != nil {
+				return filter, invalid(param, err)
+			}
+		}
+	}
+
+	if v := q.Get("missing"); v != "" {
+		missing, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, invalid("missing", err)
+		}
+		filter.Missing = &missing
+	}
+
+	if v := q.Get("evicted"); v != "" {
+		evicted, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, invalid("evicted", err)
+		}
+		filter.Evicted = &evicted
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, invalid("order", errors.New("must be asc or desc"))
+	}
+
+	return filter, nil
+}
+
+// A day matches until its end when it's the upper bound
+func parseDate(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.Add(time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidFilter),
+		errors.Is(err, domain.ErrInvalidTag),
+		errors.Is(err, domain.ErrInvalidCollection),
+		errors.Is(err, domain.ErrInvalidNote),
+		errors.Is(err, domain.ErrInvalidBundle),
+		errors.Is(err, trash.ErrInvalidPath):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrNotFound),
+		errors.Is(err, domain.ErrCollectionNotFound),
+		errors.Is(err, domain.ErrNoteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrCollectionExists),
+		errors.Is(err, domain.ErrReconcileRunning):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
 // Archive implements domain.RestHandler.
 func (h *Handler) Archive() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -70,6 +187,8 @@ func (h *Handler) Archive() http.HandlerFunc {
 			return
 		}
 
+		req.Owner = auth.Owner(r.Context())
+
 		err := h.service.Archive(r.Context(), &req)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -90,7 +209,7 @@ func (h *Handler) HardDelete() http.HandlerFunc {
 
 		res, err := h.service.HardDelete(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), statusCode(err))
 			return
 		}
 
@@ -152,11 +271,35 @@ func (h *Handler) ApplyRouter() func(chi.Router) {
 		if config.Instance().UseOpenId {
 			r.Use(openid.Middleware)
 		}
+		r.Use(middlewares.RequireScope(auth.ScopeArchive))
+		r.Use(middlewares.Writable)
 
 		r.Get("/", h.List())
 		r.Get("/cursor/{id}", h.GetCursor())
 		r.Post("/", h.Archive())
 		r.Delete("/soft/{id}", h.SoftDelete())
 		r.Delete("/hard/{id}", h.HardDelete())
+
+		r.Get("/export", h.Export())
+		r.With(middlewares.RequireAdmin).Post("/import", h.Import())
+
+		r.With(middlewares.RequireAdmin).Get("/reconcile", h.LastReconcile())
+		r.With(middlewares.RequireAdmin).Post("/reconcile", h.Reconcile())
+
+		r.Get("/tags", h.ListTags())
+		r.Get("/{id}/tags", h.Tags())
+		r.Post("/{id}/tags", h.AddTags())
+		r.Delete("/{id}/tags/{tag}", h.RemoveTag())
+
+		r.Get("/collections", h.ListCollections())
+		r.Post("/collections", h.CreateCollection())
+		r.Delete("/collections/{collection}", h.DeleteCollection())
+		r.Put("/collections/{collection}/entries/{id}", h.AddToCollection())
+		r.Delete("/collections/{collection}/entries/{id}", h.RemoveFromCollection())
+
+		r.Get("/{id}/notes", h.ListNotes())
+		r.Post("/{id}/notes", h.AddNote())
+		r.Put("/{id}/notes/{note}", h.UpdateNote())
+		r.Delete("/{id}/notes/{note}", h.DeleteNote())
 	}
 }
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Reconcile implements domain.RestHandler.
+//
+// Nothing is changed with dry_run=true, the report tells what would be.
+func (h *Handler) Reconcile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var dryRun bool
+
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "dry_run: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// finished even if the client goes away, half reconciled otherwise
+		res, err := h.service.Reconcile(context.WithoutCancel(r.Context()), dryRun)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// LastReconcile implements domain.RestHandler.
+func (h *Handler) LastReconcile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res := h.service.LastReconcile()
+		if res == nil {
+			http.Error(w, "no reconciliation ran yet", http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+)
+
+// Tags implements domain.Service.
+func (s *Service) Tags(ctx context.Context, id string) ([]string, error) {
+	if _, err := s.repository.Get(ctx, id, auth.OwnerFilter(ctx)); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.repository.Tags(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	if tags[id] == nil {
+		return []string{}, nil
+	}
+
+	return tags[id], nil
+}
+
+// ListTags implements domain.Service.
+func (s *Service) ListTags(ctx context.Context) (*[]domain.Tag, error) {
+	res, err := s.repository.ListTags(ctx, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]domain.Tag, len(*res))
+
+	for i, model := range *res {
+		tags[i] = domain.Tag{
+			Name:    model.Name,
+			Entries: model.Entries,
+		}
+	}
+
+	return &tags, nil
+}
+
+// AddTags implements domain.Service.
+func (s *Service) AddTags(ctx context.Context, id string, tags []string) ([]string, error) {
+	tags, err := domain.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return nil, domain.ErrInvalidTag
+	}
+
+	if err := s.repository.AddTags(ctx, id, auth.OwnerFilter(ctx), tags); err != nil {
+		return nil, err
+	}
+
+	return s.Tags(ctx, id)
+}
+
+// RemoveTag implements domain.Service.
+func (s *Service) RemoveTag(ctx context.Context, id string, tag string) error {
+	tag, err := domain.NormalizeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.RemoveTag(ctx, id, auth.OwnerFilter(ctx), tag)
+}
+
+// CreateCollection implements domain.Service.
+func (s *Service) CreateCollection(ctx context.Context, name string) (*domain.Collection, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return nil, fmt.Errorf("%w: the name must be between 1 and 255 characters", domain.ErrInvalidCollection)
+	}
+
+	model := data.Collection{
+		Name:  name,
+		Owner: auth.Owner(ctx),
+	}
+
+	if err := s.repository.CreateCollection(ctx, &model); err != nil {
+		return nil, err
+	}
+
+	return toCollection(&model), nil
+}
+
+// ListCollections implements domain.Service.
+func (s *Service) ListCollections(ctx context.Context) (*[]domain.Collection, error) {
+	res, err := s.repository.ListCollections(ctx, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	collections := make([]domain.Collection, len(*res))
+
+	for i, model := range *res {
+		collections[i] = *toCollection(&model)
+	}
+
+	return &collections, nil
+}
+
+// DeleteCollection implements domain.Service.
+func (s *Service) DeleteCollection(ctx context.Context, id string) error {
+	return s.repository.DeleteCollection(ctx, id, auth.OwnerFilter(ctx))
+}
+
+// AddToCollection implements domain.Service.
+func (s *Service) AddToCollection(ctx context.Context, collectionId string, id string) error {
+	return s.repository.AddToCollection(ctx, collectionId, id, auth.OwnerFilter(ctx))
+}
+
+// RemoveFromCollection implements domain.Service.
+func (s *Service) RemoveFromCollection(ctx context.Context, collectionId string, id string) error {
+	return s.repository.RemoveFromCollection(ctx, collectionId, id, auth.OwnerFilter(ctx))
+}
+
+// ListNotes implements domain.Service.
+func (s *Service) ListNotes(ctx context.Context, id string) (*[]domain.Note, error) {
+	res, err := s.repository.ListNotes(ctx, id, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]domain.Note, len(*res))
+
+	for i, model := range *res {
+		notes[i] = *toNote(&model)
+	}
+
+	return &notes, nil
+}
+
+// AddNote implements domain.Service.
+func (s *Service) AddNote(ctx context.Context, id string, content string) (*domain.Note, error) {
+	if err := validateNote(content); err != nil {
+		return nil, err
+	}
+
+	model := data.Note{
+		EntryId: id,
+		Author:  auth.Owner(ctx),
+		Content: content,
+	}
+
+	if err := s.repository.AddNote(ctx, &model, auth.OwnerFilter(ctx)); err != nil {
+		return nil, err
+	}
+
+	return toNote(&model), nil
+}
+
+// UpdateNote implements domain.Service.
+func (s *Service) UpdateNote(ctx context.Context, id string, noteId string, content string) (*domain.Note, error) {
+	if err := validateNote(content); err != nil {
+		return nil, err
+	}
+
+	model := data.Note{
+		Id:      noteId,
+		EntryId: id,
+		Content: content,
+	}
+
+	if err := s.repository.UpdateNote(ctx, &model, auth.OwnerFilter(ctx)); err != nil {
+		return nil, err
+	}
+
+	return toNote(&model), nil
+}
+
+// DeleteNote implements domain.Service.
+func (s *Service) DeleteNote(ctx context.Context, id string, noteId string) error {
+	return s.repository.DeleteNote(ctx, id, noteId, auth.OwnerFilter(ctx))
+}
+
+func validateNote(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("%w: empty", domain.ErrInvalidNote)
+	}
+	if len(content) > 64*1024 {
+		return fmt.Errorf("%w: longer than 64KiB", domain.ErrInvalidNote)
+	}
+	return nil
+}
+
+func toCollection(model *data.Collection) *domain.Collection {
+	return &domain.Collection{
+		Id:        model.Id,
+		Name:      model.Name,
+		Owner:     model.Owner,
+		Entries:   model.Entries,
+		CreatedAt: model.CreatedAt,
+	}
+}
+
+func toNote(model *data.Note) *domain.Note {
+	return &domain.Note{
+		Id:        model.Id,
+		EntryId:   model.EntryId,
+		Author:    model.Author,
+		Content:   model.Content,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+	}
+}
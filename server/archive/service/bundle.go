@@ -0,0 +1,639 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// A bundle is a tar or zip file holding a manifest.json, describing the
+// entries, and the files of the entries under files/, at their path relative
+// to the download directory.
+const (
+	manifestName  = "manifest.json"
+	filesDir      = "files/"
+	bundleVersion = 1
+	// entries read from the database at once while exporting
+	exportPageSize = 500
+)
+
+// Files written by yt-dlp next to the media file
+var (
+	thumbnailExts = []string{".jpg", ".jpeg", ".png", ".webp"}
+	infoExt       = ".info.json"
+)
+
+type manifest struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Entries   []manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Id string `json:"id"`
+	// relative to the download directory, slash separated
+	Path        string         `json:"path"`
+	Title       string         `json:"title"`
+	Thumbnail   string         `json:"thumbnail"`
+	Source      string         `json:"source"`
+	Metadata    string         `json:"metadata"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Extractor   string         `json:"extractor"`
+	Ext         string         `json:"ext"`
+	Duration    float64        `json:"duration"`
+	Size        int64          `json:"size"`
+	Tags        []string       `json:"tags,omitempty"`
+	Collections []string       `json:"collections,omitempty"`
+	Notes       []manifestNote `json:"notes,omitempty"`
+	// included in the bundle, relative to the download directory as well
+	Files []string `json:"files,omitempty"`
+}
+
+type manifestNote struct {
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Export implements domain.Service.
+func (s *Service) Export(ctx context.Context, w io.Writer, filter domain.ListFilter, opts domain.ExportOptions) error {
+	if owner := auth.OwnerFilter(ctx); owner != "" {
+		filter.Owner = owner
+	}
+
+	var err error
+
+	if filter.Tags, err = domain.NormalizeTags(filter.Tags); err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrInvalidFilter, err)
+	}
+
+	// the archive order: the filter can't sort the bundle
+	filter.SortBy, filter.Desc = "", false
+
+	bw, err := newBundleWriter(w, opts.Format)
+	if err != nil {
+		return err
+	}
+
+	m := manifest{
+		Version:   bundleVersion,
+		CreatedAt: time.Now(),
+		Entries:   []manifestEntry{},
+	}
+
+	// absolute path of the files by their name in the bundle
+	files := make(map[string]string)
+
+	var after *domain.Cursor
+
+	for {
+		res, err := s.repository.List(ctx, filter, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+
+		if len(*res) == 0 {
+			break
+		}
+
+		entries, err := s.manifestEntries(ctx, *res, opts, files)
+		if err != nil {
+			return err
+		}
+
+		m.Entries = append(m.Entries, entries...)
+
+		after = &domain.Cursor{RowId: (*res)[len(*res)-1].RowId}
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := bw.add(manifestName, int64(len(b)), m.CreatedAt, bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	// entries can share their files
+	for _, entry := range m.Entries {
+		for _, rel := range entry.Files {
+			file, ok := files[rel]
+			if !ok {
+				continue
+			}
+
+			if err := addFile(bw, filesDir+rel, file); err != nil {
+				return err
+			}
+
+			delete(files, rel)
+		}
+	}
+
+	return bw.Close()
+}
+
+func (s *Service) manifestEntries(
+	ctx context.Context,
+	models []data.ArchiveEntry,
+	opts domain.ExportOptions,
+	files map[string]string,
+) ([]manifestEntry, error) {
+	ids := make([]string, len(models))
+	for i, model := range models {
+		ids[i] = model.Id
+	}
+
+	tags, err := s.repository.Tags(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := s.repository.EntryCollections(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]manifestEntry, len(models))
+
+	for i, model := range models {
+		notes, err := s.repository.ListNotes(ctx, model.Id, "")
+		if err != nil {
+			return nil, err
+		}
+
+		entry := manifestEntry{
+			Id:          model.Id,
+			Path:        relativePath(model.Path),
+			Title:       model.Title,
+			Thumbnail:   model.Thumbnail,
+			Source:      model.Source,
+			Metadata:    model.Metadata,
+			CreatedAt:   model.CreatedAt,
+			Extractor:   model.Extractor,
+			Ext:         model.Ext,
+			Duration:    model.Duration,
+			Size:        model.Size,
+			Tags:        tags[model.Id],
+			Collections: collections[model.Id],
+		}
+
+		for _, note := range *notes {
+			entry.Notes = append(entry.Notes, manifestNote{
+				Content:   note.Content,
+				CreatedAt: note.CreatedAt,
+			})
+		}
+
+		for _, file := range exportedFiles(model.Path, opts) {
+			rel := path.Join(path.Dir(entry.Path), filepath.Base(file))
+			files[rel] = file
+			entry.Files = append(entry.Files, rel)
+		}
+
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
+
+// The media file and the files yt-dlp wrote next to it, the ones asked for
+// and still on disk
+func exportedFiles(mediaPath string, opts domain.ExportOptions) []string {
+	var (
+		stem      = strings.TrimSuffix(mediaPath, filepath.Ext(mediaPath))
+		candidate []string
+		files     []string
+	)
+
+	if opts.Media {
+		candidate = append(candidate, mediaPath)
+	}
+	if opts.Thumbnails {
+		for _, ext := range thumbnailExts {
+			candidate = append(candidate, stem+ext)
+		}
+	}
+	if opts.Info {
+		candidate = append(candidate, stem+infoExt)
+	}
+
+	for _, file := range candidate {
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+func addFile(bw bundleWriter, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	return bw.add(name, info.Size(), info.ModTime(), f)
+}
+
+// Path relative to the download directory, slash separated. The files out of
+// it end up at its root.
+func relativePath(p string) string {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return filepath.Base(p)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Base(p)
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(p)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// Resolve a path of a bundle under the download directory, refusing the ones
+// escaping it and the hidden ones, e.g. the recycle bin
+func resolvePath(rel string) (string, error) {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return "", err
+	}
+
+	clean := path.Clean("/" + strings.ReplaceAll(rel, `\`, "/"))
+	if rel == "" || clean == "/" || clean != "/"+rel {
+		return "", fmt.Errorf("%w: invalid path %q", domain.ErrInvalidBundle, rel)
+	}
+
+	for _, name := range strings.Split(rel, "/") {
+		if strings.HasPrefix(name, ".") {
+			return "", fmt.Errorf("%w: hidden path %q", domain.ErrInvalidBundle, rel)
+		}
+	}
+
+	return filepath.Join(root, filepath.FromSlash(clean)), nil
+}
+
+// Import implements domain.Service.
+func (s *Service) Import(ctx context.Context, r io.ReaderAt, size int64) (*domain.ImportReport, error) {
+	br, err := openBundle(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := br.open(manifestName)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidBundle, err)
+	}
+
+	if m.Version != bundleVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", domain.ErrInvalidBundle, m.Version)
+	}
+
+	var (
+		report      domain.ImportReport
+		owner       = auth.Owner(ctx)
+		collections = make(map[string]string)
+	)
+
+	for _, entry := range m.Entries {
+		if err := ctx.Err(); err != nil {
+			return &report, err
+		}
+
+		imported, files, err := s.importEntry(ctx, br, &entry, owner, collections)
+		report.Files += files
+
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", entry.Id, err.Error()))
+		case imported:
+			report.Imported++
+		default:
+			report.Skipped++
+		}
+	}
+
+	return &report, nil
+}
+
+// Archive an entry of a bundle, unless it's already present, returning how
+// many of its files have been written
+func (s *Service) importEntry(
+	ctx context.Context,
+	br *bundleReader,
+	entry *manifestEntry,
+	owner string,
+	collections map[string]string,
+) (bool, int, error) {
+	if entry.Id == "" {
+		return false, 0, fmt.Errorf("%w: missing id", domain.ErrInvalidBundle)
+	}
+
+	exists, err := s.repository.Exists(ctx, entry.Id, entry.Source)
+	if err != nil || exists {
+		return false, 0, err
+	}
+
+	mediaPath, err := resolvePath(entry.Path)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tags, err := domain.NormalizeTags(entry.Tags)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var written int
+
+	for _, rel := range entry.Files {
+		ok, err := extract(br, rel)
+		if err != nil {
+			return false, written, err
+		}
+		if ok {
+			written++
+		}
+	}
+
+	err = s.repository.Archive(ctx, &data.ArchiveEntry{
+		Id:        entry.Id,
+		Title:     entry.Title,
+		Path:      mediaPath,
+		Thumbnail: entry.Thumbnail,
+		Source:    entry.Source,
+		Metadata:  entry.Metadata,
+		CreatedAt: entry.CreatedAt.Round(0).Local(),
+		Owner:     owner,
+		Extractor: entry.Extractor,
+		Ext:       entry.Ext,
+		Duration:  entry.Duration,
+		Size:      entry.Size,
+		Tags:      tags,
+	})
+	if err != nil {
+		return false, written, err
+	}
+
+	for _, note := range entry.Notes {
+		if validateNote(note.Content) != nil {
+			continue
+		}
+
+		err := s.repository.AddNote(ctx, &data.Note{
+			EntryId: entry.Id,
+			Author:  owner,
+			Content: note.Content,
+		}, "")
+		if err != nil {
+			return true, written, err
+		}
+	}
+
+	for _, name := range entry.Collections {
+		id, err := s.collectionByName(ctx, owner, name, collections)
+		if err != nil {
+			return true, written, err
+		}
+
+		if err := s.repository.AddToCollection(ctx, id, entry.Id, ""); err != nil {
+			return true, written, err
+		}
+	}
+
+	return true, written, nil
+}
+
+// The collection of the owner with the name, created if missing
+func (s *Service) collectionByName(ctx context.Context, owner, name string, cache map[string]string) (string, error) {
+	key := strings.ToLower(name)
+
+	if id, ok := cache[key]; ok {
+		return id, nil
+	}
+
+	existing, err := s.repository.ListCollections(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range *existing {
+		if c.Owner == owner && strings.EqualFold(c.Name, name) {
+			cache[key] = c.Id
+			return c.Id, nil
+		}
+	}
+
+	model := data.Collection{Name: name, Owner: owner}
+
+	if err := s.repository.CreateCollection(ctx, &model); err != nil {
+		return "", err
+	}
+
+	cache[key] = model.Id
+
+	return model.Id, nil
+}
+
+// Write a file of the bundle under the download directory. Files already
+// there are kept as they are.
+func extract(br *bundleReader, rel string) (bool, error) {
+	dst, err := resolvePath(rel)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		return false, nil
+	}
+
+	rc, err := br.open(filesDir + rel)
+	if err != nil {
+		return false, err
+	}
+
+	defer rc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return false, err
+	}
+
+	// a partial file must not look like an imported one
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".import-*")
+	if err != nil {
+		return false, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, rc); err != nil {
+		tmp.Close()
+		return false, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(tmp.Name(), dst)
+}
+
+type bundleWriter interface {
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+func newBundleWriter(w io.Writer, format string) (bundleWriter, error) {
+	switch format {
+	case "", "tar":
+		return &tarBundle{tar.NewWriter(w)}, nil
+	case "zip":
+		return &zipBundle{zip.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q, must be tar or zip", domain.ErrInvalidFilter, format)
+	}
+}
+
+type tarBundle struct{ *tar.Writer }
+
+func (b *tarBundle) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := b.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+		Format:  tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+
+	// a file growing while it's exported would corrupt the archive
+	_, err = io.CopyN(b, r, size)
+	return err
+}
+
+type zipBundle struct{ *zip.Writer }
+
+func (b *zipBundle) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	method := zip.Store
+	// media files are already compressed
+	if name == manifestName {
+		method = zip.Deflate
+	}
+
+	w, err := b.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(w, r, size)
+	return err
+}
+
+// The files of a bundle by name, read on demand
+type bundleReader struct {
+	files map[string]func() (io.ReadCloser, error)
+}
+
+func (b *bundleReader) open(name string) (io.ReadCloser, error) {
+	open, ok := b.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not found", domain.ErrInvalidBundle, name)
+	}
+	return open()
+}
+
+// Open a tar or zip bundle, told apart by their signature
+func openBundle(r io.ReaderAt, size int64) (*bundleReader, error) {
+	b := &bundleReader{files: make(map[string]func() (io.ReadCloser, error))}
+
+	signature := make([]byte, 4)
+	if _, err := r.ReadAt(signature, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidBundle, err)
+	}
+
+	if bytes.Equal(signature, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidBundle, err)
+		}
+
+		for _, f := range zr.File {
+			b.files[f.Name] = f.Open
+		}
+
+		return b, nil
+	}
+
+	// the offset of each file is recorded to read them later in any order
+	section := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(section)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidBundle, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		offset, err := section.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+
+		content := io.NewSectionReader(r, offset, header.Size)
+
+		b.files[header.Name] = func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(content, 0, content.Size())), nil
+		}
+	}
+
+	return b, nil
+}
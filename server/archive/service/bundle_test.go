@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+func TestBundleRoundtrip(t *testing.T) {
+	files := map[string]string{
+		manifestName:             `{"version":1}`,
+		filesDir + "a.mp4":       "media",
+		filesDir + "sub/b.webm":  "more media",
+		filesDir + "sub/b.jpg":   "",
+		filesDir + "c.info.json": "{}",
+	}
+
+	for _, format := range []string{"tar", "zip"} {
+		var buf bytes.Buffer
+
+		bw, err := newBundleWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, content := range files {
+			if err := bw.add(name, int64(len(content)), time.Now(), strings.NewReader(content)); err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+		}
+
+		if err := bw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		br, err := openBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		for name, want := range files {
+			rc, err := br.open(name)
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != want {
+				t.Errorf("%s: %s = %q, want %q", format, name, got, want)
+			}
+		}
+	}
+
+	if _, err := newBundleWriter(io.Discard, "rar"); err == nil {
+		t.Error("unknown format accepted")
+	}
+
+	if _, err := openBundle(strings.NewReader("garbage"), 7); err == nil {
+		t.Error("invalid bundle accepted")
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	config.Instance().DownloadPath = root
+
+	for _, rel := range []string{"", ".", "../x", "a/../../x", "/abs", `..\x`, "a//b", "a/./b", ".trash/x.mp4", "a/.hidden/b.mp4", ".x"} {
+		if p, err := resolvePath(rel); err == nil {
+			t.Errorf("%q resolved to %q", rel, p)
+		}
+	}
+
+	p, err := resolvePath("sub/a.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := filepath.Join(root, "sub", "a.mp4"); p != want {
+		t.Errorf("got %q, want %q", p, want)
+	}
+
+	if rel := relativePath(p); rel != "sub/a.mp4" {
+		t.Errorf("relative path %q", rel)
+	}
+
+	if rel := relativePath("/elsewhere/a.mp4"); rel != "a.mp4" {
+		t.Errorf("relative path out of the download directory %q", rel)
+	}
+}
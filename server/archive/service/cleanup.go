@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+// Watched implements domain.Service.
+func (s *Service) Watched(ctx context.Context, path string) error {
+	now := time.Now().Round(0).Local()
+
+	for _, path := range paths(path) {
+		if err := s.repository.Watched(ctx, path, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Candidates implements domain.Service.
+func (s *Service) Candidates(ctx context.Context) (*[]domain.Candidate, error) {
+	models, err := s.repository.Candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]domain.Candidate, len(*models))
+
+	for i, model := range *models {
+		candidates[i] = domain.Candidate{
+			Id:           model.Id,
+			Title:        model.Title,
+			Path:         model.Path,
+			Size:         model.Size,
+			CreatedAt:    model.CreatedAt,
+			Uploader:     model.Uploader,
+			Subscription: model.Subscription,
+		}
+
+		if model.LastWatchedAt.Valid {
+			candidates[i].LastWatchedAt = &model.LastWatchedAt.Time
+		}
+	}
+
+	return &candidates, nil
+}
+
+// Evict implements domain.Service.
+//
+// The file is removed, not moved to the trash: evictions are meant to free
+// space.
+func (s *Service) Evict(ctx context.Context, id string, path string, policy string) (*domain.ArchiveEntry, error) {
+	var (
+		model *data.ArchiveEntry
+		err   error
+	)
+
+	if id != "" {
+		model, err = s.repository.Get(ctx, id, "")
+	} else {
+		model, err = s.archiveOrphan(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Round(0).Local()
+
+	// flagged first: a file removed without a record is what must not happen
+	if err := s.repository.SetEvicted(ctx, model.Id, policy, &now); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(model.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.repository.SetEvicted(ctx, model.Id, "", nil)
+		return nil, err
+	}
+
+	slog.Info(
+		"evicted by a cleanup policy",
+		slog.String("path", model.Path),
+		slog.String("policy", policy),
+	)
+
+	entity := toEntity(model)
+	entity.Missing = true
+	entity.EvictedAt = &now
+	entity.EvictedBy = policy
+
+	return entity, nil
+}
+
+// Files without an entry are archived as a reconciliation would, the
+// eviction is recorded like the other ones
+func (s *Service) archiveOrphan(ctx context.Context, path string) (*data.ArchiveEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entity := describeOrphan(ctx, path, info)
+	entity.Id = uuid.NewString()
+
+	if err := s.Archive(ctx, entity); err != nil {
+		return nil, err
+	}
+
+	return s.repository.Get(ctx, entity.Id, "")
+}
+
+// The path as given and, if different, the absolute one
+func paths(path string) []string {
+	abs, err := filepath.Abs(path)
+	if err != nil || abs == path {
+		return []string{path}
+	}
+	return []string{path, abs}
+}
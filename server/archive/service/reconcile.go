@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// files changed more recently may still be written by a download
+const settleTime = time.Minute
+
+// Reconcile implements domain.Service.
+func (s *Service) Reconcile(ctx context.Context, dryRun bool) (*domain.ReconcileReport, error) {
+	if !s.reconciling.TryLock() {
+		return nil, domain.ErrReconcileRunning
+	}
+	defer s.reconciling.Unlock()
+
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// with the download directory unmounted every file would look missing
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("download directory %s is not available", root)
+	}
+
+	report := &domain.ReconcileReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Missing:   []domain.ReconciledFile{},
+		Restored:  []domain.ReconciledFile{},
+		Imported:  []domain.ReconciledFile{},
+	}
+
+	known, err := s.reconcileEntries(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans, err := s.Orphans(ctx, known)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Errors = append(report.Errors, orphans.Errors...)
+
+	for _, orphan := range orphans.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entity := describeOrphan(ctx, orphan.Path, orphan.Info)
+
+		if !dryRun {
+			entity.Id = uuid.NewString()
+
+			if err := s.Archive(ctx, entity); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", orphan.Path, err.Error()))
+				continue
+			}
+		}
+
+		report.Imported = append(report.Imported, domain.ReconciledFile{
+			Id:    entity.Id,
+			Title: entity.Title,
+			Path:  orphan.Path,
+		})
+	}
+
+	report.FinishedAt = time.Now()
+
+	s.mu.Lock()
+	s.reconciled = report
+	s.mu.Unlock()
+
+	slog.Info(
+		"archive reconciled",
+		slog.Bool("dry_run", dryRun),
+		slog.Int("missing", len(report.Missing)),
+		slog.Int("restored", len(report.Restored)),
+		slog.Int("imported", len(report.Imported)),
+		slog.Int("errors", len(report.Errors)),
+	)
+
+	return report, nil
+}
+
+// Flag the entries whose file is gone, or back, returning the absolute path
+// of the files of every entry
+func (s *Service) reconcileEntries(ctx context.Context, report *domain.ReconcileReport) (map[string]bool, error) {
+	files, err := s.repository.Files(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		known    = make(map[string]bool, len(*files))
+		missing  []string
+		restored []string
+	)
+
+	for _, file := range *files {
+		if path, err := filepath.Abs(file.Path); err == nil {
+			known[path] = true
+		}
+
+		_, err := os.Stat(file.Path)
+
+		switch {
+		case err == nil && file.Missing:
+			restored = append(restored, file.Id)
+			report.Restored = append(report.Restored, domain.ReconciledFile{Id: file.Id, Path: file.Path})
+		case errors.Is(err, fs.ErrNotExist) && !file.Missing:
+			missing = append(missing, file.Id)
+			report.Missing = append(report.Missing, domain.ReconciledFile{Id: file.Id, Path: file.Path})
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	if report.DryRun {
+		return known, nil
+	}
+
+	if err := s.repository.SetMissing(ctx, missing, true); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.SetMissing(ctx, restored, false); err != nil {
+		return nil, err
+	}
+
+	return known, nil
+}
+
+// Orphans implements domain.Service.
+func (s *Service) Orphans(ctx context.Context, known map[string]bool) (*domain.OrphanScan, error) {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := &domain.OrphanScan{}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			scan.Errors = append(scan.Errors, err.Error())
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// hidden directories, e.g. the recycle bin, are skipped
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if known[path] || !isOrphanCandidate(d) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			scan.Errors = append(scan.Errors, err.Error())
+			return nil
+		}
+
+		if time.Since(info.ModTime()) < settleTime {
+			return nil
+		}
+
+		scan.Files = append(scan.Files, domain.OrphanFile{Path: path, Info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scan, nil
+}
+
+// Files archived when found without an entry, the other ones written by
+// yt-dlp are left alone
+func isOrphanCandidate(d fs.DirEntry) bool {
+	return d.Type().IsRegular() && domain.IsMediaFile(d.Name())
+}
+
+// LastReconcile implements domain.Service.
+func (s *Service) LastReconcile() *domain.ReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reconciled
+}
+
+// The metadata of an orphan entry, named like the one of the downloads
+type orphanMetadata struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Thumbnail   string    `json:"thumbnail"`
+	OriginalURL string    `json:"original_url,omitempty"`
+	Id          string    `json:"id,omitempty"`
+	Extractor   string    `json:"extractor_key,omitempty"`
+	Ext         string    `json:"ext"`
+	Duration    float64   `json:"duration,omitempty"`
+	Uploader    string    `json:"uploader,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Size        int64     `json:"filesize_approx"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Describe a media file without an entry from the .info.json yt-dlp wrote
+// next to it or, without one, from what ffprobe finds in the file.
+func describeOrphan(ctx context.Context, path string, info fs.FileInfo) *domain.ArchiveEntry {
+	metadata := orphanMetadata{
+		Ext:       strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."),
+		Size:      info.Size(),
+		CreatedAt: info.ModTime(),
+	}
+
+	if !readInfoJSON(path, &metadata) {
+		probe(ctx, path, &metadata)
+	}
+
+	if metadata.Title == "" {
+		metadata.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	raw, _ := json.Marshal(metadata)
+
+	return &domain.ArchiveEntry{
+		Title:     metadata.Title,
+		Path:      path,
+		Thumbnail: metadata.Thumbnail,
+		Source:    metadata.URL,
+		Metadata:  string(raw),
+		CreatedAt: info.ModTime(),
+		Extractor: metadata.Extractor,
+		Ext:       metadata.Ext,
+		Duration:  metadata.Duration,
+		Size:      info.Size(),
+	}
+}
+
+func readInfoJSON(path string, metadata *orphanMetadata) bool {
+	raw, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + infoExt)
+	if err != nil {
+		return false
+	}
+
+	var info struct {
+		Id          string  `json:"id"`
+		Title       string  `json:"title"`
+		WebpageURL  string  `json:"webpage_url"`
+		OriginalURL string  `json:"original_url"`
+		Thumbnail   string  `json:"thumbnail"`
+		Extractor   string  `json:"extractor_key"`
+		Duration    float64 `json:"duration"`
+		Uploader    string  `json:"uploader"`
+		Description string  `json:"description"`
+	}
+
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return false
+	}
+
+	metadata.Id = info.Id
+	metadata.Title = info.Title
+	metadata.URL = info.WebpageURL
+	metadata.OriginalURL = info.OriginalURL
+	metadata.Thumbnail = info.Thumbnail
+	metadata.Extractor = info.Extractor
+	metadata.Duration = info.Duration
+	metadata.Uploader = info.Uploader
+	metadata.Description = info.Description
+
+	if metadata.URL == "" {
+		metadata.URL = info.OriginalURL
+	}
+
+	return true
+}
+
+// Fill the metadata from the container of the file. yt-dlp, with
+// --embed-metadata, stores the page of the video as purl and comment.
+func probe(ctx context.Context, path string, metadata *orphanMetadata) {
+	ffprobe := config.Instance().Reconcile.FFprobePath
+	if ffprobe == "" {
+		ffprobe = "ffprobe"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, ffprobe, "-v", "quiet", "-print_format", "json", "-show_format", path).Output()
+	if err != nil {
+		slog.Debug("failed to probe", slog.String("path", path), slog.String("err", err.Error()))
+		return
+	}
+
+	var res struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+
+	if err := json.Unmarshal(out, &res); err != nil {
+		return
+	}
+
+	metadata.Duration, _ = strconv.ParseFloat(res.Format.Duration, 64)
+
+	// the case of the tags depends on the container
+	tags := make(map[string]string, len(res.Format.Tags))
+	for k, v := range res.Format.Tags {
+		tags[strings.ToLower(k)] = v
+	}
+
+	metadata.Title = tags["title"]
+	metadata.Uploader = tags["artist"]
+	metadata.Description = tags["description"]
+
+	for _, key := range []string{"purl", "comment"} {
+		if v := tags[key]; strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			metadata.URL = v
+			break
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsOrphanCandidate(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, want := range map[string]bool{
+		"video.mp4":         true,
+		"Song.MP3":          true,
+		"video.info.json":   false,
+		"video.webp":        false,
+		"video.mp4.part":    false,
+		"video.f137.mp4":    false,
+		"video.f251-1.webm": false,
+		"video.temp.mkv":    false,
+		".hidden.mp4":       false,
+		"no extension":      false,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := isOrphanCandidate(fs.FileInfoToDirEntry(info)); got != want {
+			t.Errorf("%q: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDescribeOrphan(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "a talk [xyz].webm")
+	if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no ffprobe: the file name is the title
+	t.Setenv("PATH", "")
+
+	entity := describeOrphan(context.Background(), path, info)
+	if entity.Title != "a talk [xyz]" || entity.Ext != "webm" || entity.Size != 5 || entity.Source != "" {
+		t.Errorf("without info: %+v", entity)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "a talk [xyz].info.json"), []byte(`{
+		"id": "xyz",
+		"title": "A talk",
+		"original_url": "https://youtu.be/xyz",
+		"webpage_url": "https://www.youtube.com/watch?v=xyz",
+		"extractor_key": "Youtube",
+		"duration": 61.5,
+		"uploader": "Someone"
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entity = describeOrphan(context.Background(), path, info)
+	if entity.Title != "A talk" ||
+		entity.Source != "https://www.youtube.com/watch?v=xyz" ||
+		entity.Extractor != "Youtube" ||
+		entity.Duration != 61.5 {
+		t.Errorf("with info: %+v", entity)
+	}
+}
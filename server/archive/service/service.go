@@ -2,23 +2,57 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+
+	trash "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
 )
 
 type Service struct {
 	repository domain.Repository
+	trash      trash.Service
+
+	// held while reconciling
+	reconciling sync.Mutex
+	mu          sync.Mutex
+	reconciled  *domain.ReconcileReport
 }
 
-func New(repository domain.Repository) domain.Service {
-	return &Service{
+func New(repository domain.Repository, bin trash.Service) domain.Service {
+	s := &Service{
 		repository: repository,
+		trash:      bin,
 	}
+
+	bin.OnRestore(trash.KindArchive, s.restore)
+
+	return s
 }
 
 // Archive implements domain.Service.
 func (s *Service) Archive(ctx context.Context, entity *domain.ArchiveEntry) error {
+	tags, err := domain.NormalizeTags(entity.Tags)
+	if err != nil {
+		return err
+	}
+
+	describe(entity)
+
+	// stored as text: a single time zone and no monotonic clock reading keep
+	// them in order
+	entity.CreatedAt = entity.CreatedAt.Round(0).Local()
+
 	return s.repository.Archive(ctx, &data.ArchiveEntry{
 		Id:        entity.Id,
 		Title:     entity.Title,
@@ -27,95 +61,275 @@ func (s *Service) Archive(ctx context.Context, entity *domain.ArchiveEntry) erro
 		Source:    entity.Source,
 		Metadata:  entity.Metadata,
 		CreatedAt: entity.CreatedAt,
+		Owner:     entity.Owner,
+		Extractor: entity.Extractor,
+		Ext:       entity.Ext,
+		Duration:  entity.Duration,
+		Size:      entity.Size,
+		Tags:      tags,
 	})
 }
 
+// Fill what the archive is filtered and sorted by from the yt-dlp metadata
+// and the downloaded file, unless it's already set.
+func describe(entity *domain.ArchiveEntry) {
+	var metadata struct {
+		Extractor string  `json:"extractor_key"`
+		Ext       string  `json:"ext"`
+		Duration  float64 `json:"duration"`
+		Size      int64   `json:"filesize_approx"`
+	}
+
+	json.Unmarshal([]byte(entity.Metadata), &metadata)
+
+	if entity.Extractor == "" {
+		entity.Extractor = metadata.Extractor
+	}
+	if entity.Ext == "" {
+		entity.Ext = metadata.Ext
+	}
+	if entity.Duration == 0 {
+		entity.Duration = metadata.Duration
+	}
+	if entity.Size == 0 {
+		if info, err := os.Stat(entity.Path); err == nil {
+			entity.Size = info.Size()
+		} else {
+			entity.Size = metadata.Size
+		}
+	}
+}
+
 // HardDelete implements domain.Service.
 func (s *Service) HardDelete(ctx context.Context, id string) (*domain.ArchiveEntry, error) {
-	res, err := s.repository.HardDelete(ctx, id)
+	model, err := s.repository.Get(ctx, id, auth.OwnerFilter(ctx))
 	if err != nil {
 		return nil, err
 	}
 
-	return &domain.ArchiveEntry{
-		Id:        res.Id,
-		Title:     res.Title,
-		Path:      res.Path,
-		Thumbnail: res.Thumbnail,
-		Source:    res.Source,
-		Metadata:  res.Metadata,
-		CreatedAt: res.CreatedAt,
-	}, nil
+	entity := toEntity(model)
+
+	// an entry whose file is already gone is just deleted
+	item, err := s.trash.Trash(ctx, model.Path, trash.KindArchive, entity)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if _, err := s.repository.SoftDelete(ctx, id, auth.OwnerFilter(ctx)); err != nil {
+		if item != nil {
+			s.trash.Restore(ctx, item.Id)
+		}
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// Archive again the entry of a file restored from the trash, unless it's
+// been archived since
+func (s *Service) restore(ctx context.Context, item *trash.Item) error {
+	var entity domain.ArchiveEntry
+
+	if err := json.Unmarshal(item.Payload, &entity); err != nil {
+		return err
+	}
+
+	exists, err := s.repository.Exists(ctx, entity.Id, "")
+	if err != nil || exists {
+		return err
+	}
+
+	entity.Path = item.OriginalPath
+	entity.Missing = false
+
+	return s.Archive(ctx, &entity)
 }
 
 // SoftDelete implements domain.Service.
 func (s *Service) SoftDelete(ctx context.Context, id string) (*domain.ArchiveEntry, error) {
-	res, err := s.repository.SoftDelete(ctx, id)
+	res, err := s.repository.SoftDelete(ctx, id, auth.OwnerFilter(ctx))
 	if err != nil {
 		return nil, err
 	}
 
-	return &domain.ArchiveEntry{
-		Id:        res.Id,
-		Title:     res.Title,
-		Path:      res.Path,
-		Thumbnail: res.Thumbnail,
-		Source:    res.Source,
-		Metadata:  res.Metadata,
-		CreatedAt: res.CreatedAt,
-	}, nil
+	return toEntity(res), nil
 }
 
 // List implements domain.Service.
 func (s *Service) List(
 	ctx context.Context,
-	startRowId int,
+	filter domain.ListFilter,
+	cursor string,
 	limit int,
 ) (*domain.PaginatedResponse[[]domain.ArchiveEntry], error) {
-	res, err := s.repository.List(ctx, startRowId, limit)
+	// non-admins only see their own entries
+	if owner := auth.OwnerFilter(ctx); owner != "" {
+		filter.Owner = owner
+	}
+
+	after, err := decodeCursor(filter.SortBy, cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	entities := make([]domain.ArchiveEntry, len(*res))
+	if filter.Tags, err = domain.NormalizeTags(filter.Tags); err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidFilter, err)
+	}
 
-	for i, model := range *res {
-		entities[i] = domain.ArchiveEntry{
-			Id:        model.Id,
-			Title:     model.Title,
-			Path:      model.Path,
-			Thumbnail: model.Thumbnail,
-			Source:    model.Source,
-			Metadata:  model.Metadata,
-			CreatedAt: model.CreatedAt,
-		}
+	// one more to know if there's a following page
+	res, err := s.repository.List(ctx, filter, after, limit+1)
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		first int64
-		next  int64
-	)
+	models := *res
 
-	if len(entities) > 0 {
-		first, err = s.repository.GetCursor(ctx, entities[0].Id)
-		if err != nil {
-			return nil, err
-		}
+	var more bool
+	if len(models) > limit {
+		models, more = models[:limit], true
+	}
 
-		next, err = s.repository.GetCursor(ctx, entities[len(entities)-1].Id)
-		if err != nil {
-			return nil, err
-		}
+	ids := make([]string, len(models))
+	for i, model := range models {
+		ids[i] = model.Id
 	}
 
-	return &domain.PaginatedResponse[[]domain.ArchiveEntry]{
-		First: first,
-		Next:  next,
-		Data:  entities,
-	}, nil
+	tags, err := s.repository.Tags(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]domain.ArchiveEntry, len(models))
+
+	for i, model := range models {
+		entities[i] = *toEntity(&model)
+		entities[i].Tags = tags[model.Id]
+	}
+
+	page := domain.PaginatedResponse[[]domain.ArchiveEntry]{
+		Data: entities,
+	}
+
+	if len(models) > 0 {
+		page.First = models[0].RowId
+		page.Next = models[len(models)-1].RowId
+	}
+
+	if more {
+		page.NextCursor = encodeCursor(filter.SortBy, &models[len(models)-1])
+	}
+
+	return &page, nil
 }
 
 // GetCursor implements domain.Service.
 func (s *Service) GetCursor(ctx context.Context, id string) (int64, error) {
 	return s.repository.GetCursor(ctx, id)
 }
+
+// A cursor of the archive order is the rowid of the entry, the others also
+// carry the sort key, which must be the one of the listing.
+type cursor struct {
+	SortBy string          `json:"s"`
+	Value  json.RawMessage `json:"v"`
+	RowId  int64           `json:"r"`
+}
+
+func encodeCursor(sortBy string, last *data.ArchiveEntry) string {
+	if sortBy == "" {
+		return strconv.FormatInt(last.RowId, 10)
+	}
+
+	var value any
+
+	switch sortBy {
+	case "created_at":
+		value = last.CreatedAt
+	case "title":
+		value = last.Title
+	case "size":
+		value = last.Size
+	}
+
+	v, _ := json.Marshal(value)
+	c, _ := json.Marshal(cursor{SortBy: sortBy, Value: v, RowId: last.RowId})
+
+	return base64.RawURLEncoding.EncodeToString(c)
+}
+
+func decodeCursor(sortBy, s string) (*domain.Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	invalid := fmt.Errorf("%w: invalid cursor", domain.ErrInvalidFilter)
+
+	if sortBy == "" {
+		rowId, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, invalid
+		}
+		return &domain.Cursor{RowId: rowId}, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.SortBy != sortBy {
+		return nil, invalid
+	}
+
+	var value any
+
+	switch sortBy {
+	case "created_at":
+		var createdAt time.Time
+		err = json.Unmarshal(c.Value, &createdAt)
+		value = createdAt
+	case "title":
+		var title string
+		err = json.Unmarshal(c.Value, &title)
+		value = title
+	case "size":
+		var size int64
+		err = json.Unmarshal(c.Value, &size)
+		value = size
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	return &domain.Cursor{RowId: c.RowId, Value: value}, nil
+}
+
+func toEntity(model *data.ArchiveEntry) *domain.ArchiveEntry {
+	entity := &domain.ArchiveEntry{
+		Id:        model.Id,
+		Title:     model.Title,
+		Path:      model.Path,
+		Thumbnail: model.Thumbnail,
+		Source:    model.Source,
+		Metadata:  model.Metadata,
+		CreatedAt: model.CreatedAt,
+		Owner:     model.Owner,
+		Extractor: model.Extractor,
+		Ext:       model.Ext,
+		Duration:  model.Duration,
+		Size:      model.Size,
+		Tags:      model.Tags,
+		Missing:   model.Missing,
+		EvictedBy: model.EvictedBy,
+	}
+
+	if model.LastWatchedAt.Valid {
+		entity.LastWatchedAt = &model.LastWatchedAt.Time
+	}
+	if model.EvictedAt.Valid {
+		entity.EvictedAt = &model.EvictedAt.Time
+	}
+
+	return entity
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/data"
+)
+
+func TestCursor(t *testing.T) {
+	last := &data.ArchiveEntry{
+		RowId:     42,
+		Title:     "a title",
+		Size:      1024,
+		CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	for sortBy, want := range map[string]any{
+		"":           nil,
+		"created_at": last.CreatedAt,
+		"title":      last.Title,
+		"size":       last.Size,
+	} {
+		c, err := decodeCursor(sortBy, encodeCursor(sortBy, last))
+		if err != nil {
+			t.Fatalf("%q: %v", sortBy, err)
+		}
+
+		if c.RowId != last.RowId {
+			t.Errorf("%q: rowid = %d", sortBy, c.RowId)
+		}
+
+		if got, ok := c.Value.(time.Time); ok {
+			if !got.Equal(want.(time.Time)) {
+				t.Errorf("%q: value = %v", sortBy, got)
+			}
+		} else if c.Value != want {
+			t.Errorf("%q: value = %v", sortBy, c.Value)
+		}
+	}
+
+	// a cursor of another order
+	if _, err := decodeCursor("size", encodeCursor("title", last)); err == nil {
+		t.Error("cursor of another order should be rejected")
+	}
+}
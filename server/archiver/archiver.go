@@ -3,11 +3,13 @@ package archiver
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"log/slog"
 
 	evbus "github.com/asaskevich/EventBus"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook"
 )
 
 const QueueName = "process:archive"
@@ -31,7 +33,21 @@ func init() {
 			slog.String("title", m.Title),
 			slog.String("source", m.Source),
 		)
-		archiveService.Archive(context.Background(), m)
+		if err := archiveService.Archive(context.Background(), m); err != nil {
+			slog.Error("failed to archive download",
+				slog.String("id", m.Id),
+				slog.String("err", err.Error()),
+			)
+			return
+		}
+
+		webhook.Publish(&webhook.Message{
+			Type:          webhook.EventArchived,
+			JobId:         m.Id,
+			ArchiveId:     m.Id,
+			Info:          json.RawMessage(m.Metadata),
+			SavedFilePath: m.Path,
+		})
 	})
 }
 
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleReadOnly = "read-only"
+)
+
+var Roles = []string{RoleAdmin, RoleUser, RoleReadOnly}
+
+// What an API token can be used for, on top of the role of its user
+const (
+	ScopeExec    = "exec"    // start and manage downloads
+	ScopeRead    = "read"    // see downloads, queue and settings
+	ScopeKill    = "kill"    // kill and clear downloads
+	ScopeFiles   = "files"   // browse, download and delete files
+	ScopeArchive = "archive" // browse and change the archive
+	ScopeAdmin   = "admin"   // admin endpoints, grants every other scope
+)
+
+var Scopes = []string{ScopeExec, ScopeRead, ScopeKill, ScopeFiles, ScopeArchive, ScopeAdmin}
+
+// Tells the API tokens apart from the JWTs issued at login and from the
+// access tokens of an OpenID provider
+const TokenPrefix = "ytdlp_"
+
+var (
+	ErrForbidden    = errors.New("not allowed for the current user")
+	ErrReadOnly     = errors.New("the current user is read-only")
+	ErrMissingScope = errors.New("the token lacks the required scope")
+)
+
+// The authenticated user performing a request
+type Principal struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// set when authenticated with an API token, nil means every scope
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type principalKey struct{}
+
+// Resolves the current state of a user given its id, so that role changes
+// and deletions apply to the tokens already issued.
+type LookupFunc func(ctx context.Context, id string) (*Principal, error)
+
+// Resolves the user an API token has been issued to, scopes included
+type TokenLookupFunc func(ctx context.Context, token string) (*Principal, error)
+
+// Resolves the user signed in with an external provider given its subject,
+// creating it the first time. The role is the one granted by the provider.
+type ProvisionFunc func(ctx context.Context, subject, username, role string) (*Principal, error)
+
+var (
+	lookup      LookupFunc
+	tokenLookup TokenLookupFunc
+	provision   ProvisionFunc
+)
+
+func SetLookup(f LookupFunc) {
+	lookup = f
+}
+
+func SetTokenLookup(f TokenLookupFunc) {
+	tokenLookup = f
+}
+
+func SetProvision(f ProvisionFunc) {
+	provision = f
+}
+
+// Load a user given its id, fails if it doesn't exist anymore
+func Lookup(ctx context.Context, id string) (*Principal, error) {
+	if lookup == nil {
+		return nil, errors.New("user accounts are not available")
+	}
+	return lookup(ctx, id)
+}
+
+// Load the user of an API token, fails if it's unknown, expired or revoked
+func LookupToken(ctx context.Context, token string) (*Principal, error) {
+	if tokenLookup == nil {
+		return nil, errors.New("API tokens are not available")
+	}
+	return tokenLookup(ctx, token)
+}
+
+// Load the user signed in with an external provider, creating it if needed
+func Provision(ctx context.Context, subject, username, role string) (*Principal, error) {
+	if provision == nil {
+		return nil, errors.New("user accounts are not available")
+	}
+	return provision(ctx, subject, username, role)
+}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// The user performing the request, nil when authentication is disabled
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Without authentication everyone is an admin
+func IsAdmin(ctx context.Context) bool {
+	p := FromContext(ctx)
+	return p == nil || p.Role == RoleAdmin
+}
+
+// The owner to record on the resources created by the request
+func Owner(ctx context.Context) string {
+	if p := FromContext(ctx); p != nil {
+		return p.Id
+	}
+	return ""
+}
+
+// The owner the resources listed by the request must be filtered by, empty
+// when every resource is visible.
+func OwnerFilter(ctx context.Context) string {
+	if IsAdmin(ctx) {
+		return ""
+	}
+	return Owner(ctx)
+}
+
+// Whether the request can see or act on a resource of the given owner
+func CanAccess(ctx context.Context, owner string) bool {
+	filter := OwnerFilter(ctx)
+	return filter == "" || filter == owner
+}
+
+func CanWrite(ctx context.Context) error {
+	if p := FromContext(ctx); p != nil && p.Role == RoleReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// Whether the request has been granted the scope. Only API tokens are
+// limited to some scopes.
+func HasScope(ctx context.Context, scope string) bool {
+	p := FromContext(ctx)
+	if p == nil || p.Scopes == nil {
+		return true
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+func RequireScope(ctx context.Context, scope string) error {
+	if !HasScope(ctx, scope) {
+		return fmt.Errorf("%w: %s", ErrMissingScope, scope)
+	}
+	return nil
+}
+
+func RequireAdmin(ctx context.Context) error {
+	if !IsAdmin(ctx) {
+		return ErrForbidden
+	}
+	return RequireScope(ctx, ScopeAdmin)
+}
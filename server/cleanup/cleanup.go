@@ -0,0 +1,55 @@
+package cleanup
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// How often the policies are evaluated when the interval isn't set
+const defaultInterval = time.Hour
+
+type Service = domain.Service
+type Policy = domain.Policy
+
+func ApplyRouter(db *sql.DB) func(chi.Router) {
+	handler, _ := Container(db)
+	return handler.ApplyRouter()
+}
+
+// Evaluate the cleanup policies at the configured interval, until ctx is
+// done
+func Schedule(ctx context.Context, db *sql.DB) {
+	interval := defaultInterval
+
+	if every := config.Instance().Cleanup.Interval; every != "" {
+		d, err := time.ParseDuration(every)
+		if err != nil || d <= 0 {
+			slog.Error("invalid cleanup interval", slog.String("interval", every))
+			return
+		}
+		interval = d
+	}
+
+	_, s := Container(db)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.Run(ctx, false, ""); err != nil {
+			slog.Error("failed to evaluate the cleanup policies", slog.String("err", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package cleanup
+
+import (
+	"database/sql"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+)
+
+func Container(db *sql.DB) (domain.RestHandler, domain.Service) {
+	var (
+		r    = provideRepository(db)
+		_, a = archive.Container(db)
+		s    = provideService(r, a)
+		h    = provideHandler(s)
+	)
+	return h, s
+}
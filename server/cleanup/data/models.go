@@ -0,0 +1,10 @@
+package data
+
+import "time"
+
+type Policy struct {
+	Id string
+	// the config.CleanupPolicy as json
+	Spec      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// What a policy evicts, see config.CleanupPolicy
+const (
+	TypeMaxAge       = "max_age"
+	TypeKeepNewest   = "keep_newest"
+	TypeMinFreeSpace = "min_free_space"
+)
+
+// How keep_newest groups the entries
+const (
+	GroupBySubscription = "subscription"
+	GroupByUploader     = "uploader"
+)
+
+// Where a policy is defined
+const (
+	SourceConfig = "config"
+	SourceAPI    = "api"
+)
+
+var (
+	ErrNotFound      = errors.New("cleanup policy not found")
+	ErrInvalidPolicy = errors.New("invalid cleanup policy")
+	ErrReadOnly      = errors.New("the policies of the config file can only be changed there")
+	ErrRunning       = errors.New("a cleanup is already running")
+)
+
+type Policy struct {
+	// config-<n> for the policies of the config file
+	Id     string `json:"id"`
+	Source string `json:"source"`
+	config.CleanupPolicy
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// A file removed, or that would be, by a policy
+type Eviction struct {
+	Policy string `json:"policy"`
+	// the archive entry of the file, unset for the files without one in a
+	// dry run
+	EntryId string `json:"entry_id,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Reason  string `json:"reason"`
+	// only reported, the run or the policy is a dry run
+	DryRun bool `json:"dry_run"`
+}
+
+type Report struct {
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt time.Time  `json:"finished_at"`
+	DryRun     bool       `json:"dry_run"`
+	Evictions  []Eviction `json:"evictions"`
+	// bytes freed, or that would be
+	Freed  int64    `json:"freed"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, model *data.Policy) error
+	Get(ctx context.Context, id string) (*data.Policy, error)
+	List(ctx context.Context) (*[]data.Policy, error)
+	Update(ctx context.Context, model *data.Policy) error
+	Delete(ctx context.Context, id string) error
+}
+
+type Service interface {
+	// the policies of the config file first, then the ones of the API
+	List(ctx context.Context) (*[]Policy, error)
+	Get(ctx context.Context, id string) (*Policy, error)
+	Create(ctx context.Context, spec config.CleanupPolicy) (*Policy, error)
+	Update(ctx context.Context, id string, spec config.CleanupPolicy) (*Policy, error)
+	Delete(ctx context.Context, id string) error
+
+	// Evaluate the policies, or only the one with the id if set, and evict
+	// what they select. Nothing is removed in a dry run. One runs at a time.
+	Run(ctx context.Context, dryRun bool, policyId string) (*Report, error)
+	// the report of the last run, nil if none ran yet
+	LastReport() *Report
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Get() http.HandlerFunc
+	Create() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Run() http.HandlerFunc
+	LastReport() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
@@ -0,0 +1,43 @@
+package cleanup
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/repository"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/rest"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/service"
+)
+
+var (
+	repo domain.Repository
+	svc  domain.Service
+	hand domain.RestHandler
+
+	repoOnce sync.Once
+	svcOnce  sync.Once
+	handOnce sync.Once
+)
+
+func provideRepository(db *sql.DB) domain.Repository {
+	repoOnce.Do(func() {
+		repo = repository.New(db)
+	})
+	return repo
+}
+
+func provideService(r domain.Repository, a archive.Service) domain.Service {
+	svcOnce.Do(func() {
+		svc = service.New(r, a)
+	})
+	return svc
+}
+
+func provideHandler(s domain.Service) domain.RestHandler {
+	handOnce.Do(func() {
+		hand = rest.New(s)
+	})
+	return hand
+}
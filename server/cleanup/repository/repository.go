@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.Policy) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO cleanup_policies (id, spec, created_at) VALUES (?, ?, ?)",
+		model.Id,
+		model.Spec,
+		model.CreatedAt,
+	)
+
+	return err
+}
+
+// Get implements domain.Repository.
+func (r *Repository) Get(ctx context.Context, id string) (*data.Policy, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	var model data.Policy
+
+	row := conn.QueryRowContext(ctx, "SELECT id, spec, created_at FROM cleanup_policies WHERE id = ?", id)
+
+	err = row.Scan(&model.Id, &model.Spec, &model.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context) (*[]data.Policy, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "SELECT id, spec, created_at FROM cleanup_policies ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	policies := []data.Policy{}
+
+	for rows.Next() {
+		var model data.Policy
+
+		if err := rows.Scan(&model.Id, &model.Spec, &model.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, model)
+	}
+
+	return &policies, rows.Err()
+}
+
+// Update implements domain.Repository.
+func (r *Repository) Update(ctx context.Context, model *data.Policy) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(ctx, "UPDATE cleanup_policies SET spec = ? WHERE id = ?", model.Spec, model.Id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete implements domain.Repository.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(ctx, "DELETE FROM cleanup_policies WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
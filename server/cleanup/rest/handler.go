@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
+
+	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+)
+
+type Handler struct {
+	service domain.Service
+}
+
+func New(service domain.Service) domain.RestHandler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// List implements domain.RestHandler.
+func (h *Handler) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Get implements domain.RestHandler.
+func (h *Handler) Get() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Create implements domain.RestHandler.
+func (h *Handler) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req config.CleanupPolicy
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.Create(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Update implements domain.RestHandler.
+func (h *Handler) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req config.CleanupPolicy
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.Update(r.Context(), chi.URLParam(r, "id"), req)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Delete implements domain.RestHandler.
+func (h *Handler) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// Run implements domain.RestHandler.
+//
+// Nothing is removed with dry_run=true, the report tells what would be.
+// Only the policy with the id is evaluated with policy=<id>.
+func (h *Handler) Run() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var dryRun bool
+
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				http.Error(w, "dry_run: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// finished even if the client goes away, the evictions are recorded
+		// as they happen
+		res, err := h.service.Run(context.WithoutCancel(r.Context()), dryRun, r.URL.Query().Get("policy"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// LastReport implements domain.RestHandler.
+func (h *Handler) LastReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res := h.service.LastReport()
+		if res == nil {
+			http.Error(w, "no cleanup ran yet", http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ApplyRouter implements domain.RestHandler.
+func (h *Handler) ApplyRouter() func(chi.Router) {
+	return func(r chi.Router) {
+		if config.Instance().RequireAuth {
+			r.Use(middlewares.Authenticated)
+		}
+		if config.Instance().UseOpenId {
+			r.Use(openid.Middleware)
+		}
+		r.Use(middlewares.RequireAdmin)
+		r.Use(middlewares.Writable)
+
+		r.Get("/policies", h.List())
+		r.Post("/policies", h.Create())
+		r.Get("/policies/{id}", h.Get())
+		r.Put("/policies/{id}", h.Update())
+		r.Delete("/policies/{id}", h.Delete())
+		r.Post("/run", h.Run())
+		r.Get("/report", h.LastReport())
+	}
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidPolicy):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrReadOnly), errors.Is(err, domain.ErrRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+
+	archive "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+// Check a policy and fill what's left to the defaults
+func normalize(spec config.CleanupPolicy) (config.CleanupPolicy, error) {
+	invalid := func(format string, a ...any) error {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidPolicy, fmt.Sprintf(format, a...))
+	}
+
+	spec.Name = strings.TrimSpace(spec.Name)
+	if spec.Name == "" {
+		spec.Name = spec.Type
+	}
+
+	if spec.Path != "" {
+		spec.Path = filepath.Clean(spec.Path)
+
+		if filepath.IsAbs(spec.Path) ||
+			spec.Path == ".." ||
+			strings.HasPrefix(spec.Path, ".."+string(filepath.Separator)) {
+			return spec, invalid("path must be relative to the download directory")
+		}
+		if spec.Path == "." {
+			spec.Path = ""
+		}
+	}
+
+	switch spec.Type {
+	case domain.TypeMaxAge:
+		if d, err := time.ParseDuration(spec.MaxAge); err != nil || d <= 0 {
+			return spec, invalid("max_age must be a duration like 720h")
+		}
+	case domain.TypeKeepNewest:
+		if spec.KeepNewest <= 0 {
+			return spec, invalid("keep_newest must be greater than 0")
+		}
+		if spec.GroupBy != domain.GroupBySubscription && spec.GroupBy != domain.GroupByUploader {
+			return spec, invalid("group_by must be %s or %s", domain.GroupBySubscription, domain.GroupByUploader)
+		}
+	case domain.TypeMinFreeSpace:
+		if size, err := internal.ParseSize(spec.MinFreeSpace); err != nil || size <= 0 {
+			return spec, invalid("min_free_space must be a size like 50G")
+		}
+	default:
+		return spec, invalid("type must be %s, %s or %s", domain.TypeMaxAge, domain.TypeKeepNewest, domain.TypeMinFreeSpace)
+	}
+
+	return spec, nil
+}
+
+// What a policy evicts among the candidates, whose paths are absolute, in
+// the order it does. free is the space left in the download directory.
+func selectEvictions(
+	spec config.CleanupPolicy,
+	root string,
+	candidates []archive.Candidate,
+	now time.Time,
+	free int64,
+) []domain.Eviction {
+	scope := filepath.Join(root, spec.Path)
+
+	candidates = slices.DeleteFunc(slices.Clone(candidates), func(c archive.Candidate) bool {
+		return !within(scope, c.Path)
+	})
+
+	var (
+		selected []archive.Candidate
+		reason   string
+	)
+
+	switch spec.Type {
+	case domain.TypeMaxAge:
+		maxAge, _ := time.ParseDuration(spec.MaxAge)
+
+		for _, c := range candidates {
+			if c.CreatedAt.Before(now.Add(-maxAge)) {
+				selected = append(selected, c)
+			}
+		}
+
+		slices.SortStableFunc(selected, func(a, b archive.Candidate) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+
+		reason = "older than " + spec.MaxAge
+
+	case domain.TypeKeepNewest:
+		groups := make(map[string][]archive.Candidate)
+		var keys []string
+
+		for _, c := range candidates {
+			key := c.Uploader
+			if spec.GroupBy == domain.GroupBySubscription {
+				key = c.Subscription
+			}
+
+			// what can't be grouped is left alone
+			if key == "" {
+				continue
+			}
+
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], c)
+		}
+
+		for _, key := range keys {
+			group := groups[key]
+
+			slices.SortStableFunc(group, func(a, b archive.Candidate) int {
+				return b.CreatedAt.Compare(a.CreatedAt)
+			})
+
+			if len(group) > spec.KeepNewest {
+				selected = append(selected, group[spec.KeepNewest:]...)
+			}
+		}
+
+		reason = fmt.Sprintf("not among the %d newest of its %s", spec.KeepNewest, spec.GroupBy)
+
+	case domain.TypeMinFreeSpace:
+		minFree, _ := internal.ParseSize(spec.MinFreeSpace)
+
+		if free >= minFree {
+			return nil
+		}
+
+		// only what's in the archive, the least recently watched first
+		candidates = slices.DeleteFunc(candidates, func(c archive.Candidate) bool {
+			return c.Id == ""
+		})
+
+		slices.SortStableFunc(candidates, func(a, b archive.Candidate) int {
+			return cmp.Compare(lastUsed(a).UnixNano(), lastUsed(b).UnixNano())
+		})
+
+		for _, c := range candidates {
+			if free >= minFree {
+				break
+			}
+			// evicting it wouldn't free anything
+			if c.Size <= 0 {
+				continue
+			}
+			selected = append(selected, c)
+			free += c.Size
+		}
+
+		reason = "free space below " + spec.MinFreeSpace
+	}
+
+	evictions := make([]domain.Eviction, len(selected))
+
+	for i, c := range selected {
+		evictions[i] = domain.Eviction{
+			EntryId: c.Id,
+			Title:   c.Title,
+			Path:    c.Path,
+			Size:    c.Size,
+			Reason:  reason,
+		}
+	}
+
+	return evictions
+}
+
+// When an entry was last watched or, if never, archived
+func lastUsed(c archive.Candidate) time.Time {
+	if c.LastWatchedAt != nil {
+		return *c.LastWatchedAt
+	}
+	return c.CreatedAt
+}
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil &&
+		rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
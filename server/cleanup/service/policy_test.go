@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+
+	archive "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+func TestNormalize(t *testing.T) {
+	spec, err := normalize(config.CleanupPolicy{Type: domain.TypeMaxAge, MaxAge: "720h", Path: "podcasts/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Name != domain.TypeMaxAge || spec.Path != "podcasts" {
+		t.Errorf("normalize() = %+v", spec)
+	}
+
+	for _, invalid := range []config.CleanupPolicy{
+		{Type: "everything"},
+		{Type: domain.TypeMaxAge, MaxAge: "30d"},
+		{Type: domain.TypeMaxAge, MaxAge: "720h", Path: "../elsewhere"},
+		{Type: domain.TypeMaxAge, MaxAge: "720h", Path: "/elsewhere"},
+		{Type: domain.TypeKeepNewest, KeepNewest: 5},
+		{Type: domain.TypeKeepNewest, GroupBy: domain.GroupByUploader},
+		{Type: domain.TypeMinFreeSpace, MinFreeSpace: "lots"},
+	} {
+		if _, err := normalize(invalid); !errors.Is(err, domain.ErrInvalidPolicy) {
+			t.Errorf("normalize(%+v) should fail", invalid)
+		}
+	}
+}
+
+func TestSelectEvictions(t *testing.T) {
+	var (
+		now     = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		day     = 24 * time.Hour
+		watched = now.Add(-time.Hour)
+	)
+
+	candidates := []archive.Candidate{
+		{Id: "a", Path: "/dl/podcasts/a.mp3", Size: 10, CreatedAt: now.Add(-40 * day), Uploader: "x"},
+		{Id: "b", Path: "/dl/podcasts/b.mp3", Size: 20, CreatedAt: now.Add(-10 * day), Uploader: "x", LastWatchedAt: &watched},
+		{Id: "c", Path: "/dl/c.mp4", Size: 30, CreatedAt: now.Add(-50 * day), Uploader: "x", Subscription: "s"},
+		{Id: "d", Path: "/dl/d.mp4", Size: 40, CreatedAt: now.Add(-5 * day), Subscription: "s"},
+		{Id: "e", Path: "/dl/e.mp4", CreatedAt: now.Add(-70 * day)},
+		{Path: "/dl/podcasts/orphan.mp3", Size: 50, CreatedAt: now.Add(-60 * day)},
+	}
+
+	paths := func(evictions []domain.Eviction) []string {
+		var paths []string
+		for _, e := range evictions {
+			paths = append(paths, e.Path)
+		}
+		return paths
+	}
+
+	for _, test := range []struct {
+		name string
+		spec config.CleanupPolicy
+		free int64
+		want []string
+	}{
+		{
+			name: "max age in a subdirectory, the oldest first",
+			spec: config.CleanupPolicy{Type: domain.TypeMaxAge, MaxAge: "720h", Path: "podcasts"},
+			want: []string{"/dl/podcasts/orphan.mp3", "/dl/podcasts/a.mp3"},
+		},
+		{
+			name: "keep the newest of each uploader",
+			spec: config.CleanupPolicy{Type: domain.TypeKeepNewest, KeepNewest: 1, GroupBy: domain.GroupByUploader},
+			want: []string{"/dl/podcasts/a.mp3", "/dl/c.mp4"},
+		},
+		{
+			name: "keep the newest of each subscription",
+			spec: config.CleanupPolicy{Type: domain.TypeKeepNewest, KeepNewest: 1, GroupBy: domain.GroupBySubscription},
+			want: []string{"/dl/c.mp4"},
+		},
+		{
+			name: "enough free space",
+			spec: config.CleanupPolicy{Type: domain.TypeMinFreeSpace, MinFreeSpace: "100"},
+			free: 100,
+		},
+		{
+			name: "least recently watched archive entries until there's enough space",
+			spec: config.CleanupPolicy{Type: domain.TypeMinFreeSpace, MinFreeSpace: "100"},
+			free: 40,
+			want: []string{"/dl/c.mp4", "/dl/podcasts/a.mp3", "/dl/d.mp4"},
+		},
+	} {
+		got := paths(selectEvictions(test.spec, "/dl", candidates, now, test.free))
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/sys"
+
+	archive "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+type Service struct {
+	repository domain.Repository
+	archive    archive.Service
+
+	// space left in the download directory, in bytes
+	freeSpace func() (uint64, error)
+
+	// held while running
+	running sync.Mutex
+	mu      sync.Mutex
+	last    *domain.Report
+}
+
+func New(repository domain.Repository, archive archive.Service) domain.Service {
+	return &Service{
+		repository: repository,
+		archive:    archive,
+		freeSpace:  sys.FreeSpace,
+	}
+}
+
+// List implements domain.Service.
+func (s *Service) List(ctx context.Context) (*[]domain.Policy, error) {
+	policies := configPolicies()
+
+	models, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, model := range *models {
+		policy, err := toEntity(&model)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *policy)
+	}
+
+	return &policies, nil
+}
+
+// Get implements domain.Service.
+func (s *Service) Get(ctx context.Context, id string) (*domain.Policy, error) {
+	if strings.HasPrefix(id, domain.SourceConfig+"-") {
+		for _, policy := range configPolicies() {
+			if policy.Id == id {
+				return &policy, nil
+			}
+		}
+		return nil, domain.ErrNotFound
+	}
+
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(model)
+}
+
+// Create implements domain.Service.
+func (s *Service) Create(ctx context.Context, spec config.CleanupPolicy) (*domain.Policy, error) {
+	spec, err := normalize(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	model := &data.Policy{
+		Id:        uuid.NewString(),
+		Spec:      string(raw),
+		CreatedAt: time.Now().Round(0).Local(),
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		return nil, err
+	}
+
+	return toEntity(model)
+}
+
+// Update implements domain.Service.
+func (s *Service) Update(ctx context.Context, id string, spec config.CleanupPolicy) (*domain.Policy, error) {
+	if strings.HasPrefix(id, domain.SourceConfig+"-") {
+		return nil, domain.ErrReadOnly
+	}
+
+	spec, err := normalize(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.Update(ctx, &data.Policy{Id: id, Spec: string(raw)}); err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, id)
+}
+
+// Delete implements domain.Service.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if strings.HasPrefix(id, domain.SourceConfig+"-") {
+		return domain.ErrReadOnly
+	}
+
+	return s.repository.Delete(ctx, id)
+}
+
+// Run implements domain.Service.
+func (s *Service) Run(ctx context.Context, dryRun bool, policyId string) (*domain.Report, error) {
+	if !s.running.TryLock() {
+		return nil, domain.ErrRunning
+	}
+	defer s.running.Unlock()
+
+	policies, err := s.policies(ctx, policyId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.Report{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Evictions: []domain.Eviction{},
+	}
+
+	if len(policies) > 0 {
+		if err := s.run(ctx, policies, report); err != nil {
+			return nil, err
+		}
+	}
+
+	report.FinishedAt = time.Now()
+
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+
+	if len(report.Evictions) > 0 || len(report.Errors) > 0 {
+		slog.Info(
+			"cleanup policies evaluated",
+			slog.Bool("dry_run", dryRun),
+			slog.Int("evictions", len(report.Evictions)),
+			slog.Int64("freed", report.Freed),
+			slog.Int("errors", len(report.Errors)),
+		)
+	}
+
+	return report, nil
+}
+
+// LastReport implements domain.Service.
+func (s *Service) LastReport() *domain.Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// The policies to evaluate, the config ones are checked as they're only
+// read from the file
+func (s *Service) policies(ctx context.Context, id string) ([]domain.Policy, error) {
+	if id != "" {
+		policy, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return []domain.Policy{*policy}, nil
+	}
+
+	policies, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return *policies, nil
+}
+
+func (s *Service) run(ctx context.Context, policies []domain.Policy, report *domain.Report) error {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return err
+	}
+
+	// with the download directory unmounted nothing can be evaluated
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("download directory %s is not available", root)
+	}
+
+	candidates, err := s.candidates(ctx, report)
+	if err != nil {
+		return err
+	}
+
+	// a file is evicted once, by the first policy selecting it
+	evicted := make(map[string]bool)
+
+	for _, policy := range policies {
+		spec, err := normalize(policy.CleanupPolicy)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", policy.Id, err.Error()))
+			continue
+		}
+
+		var free int64
+		if spec.Type == domain.TypeMinFreeSpace {
+			space, err := s.freeSpace()
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", policy.Id, err.Error()))
+				continue
+			}
+
+			// in a dry run nothing was actually freed by the previous policies
+			free = int64(space)
+			if report.DryRun {
+				free += report.Freed
+			}
+		}
+
+		var remaining []archive.Candidate
+		for _, c := range candidates {
+			if !evicted[c.Path] {
+				remaining = append(remaining, c)
+			}
+		}
+
+		for _, eviction := range selectEvictions(spec, root, remaining, time.Now(), free) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			eviction.Policy = policy.Id
+			eviction.DryRun = report.DryRun || spec.DryRun
+
+			if !eviction.DryRun {
+				entity, err := s.archive.Evict(ctx, eviction.EntryId, eviction.Path, spec.Name)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", eviction.Path, err.Error()))
+					continue
+				}
+				eviction.EntryId = entity.Id
+				eviction.Title = entity.Title
+			}
+
+			evicted[eviction.Path] = true
+
+			report.Evictions = append(report.Evictions, eviction)
+			report.Freed += eviction.Size
+		}
+	}
+
+	return nil
+}
+
+// The archive entries whose file is still there and the media files of the
+// download directory without one, with absolute paths
+func (s *Service) candidates(ctx context.Context, report *domain.Report) ([]archive.Candidate, error) {
+	entries, err := s.archive.Candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		candidates []archive.Candidate
+		known      = make(map[string]bool, len(*entries))
+	)
+
+	for _, c := range *entries {
+		path, err := filepath.Abs(c.Path)
+		if err != nil {
+			continue
+		}
+
+		known[path] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		// the size recorded when it was archived might be missing or stale
+		c.Path = path
+		c.Size = info.Size()
+		candidates = append(candidates, c)
+	}
+
+	orphans, err := s.archive.Orphans(ctx, known)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Errors = append(report.Errors, orphans.Errors...)
+
+	for _, orphan := range orphans.Files {
+		name := orphan.Info.Name()
+
+		candidates = append(candidates, archive.Candidate{
+			Title:     strings.TrimSuffix(name, filepath.Ext(name)),
+			Path:      orphan.Path,
+			Size:      orphan.Info.Size(),
+			CreatedAt: orphan.Info.ModTime(),
+		})
+	}
+
+	return candidates, nil
+}
+
+// The policies of the config file, numbered in their order
+func configPolicies() []domain.Policy {
+	specs := config.Instance().Cleanup.Policies
+
+	policies := make([]domain.Policy, len(specs))
+
+	for i, spec := range specs {
+		if spec.Name == "" {
+			spec.Name = spec.Type
+		}
+
+		policies[i] = domain.Policy{
+			Id:            domain.SourceConfig + "-" + strconv.Itoa(i+1),
+			Source:        domain.SourceConfig,
+			CleanupPolicy: spec,
+		}
+	}
+
+	return policies
+}
+
+func toEntity(model *data.Policy) (*domain.Policy, error) {
+	policy := &domain.Policy{
+		Id:        model.Id,
+		Source:    domain.SourceAPI,
+		CreatedAt: &model.CreatedAt,
+	}
+
+	if err := json.Unmarshal([]byte(model.Spec), &policy.CleanupPolicy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/dbutil"
+)
+
+const commandUsage = `usage:
+  archive export [-format tar|zip] [-media] [-thumbnails] [-info] [-filter query] <bundle|->
+  archive import <bundle>
+  archive reconcile [-dry-run]`
+
+// Run a maintenance command instead of the server, against the configured
+// database and download path.
+func RunCommand(args []string) error {
+	if len(args) < 2 || args[0] != "archive" {
+		return errors.New(commandUsage)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if err := dbutil.Migrate(ctx, db); err != nil {
+		return err
+	}
+
+	_, svc := archive.Container(db)
+
+	switch args[1] {
+	case "export":
+		return exportCommand(ctx, svc, args[2:])
+	case "import":
+		return importCommand(ctx, svc, args[2:])
+	case "reconcile":
+		return reconcileCommand(ctx, svc, args[2:])
+	default:
+		return errors.New(commandUsage)
+	}
+}
+
+func exportCommand(ctx context.Context, svc domain.Service, args []string) error {
+	var (
+		fs     = flag.NewFlagSet("archive export", flag.ContinueOnError)
+		opts   domain.ExportOptions
+		filter string
+	)
+
+	fs.StringVar(&opts.Format, "format", "tar", "bundle format, tar or zip")
+	fs.BoolVar(&opts.Media, "media", false, "include the downloaded files")
+	fs.BoolVar(&opts.Thumbnails, "thumbnails", false, "include the thumbnails")
+	fs.BoolVar(&opts.Info, "info", false, "include the info json files")
+	fs.StringVar(&filter, "filter", "", "entries to export, as the query of GET /archive (e.g. \"q=talk&tag=music\")")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(commandUsage)
+	}
+
+	f, err := archive.ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+
+	if path := fs.Arg(0); path != "-" {
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		if err := svc.Export(ctx, out, f, opts); err != nil {
+			os.Remove(path)
+			return err
+		}
+		return out.Close()
+	}
+
+	return svc.Export(ctx, os.Stdout, f, opts)
+}
+
+func importCommand(ctx context.Context, svc domain.Service, args []string) error {
+	if len(args) != 1 {
+		return errors.New(commandUsage)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	report, err := svc.Import(ctx, f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+func reconcileCommand(ctx context.Context, svc domain.Service, args []string) error {
+	var (
+		fs     = flag.NewFlagSet("archive reconcile", flag.ContinueOnError)
+		dryRun = fs.Bool("dry-run", false, "only report what would change")
+	)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := svc.Reconcile(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+func printReport(report any) error {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(out))
+	return nil
+}
@@ -9,27 +9,134 @@ import (
 )
 
 type Config struct {
-	LogPath            string `yaml:"log_path"`
-	EnableFileLogging  bool   `yaml:"enable_file_logging"`
-	BaseURL            string `yaml:"base_url"`
-	Host               string `yaml:"host"`
-	Port               int    `yaml:"port"`
-	DownloadPath       string `yaml:"downloadPath"`
-	DownloaderPath     string `yaml:"downloaderPath"`
-	RequireAuth        bool   `yaml:"require_auth"`
-	Username           string `yaml:"username"`
-	Password           string `yaml:"password"`
-	QueueSize          int    `yaml:"queue_size"`
-	LocalDatabasePath  string `yaml:"local_database_path"`
-	SessionFilePath    string `yaml:"session_file_path"`
-	path               string // private
-	UseOpenId          bool   `yaml:"use_openid"`
-	OpenIdProviderURL  string `yaml:"openid_provider_url"`
-	OpenIdClientId     string `yaml:"openid_client_id"`
-	OpenIdClientSecret string `yaml:"openid_client_secret"`
-	OpenIdRedirectURL  string `yaml:"openid_redirect_url"`
-	FrontendPath       string `yaml:"frontend_path"`
-	AutoArchive        bool   `yaml:"auto_archive"`
+	LogPath            string      `yaml:"log_path"`
+	EnableFileLogging  bool        `yaml:"enable_file_logging"`
+	BaseURL            string      `yaml:"base_url"`
+	Host               string      `yaml:"host"`
+	Port               int         `yaml:"port"`
+	DownloadPath       string      `yaml:"downloadPath"`
+	DownloaderPath     string      `yaml:"downloaderPath"`
+	RequireAuth        bool        `yaml:"require_auth"`
+	Username           string      `yaml:"username"`
+	Password           string      `yaml:"password"`
+	QueueSize          int         `yaml:"queue_size"`
+	LocalDatabasePath  string      `yaml:"local_database_path"`
+	SessionFilePath    string      `yaml:"session_file_path"`
+	path               string      // private
+	UseOpenId          bool        `yaml:"use_openid"`
+	OpenIdProviderURL  string      `yaml:"openid_provider_url"`
+	OpenIdClientId     string      `yaml:"openid_client_id"`
+	OpenIdClientSecret string      `yaml:"openid_client_secret"`
+	OpenIdRedirectURL  string      `yaml:"openid_redirect_url"`
+	FrontendPath       string      `yaml:"frontend_path"`
+	AutoArchive        bool        `yaml:"auto_archive"`
+	Retry              RetryPolicy `yaml:"retry"`
+	BandwidthLimit     string      `yaml:"bandwidth_limit"`
+	DownloadWindows    []string    `yaml:"download_windows"`
+	GRPCPort           int         `yaml:"grpc_port"`
+	Validation         Validation  `yaml:"validation"`
+	Quota              Quota       `yaml:"quota"`
+	Reconcile          Reconcile   `yaml:"reconcile"`
+	Trash              Trash       `yaml:"trash"`
+	Cleanup            Cleanup     `yaml:"cleanup"`
+
+	// how the OpenID users are authorized, see OpenIdRule
+	OpenIdRules          []OpenIdRule `yaml:"openid_rules"`
+	OpenIdDefaultRole    string       `yaml:"openid_default_role"` // when no rule matches, see OpenIdRule
+	OpenIdAllowedDomains []string     `yaml:"openid_allowed_domains"`
+}
+
+// Default limits of the non-admin users, zero values mean unlimited.
+// Sizes are written like bandwidth_limit, e.g. "500M" or "20G".
+type Quota struct {
+	MaxConcurrent  int    `yaml:"max_concurrent"`    // jobs downloading at once
+	MaxQueued      int    `yaml:"max_queued"`        // jobs waiting, scheduled, paused or retrying
+	MaxBytesPerDay string `yaml:"max_bytes_per_day"` // downloaded in the last 24 hours
+	DiskQuota      string `yaml:"disk_quota"`        // downloaded files still on disk
+}
+
+// How the archive is reconciled with the download directory
+type Reconcile struct {
+	Interval    string `yaml:"interval"`     // e.g. "24h", empty to only run it on demand
+	FFprobePath string `yaml:"ffprobe_path"` // default: ffprobe
+}
+
+// The recycle bin deleted files are moved to
+type Trash struct {
+	Retention string `yaml:"retention"` // e.g. "168h", default: 720h (30 days), "0" keeps them until emptied
+}
+
+// The policies removing downloaded media, evaluated at the interval
+type Cleanup struct {
+	Interval string          `yaml:"interval"` // default: 1h
+	Policies []CleanupPolicy `yaml:"policies"`
+}
+
+// One of:
+//   - max_age: the files in path older than max_age
+//   - keep_newest: all but the keep_newest newest entries of each
+//     subscription or uploader, see group_by
+//   - min_free_space: the least recently watched archive entries, while the
+//     free space is below min_free_space
+type CleanupPolicy struct {
+	Name         string `yaml:"name" json:"name"`
+	Type         string `yaml:"type" json:"type"`
+	Path         string `yaml:"path" json:"path"`                     // relative to the download directory, all of it if empty
+	MaxAge       string `yaml:"max_age" json:"max_age"`               // e.g. "720h"
+	KeepNewest   int    `yaml:"keep_newest" json:"keep_newest"`       // entries kept in each group
+	GroupBy      string `yaml:"group_by" json:"group_by"`             // subscription or uploader
+	MinFreeSpace string `yaml:"min_free_space" json:"min_free_space"` // e.g. "50G"
+	DryRun       bool   `yaml:"dry_run" json:"dry_run"`               // only report what would be removed
+}
+
+// Gives a role to the OpenID users with a claim matching the value: equal to
+// it or, for list claims, containing it. Nested claims are written with dots,
+// e.g. "realm_access.roles". The first matching rule applies, otherwise the
+// default role. Without a default role the users matching no rule are
+// denied, unless there are no rules at all: then everyone is an admin.
+type OpenIdRule struct {
+	Claim string `yaml:"claim"`
+	Value string `yaml:"value"`
+	Role  string `yaml:"role"`
+}
+
+// Limits what a download request can ask for
+type Validation struct {
+	AllowedSchemes []string `yaml:"allowed_schemes"` // default: http and https
+	AllowedHosts   []string `yaml:"allowed_hosts"`   // subdomains included, empty allows any host
+	DeniedHosts    []string `yaml:"denied_hosts"`    // subdomains included
+	DeniedParams   []string `yaml:"denied_params"`   // yt-dlp flags denied besides the builtin ones
+	AllowedParams  []string `yaml:"allowed_params"`  // builtin denied flags allowed anyway
+}
+
+// Defines if and how failed downloads are retried.
+// Zero values mean "not set" and are inherited when merging policies.
+type RetryPolicy struct {
+	MaxAttempts int      `yaml:"max_attempts" json:"max_attempts"` // including the first one
+	BaseBackoff string   `yaml:"base_backoff" json:"base_backoff"` // e.g. "30s", doubled at each attempt
+	Jitter      float64  `yaml:"jitter" json:"jitter"`             // fraction of the backoff, 0 to 1
+	RetryOn     []string `yaml:"retry_on" json:"retry_on"`         // error classes worth retrying
+}
+
+// Returns a copy of the policy with the fields set in override replacing
+// the current ones.
+func (r RetryPolicy) Merge(override *RetryPolicy) RetryPolicy {
+	if override == nil {
+		return r
+	}
+	if override.MaxAttempts > 0 {
+		r.MaxAttempts = override.MaxAttempts
+	}
+	if override.BaseBackoff != "" {
+		r.BaseBackoff = override.BaseBackoff
+	}
+	if override.Jitter > 0 {
+		r.Jitter = override.Jitter
+	}
+	if override.RetryOn != nil {
+		r.RetryOn = override.RetryOn
+	}
+	return r
 }
 
 var (
@@ -3,6 +3,7 @@ package dbutil
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -49,6 +50,297 @@ func Migrate(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id CHAR(36) PRIMARY KEY,
+			url TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			data TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			id CHAR(36) PRIMARY KEY,
+			url TEXT NOT NULL,
+			template TEXT NOT NULL,
+			path TEXT NOT NULL,
+			start_date VARCHAR(10) NOT NULL,
+			interval VARCHAR(32) NOT NULL,
+			last_polled DATETIME,
+			created_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS subscription_entries (
+			subscription_id CHAR(36) NOT NULL,
+			entry_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			seen_at DATETIME,
+			PRIMARY KEY (subscription_id, entry_id)
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS download_index (
+			extractor VARCHAR(255) NOT NULL,
+			video_id VARCHAR(255) NOT NULL,
+			url TEXT NOT NULL,
+			title TEXT NOT NULL,
+			created_at DATETIME,
+			PRIMARY KEY (extractor, video_id)
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id CHAR(36) PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			created_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id CHAR(36) PRIMARY KEY,
+			webhook_id CHAR(36) NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			payload TEXT NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			attempts INTEGER NOT NULL,
+			response_code INTEGER NOT NULL,
+			error TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS users (
+			id CHAR(36) PRIMARY KEY,
+			username VARCHAR(64) NOT NULL UNIQUE COLLATE NOCASE,
+			password_hash TEXT NOT NULL,
+			role VARCHAR(16) NOT NULL,
+			created_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id CHAR(36) PRIMARY KEY,
+			user_id CHAR(36) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			created_at DATETIME
+		)`,
+	); err != nil {
+		return err
+	}
+
+	// limits of a user replacing the configured ones
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS quotas (
+			user_id CHAR(36) PRIMARY KEY,
+			max_concurrent INTEGER NOT NULL DEFAULT 0,
+			max_queued INTEGER NOT NULL DEFAULT 0,
+			max_bytes_per_day INTEGER NOT NULL DEFAULT 0,
+			disk_quota INTEGER NOT NULL DEFAULT 0
+		)`,
+	); err != nil {
+		return err
+	}
+
+	// files downloaded on behalf of a user, counted against its quota
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS quota_usage (
+			owner CHAR(36) NOT NULL,
+			path TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+	); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		"CREATE INDEX IF NOT EXISTS quota_usage_owner ON quota_usage (owner, created_at)",
+	); err != nil {
+		return err
+	}
+
+	// id of the user who created them, empty for the ones created before the
+	// user accounts
+	if err := addColumn(ctx, db, "templates", "owner", "CHAR(36) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if err := addColumn(ctx, db, "archive", "owner", "CHAR(36) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// OpenID subject of the users signed in through the provider
+	if err := addColumn(ctx, db, "users", "subject", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(
+		ctx,
+		"CREATE UNIQUE INDEX IF NOT EXISTS users_subject ON users (subject) WHERE subject != ''",
+	); err != nil {
+		return err
+	}
+
+	// refresh tokens of the OpenID sessions, by the hash of the session id
+	if _, err := db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS openid_sessions (
+			id_hash CHAR(64) PRIMARY KEY,
+			refresh_token TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+	); err != nil {
+		return err
+	}
+
+	// what the archive is filtered and sorted by, taken from the metadata
+	for _, column := range [][2]string{
+		{"extractor", "VARCHAR(255) NOT NULL DEFAULT ''"},
+		{"ext", "VARCHAR(16) NOT NULL DEFAULT ''"},
+		{"duration", "REAL NOT NULL DEFAULT 0"},
+		{"size", "INTEGER NOT NULL DEFAULT 0"},
+		// the file is gone, found by a reconciliation
+		{"missing", "BOOLEAN NOT NULL DEFAULT 0"},
+		// when the file was last streamed or downloaded from the file browser
+		{"last_watched_at", "DATETIME"},
+		// the file was removed by a cleanup policy
+		{"evicted_at", "DATETIME"},
+		{"evicted_by", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumn(ctx, db, "archive", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range []string{
+		"CREATE INDEX IF NOT EXISTS archive_created_at ON archive (created_at)",
+		"CREATE INDEX IF NOT EXISTS archive_title ON archive (title COLLATE NOCASE)",
+		"CREATE INDEX IF NOT EXISTS archive_size ON archive (size)",
+		"CREATE INDEX IF NOT EXISTS archive_extractor ON archive (extractor COLLATE NOCASE)",
+		"CREATE INDEX IF NOT EXISTS archive_path ON archive (path)",
+		// the subscription an archived entry was downloaded by
+		"CREATE INDEX IF NOT EXISTS subscription_entries_url ON subscription_entries (url)",
+	} {
+		if _, err := db.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+
+	if err := migrateArchiveSearch(ctx, db); err != nil {
+		return err
+	}
+
+	// tags, collections and notes of the archive entries
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS archive_tags (
+			entry_id CHAR(36) NOT NULL,
+			tag VARCHAR(64) NOT NULL,
+			PRIMARY KEY (entry_id, tag)
+		)`,
+		"CREATE INDEX IF NOT EXISTS archive_tags_tag ON archive_tags (tag)",
+		`CREATE TABLE IF NOT EXISTS collections (
+			id CHAR(36) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			owner CHAR(36) NOT NULL DEFAULT '',
+			created_at DATETIME,
+			UNIQUE (owner, name COLLATE NOCASE)
+		)`,
+		`CREATE TABLE IF NOT EXISTS collection_entries (
+			collection_id CHAR(36) NOT NULL,
+			entry_id CHAR(36) NOT NULL,
+			added_at DATETIME,
+			PRIMARY KEY (collection_id, entry_id)
+		)`,
+		"CREATE INDEX IF NOT EXISTS collection_entries_entry ON collection_entries (entry_id)",
+		`CREATE TABLE IF NOT EXISTS archive_notes (
+			id CHAR(36) PRIMARY KEY,
+			entry_id CHAR(36) NOT NULL,
+			author CHAR(36) NOT NULL DEFAULT '',
+			content TEXT NOT NULL,
+			created_at DATETIME,
+			updated_at DATETIME
+		)`,
+		"CREATE INDEX IF NOT EXISTS archive_notes_entry ON archive_notes (entry_id)",
+		`CREATE TRIGGER IF NOT EXISTS archive_annotations_delete AFTER DELETE ON archive BEGIN
+			DELETE FROM archive_tags WHERE entry_id = old.id;
+			DELETE FROM collection_entries WHERE entry_id = old.id;
+			DELETE FROM archive_notes WHERE entry_id = old.id;
+		END`,
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	// files deleted into the recycle bin, kept under .trash/<id>
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS trash (
+			id CHAR(36) PRIMARY KEY,
+			original_path TEXT NOT NULL,
+			size INTEGER NOT NULL DEFAULT 0,
+			is_dir BOOLEAN NOT NULL DEFAULT 0,
+			kind VARCHAR(32) NOT NULL,
+			payload TEXT NOT NULL DEFAULT '',
+			deleted_by CHAR(36) NOT NULL DEFAULT '',
+			deleted_at DATETIME NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS trash_deleted_at ON trash (deleted_at)",
+		// the cleanup policies created through the API, the spec is json
+		`CREATE TABLE IF NOT EXISTS cleanup_policies (
+			id CHAR(36) PRIMARY KEY,
+			spec TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
 	if lockFileExists() {
 		return nil
 	}
@@ -65,6 +357,88 @@ func Migrate(ctx context.Context, db *sql.DB) error {
 	return nil
 }
 
+// Full text index of the archive, kept in sync by triggers. The entries
+// archived by a previous version are indexed when it's created.
+func migrateArchiveSearch(ctx context.Context, db *sql.DB) error {
+	var count int
+
+	err := db.
+		QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'archive_fts'").
+		Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// metadata written by other clients may not be valid json
+	metadata := func(row, path string) string {
+		return fmt.Sprintf("CASE WHEN json_valid(%[1]s.metadata) THEN json_extract(%[1]s.metadata, '%[2]s') END", row, path)
+	}
+
+	for _, statement := range []string{
+		`CREATE VIRTUAL TABLE archive_fts USING fts5 (
+			id UNINDEXED,
+			title,
+			source,
+			uploader,
+			description,
+			tokenize = 'unicode61 remove_diacritics 2'
+		)`,
+		`CREATE TRIGGER archive_fts_insert AFTER INSERT ON archive BEGIN
+			INSERT INTO archive_fts (id, title, source, uploader, description)
+			VALUES (new.id, new.title, new.source, ` + metadata("new", "$.uploader") + `, ` + metadata("new", "$.description") + `);
+		END`,
+		`CREATE TRIGGER archive_fts_delete AFTER DELETE ON archive BEGIN
+			DELETE FROM archive_fts WHERE id = old.id;
+		END`,
+		`CREATE TRIGGER archive_fts_update AFTER UPDATE OF title, source, metadata ON archive BEGIN
+			UPDATE archive_fts SET
+				title = new.title,
+				source = new.source,
+				uploader = ` + metadata("new", "$.uploader") + `,
+				description = ` + metadata("new", "$.description") + `
+			WHERE id = old.id;
+		END`,
+		`INSERT INTO archive_fts (id, title, source, uploader, description)
+			SELECT id, title, source, ` + metadata("archive", "$.uploader") + `, ` + metadata("archive", "$.description") + `
+			FROM archive`,
+		`UPDATE archive SET
+			extractor = COALESCE(` + metadata("archive", "$.extractor_key") + `, ''),
+			ext = COALESCE(` + metadata("archive", "$.ext") + `, ''),
+			duration = COALESCE(` + metadata("archive", "$.duration") + `, 0),
+			size = COALESCE(` + metadata("archive", "$.filesize_approx") + `, 0)`,
+		// times are stored as text, the monotonic clock reading breaks their order
+		`UPDATE archive SET created_at = substr(created_at, 1, instr(created_at, ' m=') - 1)
+			WHERE instr(created_at, ' m=') > 0`,
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Add a column to a table created by a previous version, if it's missing
+func addColumn(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	var count int
+
+	err := db.
+		QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).
+		Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func createLockFile() { os.Create(lockFilePath) }
 
 func lockFileExists() bool {
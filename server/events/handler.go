@@ -0,0 +1,143 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+	ReadBufferSize:  1000,
+	WriteBufferSize: 1000,
+}
+
+// The events are filtered by the "id" query parameters, if any.
+// A client resumes from the "cursor" query parameter or, for SSE, from the
+// Last-Event-ID header its EventSource sends when reconnecting.
+// Non-admins only get the events of their own jobs.
+func subscribe(hub *internal.EventHub, r *http.Request) (<-chan internal.Event, func()) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+
+	return hub.Subscribe(cursor, r.URL.Query()["id"], auth.OwnerFilter(r.Context()))
+}
+
+func webSocket(hub *internal.EventHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		defer c.Close()
+
+		events, unsubscribe := subscribe(hub, r)
+		defer unsubscribe()
+
+		// the client isn't expected to send anything: reading is only needed
+		// to notice it went away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := c.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-closed:
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := c.WriteJSON(e); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func sse(hub *internal.EventHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "SSE not supported", http.StatusInternalServerError)
+			return
+		}
+
+		events, unsubscribe := subscribe(hub, r)
+		defer unsubscribe()
+
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-events:
+				// dropped for being too slow, the client will reconnect
+				if !ok {
+					return
+				}
+
+				var b bytes.Buffer
+
+				b.WriteString("id: " + e.Cursor + "\n")
+				b.WriteString("event: " + e.Type + "\n")
+				b.WriteString("data: ")
+
+				if err := json.NewEncoder(&b).Encode(e); err != nil {
+					return
+				}
+
+				b.WriteRune('\n')
+
+				if _, err := io.Copy(w, &b); err != nil {
+					return
+				}
+
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func ApplyRouter(hub *internal.EventHub) func(chi.Router) {
+	return func(r chi.Router) {
+		if config.Instance().RequireAuth {
+			r.Use(middlewares.Authenticated)
+		}
+		if config.Instance().UseOpenId {
+			r.Use(openid.Middleware)
+		}
+		r.Use(middlewares.RequireScope(auth.ScopeRead))
+		r.Get("/ws", webSocket(hub))
+		r.Get("/sse", sse(hub))
+	}
+}
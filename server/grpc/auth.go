@@ -0,0 +1,95 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Same credentials of the HTTP API, sent as metadata: the JWT as
+// "x-authentication" or an API token as "authorization: Bearer <token>", and
+// the OpenID token as "oid-token" or an access token of the provider as
+// "authorization: Bearer <token>".
+// The returned context carries the authenticated user, if any.
+func authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if config.Instance().RequireAuth {
+		var (
+			principal *auth.Principal
+			err       error
+		)
+
+		if bearer, ok := middlewares.BearerToken(get("authorization")); ok {
+			principal, err = auth.LookupToken(ctx, bearer)
+		} else {
+			principal, err = middlewares.ValidateToken(ctx, get("x-authentication"))
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+
+	if config.Instance().UseOpenId {
+		principal, err := openid.Authenticate(ctx, get("oid-token"), get("authorization"))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if auth.FromContext(ctx) == nil {
+			ctx = auth.WithPrincipal(ctx, principal)
+		}
+	}
+
+	return ctx, nil
+}
+
+// A server stream carrying the context of the authenticated user
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func unaryAuth(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, err := authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func streamAuth(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ss, ctx})
+}
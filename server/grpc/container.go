@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/grpc/pb"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// Dependency injection container.
+func Container(db *internal.MemoryDB, mq *internal.MessageQueue) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryAuth),
+		grpc.StreamInterceptor(streamAuth),
+	)
+
+	pb.RegisterYtdlpServer(srv, &Service{
+		db: db,
+		mq: mq,
+	})
+
+	return srv
+}
+
+// Serve the gRPC requests (HTTP/2 with the application/grpc content type)
+// with the gRPC server and everything else with the given handler, so both
+// can share the same listener. HTTP/2 without TLS is accepted as well.
+func Multiplex(srv *grpc.Server, next http.Handler) http.Handler {
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			srv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
@@ -0,0 +1,318 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.2
+// source: yt-dlp.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ytdlp_Exec_FullMethodName         = "/Ytdlp/Exec"
+	Ytdlp_ExecPlaylist_FullMethodName = "/Ytdlp/ExecPlaylist"
+	Ytdlp_Progress_FullMethodName     = "/Ytdlp/Progress"
+	Ytdlp_Running_FullMethodName      = "/Ytdlp/Running"
+	Ytdlp_Kill_FullMethodName         = "/Ytdlp/Kill"
+	Ytdlp_KillAll_FullMethodName      = "/Ytdlp/KillAll"
+)
+
+// YtdlpClient is the client API for Ytdlp service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type YtdlpClient interface {
+	Exec(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*ExecResponse, error)
+	ExecPlaylist(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*ExecResponse, error)
+	Progress(ctx context.Context, in *BaseRequest, opts ...grpc.CallOption) (*DownloadProgress, error)
+	Running(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProcessResponse], error)
+	Kill(ctx context.Context, in *BaseRequest, opts ...grpc.CallOption) (*ExecResponse, error)
+	KillAll(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecResponse], error)
+}
+
+type ytdlpClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewYtdlpClient(cc grpc.ClientConnInterface) YtdlpClient {
+	return &ytdlpClient{cc}
+}
+
+func (c *ytdlpClient) Exec(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*ExecResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecResponse)
+	err := c.cc.Invoke(ctx, Ytdlp_Exec_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ytdlpClient) ExecPlaylist(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*ExecResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecResponse)
+	err := c.cc.Invoke(ctx, Ytdlp_ExecPlaylist_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ytdlpClient) Progress(ctx context.Context, in *BaseRequest, opts ...grpc.CallOption) (*DownloadProgress, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DownloadProgress)
+	err := c.cc.Invoke(ctx, Ytdlp_Progress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ytdlpClient) Running(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProcessResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ytdlp_ServiceDesc.Streams[0], Ytdlp_Running_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Empty, ProcessResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ytdlp_RunningClient = grpc.ServerStreamingClient[ProcessResponse]
+
+func (c *ytdlpClient) Kill(ctx context.Context, in *BaseRequest, opts ...grpc.CallOption) (*ExecResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecResponse)
+	err := c.cc.Invoke(ctx, Ytdlp_Kill_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ytdlpClient) KillAll(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExecResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ytdlp_ServiceDesc.Streams[1], Ytdlp_KillAll_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Empty, ExecResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ytdlp_KillAllClient = grpc.ServerStreamingClient[ExecResponse]
+
+// YtdlpServer is the server API for Ytdlp service.
+// All implementations must embed UnimplementedYtdlpServer
+// for forward compatibility.
+type YtdlpServer interface {
+	Exec(context.Context, *DownloadRequest) (*ExecResponse, error)
+	ExecPlaylist(context.Context, *DownloadRequest) (*ExecResponse, error)
+	Progress(context.Context, *BaseRequest) (*DownloadProgress, error)
+	Running(*Empty, grpc.ServerStreamingServer[ProcessResponse]) error
+	Kill(context.Context, *BaseRequest) (*ExecResponse, error)
+	KillAll(*Empty, grpc.ServerStreamingServer[ExecResponse]) error
+	mustEmbedUnimplementedYtdlpServer()
+}
+
+// UnimplementedYtdlpServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedYtdlpServer struct{}
+
+func (UnimplementedYtdlpServer) Exec(context.Context, *DownloadRequest) (*ExecResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exec not implemented")
+}
+func (UnimplementedYtdlpServer) ExecPlaylist(context.Context, *DownloadRequest) (*ExecResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecPlaylist not implemented")
+}
+func (UnimplementedYtdlpServer) Progress(context.Context, *BaseRequest) (*DownloadProgress, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Progress not implemented")
+}
+func (UnimplementedYtdlpServer) Running(*Empty, grpc.ServerStreamingServer[ProcessResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Running not implemented")
+}
+func (UnimplementedYtdlpServer) Kill(context.Context, *BaseRequest) (*ExecResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Kill not implemented")
+}
+func (UnimplementedYtdlpServer) KillAll(*Empty, grpc.ServerStreamingServer[ExecResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method KillAll not implemented")
+}
+func (UnimplementedYtdlpServer) mustEmbedUnimplementedYtdlpServer() {}
+func (UnimplementedYtdlpServer) testEmbeddedByValue()               {}
+
+// UnsafeYtdlpServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to YtdlpServer will
+// result in compilation errors.
+type UnsafeYtdlpServer interface {
+	mustEmbedUnimplementedYtdlpServer()
+}
+
+func RegisterYtdlpServer(s grpc.ServiceRegistrar, srv YtdlpServer) {
+	// If the following call pancis, it indicates UnimplementedYtdlpServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ytdlp_ServiceDesc, srv)
+}
+
+func _Ytdlp_Exec_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DownloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YtdlpServer).Exec(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ytdlp_Exec_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YtdlpServer).Exec(ctx, req.(*DownloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ytdlp_ExecPlaylist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DownloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YtdlpServer).ExecPlaylist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ytdlp_ExecPlaylist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YtdlpServer).ExecPlaylist(ctx, req.(*DownloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ytdlp_Progress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YtdlpServer).Progress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ytdlp_Progress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YtdlpServer).Progress(ctx, req.(*BaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ytdlp_Running_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(YtdlpServer).Running(m, &grpc.GenericServerStream[Empty, ProcessResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ytdlp_RunningServer = grpc.ServerStreamingServer[ProcessResponse]
+
+func _Ytdlp_Kill_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(YtdlpServer).Kill(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ytdlp_Kill_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(YtdlpServer).Kill(ctx, req.(*BaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ytdlp_KillAll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(YtdlpServer).KillAll(m, &grpc.GenericServerStream[Empty, ExecResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ytdlp_KillAllServer = grpc.ServerStreamingServer[ExecResponse]
+
+// Ytdlp_ServiceDesc is the grpc.ServiceDesc for Ytdlp service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ytdlp_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Ytdlp",
+	HandlerType: (*YtdlpServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Exec",
+			Handler:    _Ytdlp_Exec_Handler,
+		},
+		{
+			MethodName: "ExecPlaylist",
+			Handler:    _Ytdlp_ExecPlaylist_Handler,
+		},
+		{
+			MethodName: "Progress",
+			Handler:    _Ytdlp_Progress_Handler,
+		},
+		{
+			MethodName: "Kill",
+			Handler:    _Ytdlp_Kill_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Running",
+			Handler:       _Ytdlp_Running_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "KillAll",
+			Handler:       _Ytdlp_KillAll_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "yt-dlp.proto",
+}
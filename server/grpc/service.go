@@ -0,0 +1,296 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/grpc/pb"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC counterpart of the JSON-RPC service, backed by the same memory db and
+// message queue.
+type Service struct {
+	pb.UnimplementedYtdlpServer
+
+	db *internal.MemoryDB
+	mq *internal.MessageQueue
+}
+
+// The request must have the scope and, unless only reading, the user must
+// be able to act on the downloads
+func allowed(ctx context.Context, scope string) error {
+	if err := auth.RequireScope(ctx, scope); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if scope == auth.ScopeRead {
+		return nil
+	}
+
+	if err := auth.CanWrite(ctx); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return nil
+}
+
+// Quota errors are sent as ResourceExhausted, the other ones as
+// InvalidArgument
+func quotaError(err error) error {
+	if errors.Is(err, internal.ErrQuotaExceeded) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// Exec implements pb.YtdlpServer.
+func (s *Service) Exec(ctx context.Context, req *pb.DownloadRequest) (*pb.ExecResponse, error) {
+	if err := allowed(ctx, auth.ScopeExec); err != nil {
+		return nil, err
+	}
+
+	args := toDownloadRequest(req)
+
+	if err := args.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.mq.CheckQuota(ctx, auth.Owner(ctx), 1); err != nil {
+		return nil, quotaError(err)
+	}
+
+	p := &internal.Process{
+		Url:    args.URL,
+		Params: args.DownloadParams(),
+		Output: internal.DownloadOutput{
+			Path:     args.Path,
+			Filename: args.Rename,
+		},
+		Owner: auth.Owner(ctx),
+	}
+
+	s.db.Set(p)
+	s.mq.Publish(p)
+
+	return &pb.ExecResponse{Id: p.Id}, nil
+}
+
+// ExecPlaylist implements pb.YtdlpServer.
+func (s *Service) ExecPlaylist(ctx context.Context, req *pb.DownloadRequest) (*pb.ExecResponse, error) {
+	if err := allowed(ctx, auth.ScopeExec); err != nil {
+		return nil, err
+	}
+
+	args := toDownloadRequest(req)
+
+	if err := args.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	args.Owner = auth.Owner(ctx)
+
+	if err := internal.PlaylistDetect(args, s.mq, s.db); err != nil {
+		return nil, quotaError(err)
+	}
+
+	return &pb.ExecResponse{}, nil
+}
+
+// Progress implements pb.YtdlpServer.
+func (s *Service) Progress(ctx context.Context, req *pb.BaseRequest) (*pb.DownloadProgress, error) {
+	if err := allowed(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+
+	proc, err := s.db.GetOwnedBy(req.GetId(), auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return toProgress(proc.Progress), nil
+}
+
+// Running implements pb.YtdlpServer.
+// The current state of every process is sent first, then each change as it
+// happens until the client goes away. Non-admins only get their own.
+func (s *Service) Running(req *pb.Empty, stream grpc.ServerStreamingServer[pb.ProcessResponse]) error {
+	if err := allowed(stream.Context(), auth.ScopeRead); err != nil {
+		return err
+	}
+
+	owner := auth.OwnerFilter(stream.Context())
+
+	for {
+		// subscribe before taking the snapshot so nothing is missed in between
+		events, unsubscribe := s.db.Events().Subscribe("", nil, owner)
+
+		err := s.streamRunning(stream, events, owner)
+		unsubscribe()
+
+		if err != nil {
+			return err
+		}
+
+		// the stream didn't keep up and has been dropped: start over
+		slog.Warn("gRPC Running stream resynced")
+	}
+}
+
+func (s *Service) streamRunning(
+	stream grpc.ServerStreamingServer[pb.ProcessResponse],
+	events <-chan internal.Event,
+	owner string,
+) error {
+	// progress events only carry the progress, the rest is taken from here
+	running := make(map[string]*pb.ProcessResponse)
+
+	for _, p := range *s.db.AllOwnedBy(owner) {
+		res := toProcessResponse(p)
+		running[p.Id] = res
+
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			res := running[e.JobId]
+
+			switch {
+			case e.Type == internal.EventResync:
+				return nil
+			case e.Type == internal.EventRemoved:
+				delete(running, e.JobId)
+				res = &pb.ProcessResponse{Id: e.JobId, Removed: true}
+			case e.Process != nil:
+				res = toProcessResponse(*e.Process)
+				running[e.JobId] = res
+			case e.Progress != nil && res != nil:
+				res.Progress = toProgress(*e.Progress)
+			default:
+				continue
+			}
+
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Kill implements pb.YtdlpServer.
+func (s *Service) Kill(ctx context.Context, req *pb.BaseRequest) (*pb.ExecResponse, error) {
+	if err := allowed(ctx, auth.ScopeKill); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Trying killing process with id", slog.String("id", req.GetId()))
+
+	proc, err := s.db.GetOwnedBy(req.GetId(), auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err := proc.Kill(); err != nil {
+		slog.Info("failed killing process", slog.String("id", proc.Id), slog.Any("err", err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	s.db.Delete(proc.Id)
+	slog.Info("succesfully killed process", slog.String("id", proc.Id))
+
+	return &pb.ExecResponse{Id: proc.Id}, nil
+}
+
+// KillAll implements pb.YtdlpServer.
+// The id of each killed process is streamed back. Non-admins only kill
+// their own.
+func (s *Service) KillAll(req *pb.Empty, stream grpc.ServerStreamingServer[pb.ExecResponse]) error {
+	if err := allowed(stream.Context(), auth.ScopeKill); err != nil {
+		return err
+	}
+
+	slog.Info("Killing all spawned processes")
+
+	owner := auth.OwnerFilter(stream.Context())
+
+	for _, key := range *s.db.Keys() {
+		proc, err := s.db.GetOwnedBy(key, owner)
+		if err != nil {
+			continue
+		}
+
+		err = proc.Kill()
+		s.db.Delete(proc.Id)
+
+		if err != nil {
+			slog.Info("failed killing process", slog.String("id", proc.Id), slog.Any("err", err))
+			continue
+		}
+
+		if err := stream.Send(&pb.ExecResponse{Id: proc.Id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toDownloadRequest(req *pb.DownloadRequest) internal.DownloadRequest {
+	return internal.DownloadRequest{
+		URL:    req.GetUrl(),
+		Path:   req.GetPath(),
+		Rename: req.GetRename(),
+		Params: req.GetParams(),
+	}
+}
+
+func toProgress(p internal.DownloadProgress) *pb.DownloadProgress {
+	return &pb.DownloadProgress{
+		Status:     int32(p.Status),
+		Percentage: p.Percentage,
+		Speed:      float32(p.Speed),
+		Eta:        float32(p.ETA),
+	}
+}
+
+func toProcessResponse(p internal.ProcessResponse) *pb.ProcessResponse {
+	return &pb.ProcessResponse{
+		Id:       p.Id,
+		Progress: toProgress(p.Progress),
+		Info: &pb.DownloadInfo{
+			Url:         p.Info.URL,
+			Title:       p.Info.Title,
+			Thumbnail:   p.Info.Thumbnail,
+			Resolution:  p.Info.Resolution,
+			Size:        p.Info.Size,
+			Vcodec:      p.Info.VCodec,
+			Acodec:      p.Info.ACodec,
+			Extension:   p.Info.Extension,
+			OriginalURL: p.Info.OriginalURL,
+			CreatedAt:   p.Info.CreatedAt.Format(time.RFC3339),
+		},
+		Output: &pb.DownloadOutput{
+			Path:          p.Output.Path,
+			Filename:      p.Output.Filename,
+			SavedFilePath: p.Output.SavedFilePath,
+		},
+		Params: p.Params,
+	}
+}
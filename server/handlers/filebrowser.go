@@ -4,8 +4,10 @@ import (
 	"archive/zip"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/fs"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,8 +19,11 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash"
 )
 
 /*
@@ -117,99 +122,111 @@ func ListDownloaded(w http.ResponseWriter, r *http.Request) {
 
 type DeleteRequest = DirectoryEntry
 
-func DeleteFile(w http.ResponseWriter, r *http.Request) {
-	req := new(DeleteRequest)
+// Moves a file, or directory, of the download directory to the trash
+func DeleteFile(bin trash.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := new(DeleteRequest)
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if err := os.Remove(req.Path); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		item, err := bin.Trash(r.Context(), req.Path, trash.KindFilebrowser, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("ok")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(item)
+	}
 }
 
-func SendFile(w http.ResponseWriter, r *http.Request) {
-	path := chi.URLParam(r, "id")
+// Streams a file of the download directory, which counts as watching it
+func SendFile(entries archive.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filename, err := decodePath(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if path == "" {
-		http.Error(w, "inexistent path", http.StatusBadRequest)
-		return
-	}
+		root := config.Instance().DownloadPath
 
-	path, err := url.QueryUnescape(path)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+		if strings.Contains(filepath.Dir(filepath.Clean(filename)), filepath.Clean(root)) {
+			watched(r, entries, filename)
+			http.ServeFile(w, r, filename)
+			return
+		}
 
-	decoded, err := base64.StdEncoding.DecodeString(path)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		w.WriteHeader(http.StatusUnauthorized)
 	}
+}
 
-	filename := string(decoded)
+func DownloadFile(entries archive.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filename, err := decodePath(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	root := config.Instance().DownloadPath
+		root := config.Instance().DownloadPath
 
-	if strings.Contains(filepath.Dir(filepath.Clean(filename)), filepath.Clean(root)) {
-		http.ServeFile(w, r, filename)
-		return
-	}
+		if strings.Contains(filepath.Dir(filepath.Clean(filename)), filepath.Clean(root)) {
+			w.Header().Add("Content-Disposition", "inline; filename=\""+filepath.Base(filename)+"\"")
+			w.Header().Set("Content-Type", "application/octet-stream")
+
+			fd, err := os.Open(filename)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			defer fd.Close()
+
+			watched(r, entries, filename)
+			io.Copy(w, fd)
+			return
+		}
 
-	w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusUnauthorized)
+	}
 }
 
-func DownloadFile(w http.ResponseWriter, r *http.Request) {
+// The path of the file, url and base64 encoded in the route
+func decodePath(r *http.Request) (string, error) {
 	path := chi.URLParam(r, "id")
 
 	if path == "" {
-		http.Error(w, "inexistent path", http.StatusBadRequest)
-		return
+		return "", errors.New("inexistent path")
 	}
 
 	path, err := url.QueryUnescape(path)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return "", err
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(path)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return "", err
 	}
 
-	filename := string(decoded)
-
-	root := config.Instance().DownloadPath
-
-	if strings.Contains(filepath.Dir(filepath.Clean(filename)), filepath.Clean(root)) {
-		w.Header().Add("Content-Disposition", "inline; filename=\""+filepath.Base(filename)+"\"")
-		w.Header().Set("Content-Type", "application/octet-stream")
-
-		fd, err := os.Open(filename)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	return string(decoded), nil
+}
 
-		io.Copy(w, fd)
-		return
+// The least recently watched entries are the first evicted by the cleanup
+// policies freeing space
+func watched(r *http.Request, entries archive.Service, filename string) {
+	if err := entries.Watched(r.Context(), filename); err != nil {
+		slog.Warn("failed to record a watched file", slog.String("path", filename), slog.String("err", err.Error()))
 	}
-
-	w.WriteHeader(http.StatusUnauthorized)
 }
 
 func BulkDownload(mdb *internal.MemoryDB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ps := slices.DeleteFunc(*mdb.All(), func(e internal.ProcessResponse) bool {
+		ps := slices.DeleteFunc(*mdb.AllOwnedBy(auth.OwnerFilter(r.Context())), func(e internal.ProcessResponse) bool {
 			return e.Progress.Status != internal.StatusCompleted
 		})
 
@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user"
 )
 
 const TOKEN_COOKIE_NAME = "jwt-yt-dlp-webui"
@@ -17,40 +17,41 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
+// Issues a JWT carrying the id and the role of the user
+func Login(users user.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LoginRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var (
-		username = config.Instance().Username
-		password = config.Instance().Password
-	)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if username != req.Username || password != req.Password {
-		http.Error(w, "invalid username or password", http.StatusBadRequest)
-		return
-	}
+		u, err := users.Login(r.Context(), req.Username, req.Password)
+		if err != nil {
+			http.Error(w, "invalid username or password", http.StatusBadRequest)
+			return
+		}
 
-	expiresAt := time.Now().Add(time.Hour * 24 * 30)
+		expiresAt := time.Now().Add(time.Hour * 24 * 30)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"expiresAt": expiresAt,
-		"username":  req.Username,
-	})
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"expiresAt": expiresAt,
+			"sub":       u.Id,
+			"username":  u.Username,
+			"role":      u.Role,
+		})
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	if err := json.NewEncoder(w).Encode(tokenString); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		if err := json.NewEncoder(w).Encode(tokenString); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 }
 
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// A process whose fair share grows is restarted only if it gains at least
+// this fraction of its current limit: restarting has a cost and yt-dlp
+// can't change its rate limit on the fly.
+const bandwidthGainThreshold = 0.25
+
+// Shares the configured bandwidth budget fairly across the running processes.
+// Every time a process starts or ends the limits are recalculated, processes
+// whose limit changed are restarted to apply it.
+type bandwidthManager struct {
+	running map[string]*Process
+	mu      sync.Mutex
+}
+
+func newBandwidthManager() *bandwidthManager {
+	return &bandwidthManager{
+		running: make(map[string]*Process),
+	}
+}
+
+func (b *bandwidthManager) add(p *Process) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running[p.Id] = p
+	b.rebalance()
+}
+
+func (b *bandwidthManager) remove(p *Process) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.running, p.Id)
+	b.rebalance()
+}
+
+// must be called with the lock held
+func (b *bandwidthManager) rebalance() {
+	budget, err := parseRate(config.Instance().BandwidthLimit)
+	if err != nil {
+		slog.Warn("invalid bandwidth limit", slog.String("err", err.Error()))
+	}
+
+	caps := make(map[string]int64, len(b.running))
+	for id, p := range b.running {
+		limit, err := parseRate(p.RateLimit)
+		if err != nil {
+			slog.Warn("invalid rate limit",
+				slog.String("id", p.getShortId()),
+				slog.String("err", err.Error()),
+			)
+		}
+		caps[id] = limit
+	}
+
+	limits := shareBandwidth(budget, caps)
+
+	for id, p := range b.running {
+		limit := limits[id]
+		p.limit = limit
+
+		if !p.running || !needsRestart(p.appliedLimit, limit) {
+			continue
+		}
+
+		slog.Info("restarting process to apply a new rate limit",
+			slog.String("id", p.getShortId()),
+			slog.Int64("from", p.appliedLimit),
+			slog.Int64("to", limit),
+		)
+
+		p.restarting = true
+		if err := p.terminate(); err != nil {
+			p.restarting = false
+			slog.Error("failed to restart process",
+				slog.String("id", p.getShortId()),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+}
+
+// Split the budget evenly, processes capped below their share keep their cap
+// and leave what they don't use to the others. 0 means unlimited.
+func shareBandwidth(budget int64, caps map[string]int64) map[string]int64 {
+	limits := make(map[string]int64, len(caps))
+
+	if budget <= 0 {
+		for id, limit := range caps {
+			limits[id] = limit
+		}
+		return limits
+	}
+
+	left := make(map[string]int64, len(caps))
+	for id, limit := range caps {
+		left[id] = limit
+	}
+
+	for len(left) > 0 {
+		share := max(budget/int64(len(left)), 1)
+		capped := false
+
+		for id, limit := range left {
+			if limit > 0 && limit <= share {
+				limits[id] = limit
+				budget -= limit
+				delete(left, id)
+				capped = true
+			}
+		}
+
+		if !capped {
+			for id := range left {
+				limits[id] = share
+			}
+			break
+		}
+	}
+
+	return limits
+}
+
+// A lower limit must always be applied or the budget would be exceeded,
+// a higher one only if worth it. 0 means unlimited.
+func needsRestart(applied, limit int64) bool {
+	switch {
+	case applied == limit:
+		return false
+	case limit == 0:
+		return true
+	case applied == 0 || limit < applied:
+		return true
+	default:
+		return float64(limit-applied) >= float64(applied)*bandwidthGainThreshold
+	}
+}
+
+// Parse a size in bytes written like the rates, e.g. "500M" or "20G"
+func ParseSize(size string) (int64, error) {
+	return parseRate(size)
+}
+
+// Parse a rate in bytes per second written in the same format yt-dlp
+// accepts for --limit-rate, e.g. "50K" or "4.2M". Empty means unlimited.
+// Also used for sizes in bytes.
+func parseRate(rate string) (int64, error) {
+	rate = strings.TrimSpace(rate)
+	if rate == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+
+	switch strings.ToUpper(rate[len(rate)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+
+	if multiplier > 1 {
+		rate = rate[:len(rate)-1]
+	}
+
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid rate, expected a value like 500K or 4.2M")
+	}
+
+	return int64(math.Round(value * multiplier)), nil
+}
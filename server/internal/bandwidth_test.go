@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	for rate, want := range map[string]int64{
+		"":     0,
+		"500":  500,
+		"50K":  50 << 10,
+		"4.5m": 4.5 * (1 << 20),
+		"1G":   1 << 30,
+	} {
+		got, err := parseRate(rate)
+		if err != nil {
+			t.Fatalf("parseRate(%q): %s", rate, err)
+		}
+		if got != want {
+			t.Errorf("parseRate(%q) = %d, want %d", rate, got, want)
+		}
+	}
+
+	for _, rate := range []string{"fast", "-1M", "M"} {
+		if _, err := parseRate(rate); err == nil {
+			t.Errorf("parseRate(%q): expected an error", rate)
+		}
+	}
+}
+
+func TestNeedsRestart(t *testing.T) {
+	cases := []struct {
+		applied, limit int64
+		want           bool
+	}{
+		{1000, 1000, false},
+		{1000, 500, true},
+		{0, 500, true},
+		{1000, 0, true},
+		{1000, 1100, false},
+		{1000, 1500, true},
+	}
+
+	for _, c := range cases {
+		if got := needsRestart(c.applied, c.limit); got != c.want {
+			t.Errorf("needsRestart(%d, %d) = %t, want %t", c.applied, c.limit, got, c.want)
+		}
+	}
+}
+
+func TestShareBandwidth(t *testing.T) {
+	got := shareBandwidth(1000, map[string]int64{"a": 0, "b": 100, "c": 0})
+	want := map[string]int64{"a": 450, "b": 100, "c": 450}
+
+	if !maps.Equal(got, want) {
+		t.Errorf("shareBandwidth() = %v, want %v", got, want)
+	}
+
+	got = shareBandwidth(0, map[string]int64{"a": 0, "b": 100})
+	want = map[string]int64{"a": 0, "b": 100}
+
+	if !maps.Equal(got, want) {
+		t.Errorf("shareBandwidth() without budget = %v, want %v", got, want)
+	}
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "time"
+import (
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
 
 // Used to unmarshall yt-dlp progress
 type ProgressTemplate struct {
@@ -41,7 +45,14 @@ type DownloadInfo struct {
 	Extension   string    `json:"ext"`
 	OriginalURL string    `json:"original_url"`
 	FileName    string    `json:"filename"`
+	VideoId     string    `json:"id"`
+	Extractor   string    `json:"extractor_key"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	// indexed by the archive search
+	Uploader    string  `json:"uploader,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Duration    float64 `json:"duration,omitempty"`
 }
 
 // struct representing the response sent to the client
@@ -52,6 +63,24 @@ type ProcessResponse struct {
 	Info     DownloadInfo     `json:"info"`
 	Output   DownloadOutput   `json:"output"`
 	Params   []string         `json:"params"`
+	Error    *ProcessError    `json:"error,omitempty"`
+
+	RetryPolicy  *config.RetryPolicy `json:"retry_policy,omitempty"`
+	Attempts     []Attempt           `json:"attempts,omitempty"`
+	Priority     int                 `json:"priority"`
+	RateLimit    string              `json:"rate_limit,omitempty"`
+	NotBefore    *time.Time          `json:"not_before,omitempty"`
+	BypassWindow bool                `json:"bypass_window,omitempty"`
+	Force        bool                `json:"force,omitempty"`
+	Duplicate    bool                `json:"duplicate,omitempty"`
+	Owner        string              `json:"owner,omitempty"`
+	Tags         []string            `json:"tags,omitempty"`
+}
+
+// Details of a failed yt-dlp execution
+type ProcessError struct {
+	ExitCode int      `json:"exit_code"`
+	Stderr   []string `json:"stderr"`
 }
 
 // struct representing the current status of the memoryDB
@@ -72,6 +101,43 @@ type DownloadRequest struct {
 	Path   string   `json:"path"`
 	Rename string   `json:"rename"`
 	Params []string `json:"params"`
+
+	// overrides the configured retry policy, fields left empty are inherited
+	Retry *config.RetryPolicy `json:"retry"`
+	// higher priority downloads are started first
+	Priority int `json:"priority"`
+	// bandwidth cap in bytes/s, same format as yt-dlp --limit-rate e.g. "4.2M"
+	RateLimit string `json:"rate_limit"`
+	// the download is held in the queue until this time
+	NotBefore *time.Time `json:"not_before"`
+	// download even if it has been downloaded before
+	Force bool `json:"force"`
+	// copied to the archive entry once completed
+	Tags []string `json:"tags"`
+	// use the cookies file set through the cookies endpoint, --cookies itself
+	// is denied
+	Cookies bool `json:"cookies"`
+	// set from the authenticated user, never from the request body
+	Owner string `json:"-"`
+}
+
+// struct representing the intent to move a pending process in the queue,
+// right before another one
+type MoveRequest struct {
+	Id     string `json:"id"`
+	Before string `json:"before"`
+}
+
+// Number of concurrent download slots and how many of them are in use
+type Concurrency struct {
+	Size   int `json:"size"`
+	Active int `json:"active"`
+}
+
+// struct representing the intent to change the priority of a pending process
+type PriorityRequest struct {
+	Id       string `json:"id"`
+	Priority int    `json:"priority"`
 }
 
 // struct representing request of creating a netscape cookies file
@@ -84,4 +150,19 @@ type CustomTemplate struct {
 	Id      string `json:"id"`
 	Name    string `json:"name"`
 	Content string `json:"content"`
+	Owner   string `json:"owner,omitempty"`
+}
+
+// Change when a waiting process is started
+type ScheduleRequest struct {
+	Id string `json:"id"`
+	// nil sends the process to the queue right away
+	NotBefore *time.Time `json:"not_before"`
+}
+
+// The daily time windows downloads are started in and whether one is
+// currently open
+type DownloadWindows struct {
+	Windows []string `json:"windows"`
+	Open    bool     `json:"open"`
 }
@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Instance-wide index of the downloaded videos, keyed by extractor and video
+// id as yt-dlp does with --download-archive. It's used to skip downloads
+// already completed.
+type DownloadIndex struct {
+	db *sql.DB
+}
+
+type IndexEntry struct {
+	Extractor string    `json:"extractor"`
+	VideoId   string    `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewDownloadIndex(db *sql.DB) *DownloadIndex {
+	return &DownloadIndex{db: db}
+}
+
+// Reports whether a video has been downloaded already
+func (i *DownloadIndex) Contains(ctx context.Context, extractor, videoId string) (bool, error) {
+	if extractor == "" || videoId == "" {
+		return false, nil
+	}
+
+	var found int
+
+	err := i.db.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM download_index WHERE extractor = ? AND video_id = ?",
+		normalizeExtractor(extractor),
+		videoId,
+	).Scan(&found)
+
+	return found > 0, err
+}
+
+// Record a downloaded video, recording it twice is a no-op
+func (i *DownloadIndex) Add(ctx context.Context, e IndexEntry) error {
+	if e.Extractor == "" || e.VideoId == "" {
+		return nil
+	}
+
+	_, err := i.db.ExecContext(
+		ctx,
+		`INSERT OR IGNORE INTO download_index (extractor, video_id, url, title, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		normalizeExtractor(e.Extractor),
+		e.VideoId,
+		e.URL,
+		e.Title,
+		e.CreatedAt,
+	)
+
+	return err
+}
+
+// Import a yt-dlp --download-archive file: one "extractor id" pair per line.
+// Returns how many videos were added to the index.
+func (i *DownloadIndex) Import(ctx context.Context, r io.Reader) (int, error) {
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		imported int
+		line     int
+		scanner  = bufio.NewScanner(r)
+	)
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		extractor, videoId, ok := strings.Cut(text, " ")
+		if !ok || strings.TrimSpace(videoId) == "" {
+			return 0, fmt.Errorf("line %d: expected \"extractor id\"", line)
+		}
+
+		res, err := tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO download_index (extractor, video_id, url, title, created_at)
+			VALUES (?, ?, '', '', ?)`,
+			normalizeExtractor(extractor),
+			strings.TrimSpace(videoId),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		n, _ := res.RowsAffected()
+		imported += int(n)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return imported, tx.Commit()
+}
+
+// Write the index in the yt-dlp --download-archive format
+func (i *DownloadIndex) Export(ctx context.Context, w io.Writer) error {
+	rows, err := i.db.QueryContext(
+		ctx,
+		"SELECT extractor, video_id FROM download_index ORDER BY rowid",
+	)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	bw := bufio.NewWriter(w)
+
+	for rows.Next() {
+		var extractor, videoId string
+
+		if err := rows.Scan(&extractor, &videoId); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(bw, "%s %s\n", extractor, videoId); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Add the entries of the archive table to the index. Entries archived
+// without the extractor and the video id in their metadata are left out.
+// Returns how many videos were added to the index.
+func (i *DownloadIndex) Backfill(ctx context.Context) (int, error) {
+	rows, err := i.db.QueryContext(ctx, "SELECT source, title, metadata, created_at FROM archive")
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []IndexEntry
+
+	for rows.Next() {
+		var (
+			e         IndexEntry
+			source    sql.NullString
+			metadata  sql.NullString
+			createdAt sql.NullTime
+			info      DownloadInfo
+		)
+
+		if err := rows.Scan(&source, &e.Title, &metadata, &createdAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if err := json.Unmarshal([]byte(metadata.String), &info); err != nil {
+			continue
+		}
+
+		e.Extractor = info.Extractor
+		e.VideoId = info.VideoId
+		e.URL = source.String
+		e.CreatedAt = createdAt.Time
+
+		entries = append(entries, e)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var added int
+
+	for _, e := range entries {
+		found, err := i.Contains(ctx, e.Extractor, e.VideoId)
+		if err != nil {
+			return added, err
+		}
+
+		if found || e.Extractor == "" || e.VideoId == "" {
+			continue
+		}
+
+		if err := i.Add(ctx, e); err != nil {
+			return added, err
+		}
+		added++
+	}
+
+	return added, nil
+}
+
+// Record a process which completed its download
+func (i *DownloadIndex) record(p *Process) {
+	if i == nil || p.killed || p.Duplicate || p.Progress.Status != StatusCompleted {
+		return
+	}
+
+	err := i.Add(context.Background(), IndexEntry{
+		Extractor: p.Info.Extractor,
+		VideoId:   p.Info.VideoId,
+		URL:       p.Url,
+		Title:     p.Info.Title,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		slog.Error("failed to add download to the index",
+			slog.String("id", p.getShortId()),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// yt-dlp records the lowercased extractor key, e.g. "youtube"
+func normalizeExtractor(extractor string) string {
+	return strings.ToLower(strings.TrimSpace(extractor))
+}
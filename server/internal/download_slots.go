@@ -0,0 +1,79 @@
+package internal
+
+import "sync"
+
+// Counting semaphore limiting the concurrent downloads, its size can be
+// changed at runtime.
+// Shrinking it doesn't affect the downloads already running: new ones are
+// not started until enough slots are released.
+type downloadSlots struct {
+	size   int
+	active int // slots taken, including the one waiting for a process
+	// downloads started, the consumer takes a slot before a process is ready
+	running int
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+func newDownloadSlots(size int) *downloadSlots {
+	s := &downloadSlots{size: size}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Block until a slot is available and take it
+func (s *downloadSlots) Acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.active >= s.size {
+		s.cond.Wait()
+	}
+
+	s.active++
+}
+
+// Give back a slot no download was started with
+func (s *downloadSlots) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active--
+	s.cond.Broadcast()
+}
+
+// A download was started with the slot taken
+func (s *downloadSlots) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running++
+}
+
+// Give back the slot of a finished download
+func (s *downloadSlots) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.active--
+	s.cond.Broadcast()
+}
+
+func (s *downloadSlots) Resize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size = size
+	s.cond.Broadcast()
+}
+
+func (s *downloadSlots) Usage() Concurrency {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Concurrency{
+		Size:   s.size,
+		Active: s.running,
+	}
+}
@@ -0,0 +1,25 @@
+package internal
+
+import "testing"
+
+func TestDownloadSlotsUsage(t *testing.T) {
+	s := newDownloadSlots(2)
+
+	// the consumer waiting for a process holds a slot
+	s.Acquire()
+	if u := s.Usage(); u.Active != 0 {
+		t.Fatalf("idle: active = %d, want 0", u.Active)
+	}
+
+	s.Start()
+	if u := s.Usage(); u.Active != 1 {
+		t.Fatalf("downloading: active = %d, want 1", u.Active)
+	}
+
+	s.Finish()
+	s.Acquire()
+	s.Release()
+	if u := s.Usage(); u.Active != 0 || s.active != 0 {
+		t.Errorf("finished: active = %d, taken %d, want 0", u.Active, s.active)
+	}
+}
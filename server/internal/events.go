@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventJobCreated   = "job-created"
+	EventProgress     = "progress"
+	EventStateChanged = "state-changed"
+	EventCompleted    = "completed"
+	EventErrored      = "errored"
+	EventRemoved      = "removed"
+	// Sent to a subscriber whose cursor can't be resumed: events have been
+	// missed and the state must be fetched again e.g. with Running.
+	EventResync = "resync"
+)
+
+// How many events are kept to resume the subscribers reconnecting
+const eventBacklogSize = 1024
+
+// How many events can wait for a subscriber before it's dropped
+const eventSubscriberBuffer = 256
+
+type Event struct {
+	// pass it back when subscribing to get the events following this one
+	Cursor   string            `json:"cursor"`
+	Type     string            `json:"type"`
+	JobId    string            `json:"job_id,omitempty"`
+	Time     time.Time         `json:"time"`
+	Progress *DownloadProgress `json:"progress,omitempty"`
+	Process  *ProcessResponse  `json:"process,omitempty"`
+	seq      uint64
+	owner    string
+}
+
+// Fan-out of the processes events to the subscribers.
+// The last events are kept so a subscriber can resume from its cursor after
+// reconnecting. Cursors are only valid until the server restarts.
+type EventHub struct {
+	epoch       int64
+	seq         uint64
+	backlog     []Event
+	subscribers map[*eventSubscriber]struct{}
+	mu          sync.Mutex
+}
+
+type eventSubscriber struct {
+	ch     chan Event
+	jobIds map[string]struct{} // empty means every job
+	owner  string              // empty means every owner
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		epoch:       time.Now().UnixNano(),
+		backlog:     make([]Event, 0, eventBacklogSize),
+		subscribers: make(map[*eventSubscriber]struct{}),
+	}
+}
+
+func (h *EventHub) publish(e Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.seq = h.seq
+	e.Cursor = h.cursor(h.seq)
+	e.Time = time.Now()
+
+	if len(h.backlog) == eventBacklogSize {
+		h.backlog = append(h.backlog[:0], h.backlog[1:]...)
+	}
+	h.backlog = append(h.backlog, e)
+
+	for s := range h.subscribers {
+		if !s.wants(e) {
+			continue
+		}
+
+		select {
+		case s.ch <- e:
+		default:
+			// too slow: drop it, it can resume from its last cursor
+			close(s.ch)
+			delete(h.subscribers, s)
+		}
+	}
+}
+
+// Subscribe to the events of the given jobs, every job if none is given.
+// Only the jobs of the owner are visible, if given.
+// If a cursor is given the events published after it are replayed first.
+// The channel is closed if the subscriber doesn't keep up, the returned
+// function must be called to unsubscribe.
+func (h *EventHub) Subscribe(cursor string, jobIds []string, owner string) (<-chan Event, func()) {
+	s := &eventSubscriber{
+		ch:     make(chan Event, eventSubscriberBuffer+eventBacklogSize),
+		jobIds: make(map[string]struct{}, len(jobIds)),
+		owner:  owner,
+	}
+
+	for _, id := range jobIds {
+		s.jobIds[id] = struct{}{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cursor != "" {
+		h.replay(s, cursor)
+	}
+
+	h.subscribers[s] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, ok := h.subscribers[s]; ok {
+			close(s.ch)
+			delete(h.subscribers, s)
+		}
+	}
+
+	return s.ch, unsubscribe
+}
+
+// must be called with the lock held
+func (h *EventHub) replay(s *eventSubscriber, cursor string) {
+	seq, err := h.parseCursor(cursor)
+
+	// the events following the cursor are no longer available
+	if err != nil || seq > h.seq || (len(h.backlog) > 0 && seq+1 < h.backlog[0].seq) {
+		s.ch <- Event{
+			Cursor: h.cursor(h.seq),
+			Type:   EventResync,
+			Time:   time.Now(),
+		}
+		return
+	}
+
+	for _, e := range h.backlog {
+		if e.seq > seq && s.wants(e) {
+			s.ch <- e
+		}
+	}
+}
+
+func (h *EventHub) cursor(seq uint64) string {
+	return fmt.Sprintf("%d-%d", h.epoch, seq)
+}
+
+func (h *EventHub) parseCursor(cursor string) (uint64, error) {
+	epoch, seq, ok := strings.Cut(cursor, "-")
+	if !ok || epoch != strconv.FormatInt(h.epoch, 10) {
+		return 0, errors.New("unknown cursor")
+	}
+
+	return strconv.ParseUint(seq, 10, 64)
+}
+
+func (s *eventSubscriber) wants(e Event) bool {
+	if s.owner != "" && e.owner != s.owner {
+		return false
+	}
+
+	if len(s.jobIds) == 0 {
+		return true
+	}
+
+	_, ok := s.jobIds[e.JobId]
+	return ok
+}
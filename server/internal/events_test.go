@@ -0,0 +1,72 @@
+package internal
+
+import "testing"
+
+func drain(ch <-chan Event) []Event {
+	var events []Event
+	for {
+		select {
+		case e := <-ch:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventHubFilter(t *testing.T) {
+	hub := NewEventHub()
+
+	ch, unsubscribe := hub.Subscribe("", []string{"a"}, "")
+	defer unsubscribe()
+
+	hub.publish(Event{Type: EventJobCreated, JobId: "a"})
+	hub.publish(Event{Type: EventJobCreated, JobId: "b"})
+	hub.publish(Event{Type: EventRemoved, JobId: "a"})
+
+	events := drain(ch)
+	if len(events) != 2 || events[0].Type != EventJobCreated || events[1].Type != EventRemoved {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestEventHubOwner(t *testing.T) {
+	hub := NewEventHub()
+
+	ch, unsubscribe := hub.Subscribe("", nil, "alice")
+	defer unsubscribe()
+
+	hub.publish(Event{Type: EventJobCreated, JobId: "a", owner: "alice"})
+	hub.publish(Event{Type: EventJobCreated, JobId: "b", owner: "bob"})
+	hub.publish(Event{Type: EventJobCreated, JobId: "c"})
+
+	events := drain(ch)
+	if len(events) != 1 || events[0].JobId != "a" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestEventHubResume(t *testing.T) {
+	hub := NewEventHub()
+
+	hub.publish(Event{Type: EventJobCreated, JobId: "a"})
+	hub.publish(Event{Type: EventProgress, JobId: "a"})
+	hub.publish(Event{Type: EventCompleted, JobId: "a"})
+
+	first := hub.backlog[0].Cursor
+
+	ch, unsubscribe := hub.Subscribe(first, nil, "")
+	defer unsubscribe()
+
+	events := drain(ch)
+	if len(events) != 2 || events[0].Type != EventProgress || events[1].Type != EventCompleted {
+		t.Fatalf("unexpected replayed events: %+v", events)
+	}
+
+	stale, unsubscribeStale := hub.Subscribe("0-1", nil, "")
+	defer unsubscribeStale()
+
+	if events := drain(stale); len(events) != 1 || events[0].Type != EventResync {
+		t.Fatalf("expected a resync event for an unknown cursor, got %+v", events)
+	}
+}
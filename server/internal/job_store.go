@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SQLite backed store of every process known to the MemoryDB.
+// State transitions are written as they happen, so a crash does not lose
+// the queue: on boot the MemoryDB is rebuilt from the jobs table.
+type JobStore struct {
+	db *sql.DB
+	mu sync.Mutex // serialises writes, sqlite doesn't like concurrent writers
+}
+
+func NewJobStore(db *sql.DB) *JobStore {
+	return &JobStore{db: db}
+}
+
+// Insert or update the snapshot of a process
+func (s *JobStore) Save(ctx context.Context, p *Process) error {
+	snapshot := p.snapshot()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO jobs (id, url, status, data, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			data = excluded.data,
+			updated_at = excluded.updated_at`,
+		p.Id,
+		p.Url,
+		snapshot.Progress.Status,
+		string(data),
+		p.Info.CreatedAt,
+		time.Now(),
+	)
+
+	return err
+}
+
+// Remove a process from the store
+func (s *JobStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM jobs WHERE id = ?", id)
+	return err
+}
+
+// A stored process: its snapshot and the url it was requested with, the
+// url of the snapshot info is replaced by the media one once the metadata
+// are retrieved
+type StoredProcess struct {
+	ProcessResponse
+	Url string
+}
+
+// Every stored process in insertion order
+func (s *JobStore) All(ctx context.Context) (*[]StoredProcess, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT url, data FROM jobs ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	processes := make([]StoredProcess, 0)
+
+	for rows.Next() {
+		var (
+			data string
+			p    StoredProcess
+		)
+
+		if err := rows.Scan(&p.Url, &data); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(data), &p.ProcessResponse); err != nil {
+			return nil, err
+		}
+
+		processes = append(processes, p)
+	}
+
+	return &processes, rows.Err()
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/dbutil"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestRestoreRequestedURL(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "local.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := dbutil.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	const page = "https://example.com/watch/1"
+
+	// the metadata replace the info url with the expiring media one
+	p := &Process{
+		Id:       "a",
+		Url:      page,
+		Info:     DownloadInfo{URL: "https://cdn.example.com/1.mp4?expires=1"},
+		Progress: DownloadProgress{Status: StatusPaused},
+	}
+
+	store := NewJobStore(db)
+	if err := store.Save(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	mdb := NewMemoryDB(store)
+	mdb.Restore(&MessageQueue{})
+
+	restored, err := mdb.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Url != page {
+		t.Errorf("restored url = %s, want %s", restored.Url, page)
+	}
+}
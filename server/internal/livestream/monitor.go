@@ -2,6 +2,7 @@ package livestream
 
 import (
 	"encoding/gob"
+	"errors"
 	"log/slog"
 	"maps"
 	"os"
@@ -11,6 +12,8 @@ import (
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
 )
 
+var ErrNotFound = errors.New("no livestream found for the given url")
+
 type Monitor struct {
 	db      *internal.MemoryDB     // where the just started livestream will be published
 	mq      *internal.MessageQueue // where the just started livestream will be published
@@ -42,7 +45,12 @@ func (m *Monitor) Add(url string) {
 }
 
 func (m *Monitor) Remove(url string) error {
-	return m.streams[url].Kill()
+	ls, ok := m.streams[url]
+	if !ok {
+		return ErrNotFound
+	}
+
+	return ls.Kill()
 }
 
 func (m *Monitor) RemoveAll() error {
@@ -1,28 +1,43 @@
 package internal
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook"
 )
 
-// In-Memory Thread-Safe Key-Value Storage with optional persistence
+var ErrProcessNotFound = errors.New("no process found for the given key")
+
+// In-Memory Thread-Safe Key-Value Storage with optional persistence.
+// When a JobStore is provided the table acts as a cache of the jobs table.
 type MemoryDB struct {
-	table map[string]*Process
-	mu    sync.RWMutex
+	table  map[string]*Process
+	store  *JobStore
+	events *EventHub
+	mu     sync.RWMutex
 }
 
-func NewMemoryDB() *MemoryDB {
+func NewMemoryDB(store *JobStore) *MemoryDB {
 	return &MemoryDB{
-		table: make(map[string]*Process),
+		table:  make(map[string]*Process),
+		store:  store,
+		events: NewEventHub(),
 	}
 }
 
+// The hub the events of the stored processes are published to
+func (m *MemoryDB) Events() *EventHub {
+	return m.events
+}
+
 // Get a process pointer given its id
 func (m *MemoryDB) Get(id string) (*Process, error) {
 	m.mu.RLock()
@@ -30,29 +45,82 @@ func (m *MemoryDB) Get(id string) (*Process, error) {
 
 	entry, ok := m.table[id]
 	if !ok {
-		return nil, errors.New("no process found for the given key")
+		return nil, ErrProcessNotFound
 	}
 
 	return entry, nil
 }
 
+// Get a process pointer given its id, only if it belongs to the given owner.
+// An empty owner matches every process.
+func (m *MemoryDB) GetOwnedBy(id, owner string) (*Process, error) {
+	p, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner != "" && p.Owner != owner {
+		return nil, ErrProcessNotFound
+	}
+
+	return p, nil
+}
+
 // Store a pointer of a process and return its id
 func (m *MemoryDB) Set(process *Process) string {
 	id := uuid.NewString()
 
 	m.mu.Lock()
 	process.Id = id
+	process.store = m.store
+	process.events = m.events
+	process.lastStatus = process.Progress.Status
 	m.table[id] = process
 	m.mu.Unlock()
 
+	process.persist()
+
+	snapshot := process.snapshot()
+	m.events.publish(Event{
+		Type:    EventJobCreated,
+		JobId:   id,
+		Process: &snapshot,
+		owner:   process.Owner,
+	})
+	process.notify(webhook.EventQueued)
+
 	return id
 }
 
 // Removes a process progress, given the process id
 func (m *MemoryDB) Delete(id string) {
 	m.mu.Lock()
+	p, ok := m.table[id]
+	if ok {
+		p.stopTimer()
+		p.removed = true
+	}
 	delete(m.table, id)
 	m.mu.Unlock()
+
+	if ok {
+		m.events.publish(Event{
+			Type:  EventRemoved,
+			JobId: id,
+			owner: p.Owner,
+		})
+	}
+
+	if m.store == nil {
+		return
+	}
+
+	if err := m.store.Delete(context.Background(), id); err != nil {
+		slog.Error("failed to delete persisted process",
+			slog.String("id", id),
+			slog.String("err", err.Error()),
+		)
+	}
 }
 
 func (m *MemoryDB) Keys() *[]string {
@@ -73,62 +141,163 @@ func (m *MemoryDB) All() *[]ProcessResponse {
 	running := []ProcessResponse{}
 
 	m.mu.RLock()
-	for k, v := range m.table {
-		running = append(running, ProcessResponse{
-			Id:       k,
-			Info:     v.Info,
-			Progress: v.Progress,
-			Output:   v.Output,
-			Params:   v.Params,
-		})
+	for _, v := range m.table {
+		running = append(running, v.snapshot())
 	}
 	m.mu.RUnlock()
 
 	return &running
 }
 
-// Persist the database in a single file named "session.dat"
-func (m *MemoryDB) Persist() error {
-	running := m.All()
+// Returns the progress of the processes of the given owner, every process
+// if the owner is empty
+func (m *MemoryDB) AllOwnedBy(owner string) *[]ProcessResponse {
+	running := []ProcessResponse{}
 
-	sf := filepath.Join(config.Instance().SessionFilePath, "session.dat")
+	m.mu.RLock()
+	for _, v := range m.table {
+		if owner == "" || v.Owner == owner {
+			running = append(running, v.snapshot())
+		}
+	}
+	m.mu.RUnlock()
 
-	fd, err := os.Create(sf)
-	if err != nil {
-		return errors.Join(errors.New("failed to persist session"), err)
+	return &running
+}
+
+// How many processes of the owner are yet to be downloaded: the queued and
+// held ones, the scheduled and paused ones and the ones waiting to be retried.
+// The downloading ones count as running instead.
+func (m *MemoryDB) Queued(owner string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, p := range m.table {
+		if p.Owner != owner || p.Livestream || p.killed {
+			continue
+		}
+
+		switch p.Progress.Status {
+		case StatusPending:
+			// yt-dlp already running for it, before its first progress line
+			if !p.running {
+				n++
+			}
+		case StatusHeld, StatusScheduled, StatusPaused:
+			n++
+		case StatusErrored:
+			if p.retrying {
+				n++
+			}
+		}
+	}
+
+	return n
+}
+
+// Flush the current state of every process (e.g. its progress) to the job
+// store. State transitions are already persisted as they happen.
+func (m *MemoryDB) Persist() error {
+	if m.store == nil {
+		return errors.New("no job store configured")
 	}
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	session := Session{Processes: *running}
 
-	if err := gob.NewEncoder(fd).Encode(session); err != nil {
-		return errors.Join(errors.New("failed to persist session"), err)
+	for _, p := range m.table {
+		if err := m.store.Save(context.Background(), p); err != nil {
+			return errors.Join(errors.New("failed to persist session"), err)
+		}
 	}
 
 	return nil
 }
 
-// Restore a persisted state
+// Restore the persisted state from the job store.
+// Unfinished processes are sent back to the message queue.
 func (m *MemoryDB) Restore(mq *MessageQueue) {
-	sf := filepath.Join(config.Instance().SessionFilePath, "session.dat")
-
-	fd, err := os.Open(sf)
-	if err != nil {
+	if m.store == nil {
 		return
 	}
 
-	var session Session
+	if err := m.importLegacySession(); err != nil {
+		slog.Warn("failed to import legacy session file", slog.String("err", err.Error()))
+	}
 
-	if err := gob.NewDecoder(fd).Decode(&session); err != nil {
+	session, err := m.store.All(context.Background())
+	if err != nil {
+		slog.Error("failed to restore session", slog.String("err", err.Error()))
 		return
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, proc := range session.Processes {
+	for _, proc := range *session {
 		restored := &Process{
+			Id:           proc.Id,
+			Url:          proc.Url,
+			Info:         proc.Info,
+			Progress:     proc.Progress,
+			Output:       proc.Output,
+			Params:       proc.Params,
+			Error:        proc.Error,
+			RetryPolicy:  proc.RetryPolicy,
+			Attempts:     proc.Attempts,
+			Priority:     proc.Priority,
+			RateLimit:    proc.RateLimit,
+			NotBefore:    proc.NotBefore,
+			BypassWindow: proc.BypassWindow,
+			Force:        proc.Force,
+			Duplicate:    proc.Duplicate,
+			Owner:        proc.Owner,
+			Tags:         proc.Tags,
+			store:        m.store,
+			events:       m.events,
+			lastStatus:   proc.Progress.Status,
+		}
+
+		m.table[proc.Id] = restored
+
+		switch restored.Progress.Status {
+		case StatusCompleted, StatusPaused:
+		case StatusErrored:
+			// a retry might have been pending when the server stopped
+			mq.scheduleRetry(restored)
+		default:
+			// scheduled and held processes are held again if still needed
+			mq.Publish(restored)
+		}
+	}
+}
+
+// Versions prior to the job store kept a gob encoded snapshot in a file
+// named "session.dat". If found, its content is moved into the job store
+// and the file is renamed so it won't be imported twice.
+func (m *MemoryDB) importLegacySession() error {
+	sf := filepath.Join(config.Instance().SessionFilePath, "session.dat")
+
+	fd, err := os.Open(sf)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var session Session
+
+	err = gob.NewDecoder(fd).Decode(&session)
+	fd.Close()
+
+	if err != nil {
+		return err
+	}
+
+	for _, proc := range session.Processes {
+		legacy := &Process{
 			Id:       proc.Id,
 			Url:      proc.Info.URL,
 			Info:     proc.Info,
@@ -137,10 +306,12 @@ func (m *MemoryDB) Restore(mq *MessageQueue) {
 			Params:   proc.Params,
 		}
 
-		m.table[proc.Id] = restored
-
-		if restored.Progress.Status != StatusCompleted {
-			mq.Publish(restored)
+		if err := m.store.Save(context.Background(), legacy); err != nil {
+			return err
 		}
 	}
+
+	slog.Info("imported legacy session file", slog.Int("processes", len(session.Processes)))
+
+	return os.Rename(sf, sf+".bak")
 }
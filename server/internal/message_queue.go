@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"time"
 
 	evbus "github.com/asaskevich/EventBus"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
@@ -12,69 +13,456 @@ import (
 
 const queueName = "process:pending"
 
+// How often the download time windows are checked
+const windowCheckInterval = time.Second * 30
+
+// How long resuming waits for the paused yt-dlp process to exit
+const stopTimeout = time.Second * 10
+
 type MessageQueue struct {
-	concurrency int
-	eventBus    evbus.Bus
+	slots     *downloadSlots
+	bandwidth *bandwidthManager
+	windows   *downloadWindows
+	index     *DownloadIndex
+	jobs      *MemoryDB
+	quotas    *Quotas
+	eventBus  evbus.Bus
+	pending   *PriorityQueue
 }
 
 // Creates a new message queue.
 // By default it will be created with a size equals to nthe number of logical
 // CPU cores -1.
 // The queue size can be set via the qs flag.
-func NewMessageQueue() (*MessageQueue, error) {
+// Downloads found in the index are skipped, unless forced.
+// The jobs of each user are started within its quota, the ones of the jobs
+// table count against it until they are finished.
+func NewMessageQueue(jobs *MemoryDB, index *DownloadIndex, quotas *Quotas) (*MessageQueue, error) {
 	qs := config.Instance().QueueSize
 
 	if qs <= 0 {
 		return nil, errors.New("invalid queue size")
 	}
 
+	windows := &downloadWindows{}
+	if err := windows.Set(config.Instance().DownloadWindows); err != nil {
+		return nil, err
+	}
+
 	return &MessageQueue{
-		concurrency: qs,
-		eventBus:    evbus.New(),
+		slots:     newDownloadSlots(qs),
+		bandwidth: newBandwidthManager(),
+		windows:   windows,
+		index:     index,
+		jobs:      jobs,
+		quotas:    quotas,
+		eventBus:  evbus.New(),
+		pending:   NewPriorityQueue(),
 	}, nil
 }
 
+// Change the number of concurrent downloads.
+// Waiting processes are started right away if it's raised, if it's lowered
+// running processes are left untouched.
+func (m *MessageQueue) SetConcurrency(size int) error {
+	if size <= 0 {
+		return errors.New("invalid queue size")
+	}
+
+	slog.Info("changing download concurrency", slog.Int("size", size))
+
+	config.Instance().QueueSize = size
+	m.slots.Resize(size)
+
+	return nil
+}
+
+// The number of concurrent downloads and how many are running
+func (m *MessageQueue) Concurrency() Concurrency {
+	return m.slots.Usage()
+}
+
 // Publish a message to the queue and set the task to a peding state.
+// Processes scheduled in the future are held until their time comes, the
+// ones published while no download time window is open are held in the
+// queue.
 func (m *MessageQueue) Publish(p *Process) {
 	// needs to have an id set before
 	p.SetPending()
 
-	m.eventBus.Publish(queueName, p)
+	// closed by the metadata consumer once done with this publication
+	metadata := make(chan struct{})
+	p.metadata = metadata
+
+	// livestreams have higher priorty and they skip the queue
+	switch {
+	case p.Livestream:
+		go p.Start()
+	case p.NotBefore != nil && time.Now().Before(*p.NotBefore):
+		m.schedule(p)
+	default:
+		m.hold(p, time.Now())
+		m.pending.Push(p)
+	}
+
+	// metadata retrieval
+	m.eventBus.Publish(queueName, p, metadata)
+}
+
+// Park a process until its not before time, then publish it again
+func (m *MessageQueue) schedule(p *Process) {
+	p.Progress.Status = StatusScheduled
+	p.persist()
+
+	slog.Info("scheduled process",
+		slog.String("id", p.getShortId()),
+		slog.Time("not_before", *p.NotBefore),
+	)
+
+	p.stopTimer()
+	p.timer = time.AfterFunc(time.Until(*p.NotBefore), func() {
+		m.Publish(p)
+	})
+}
+
+// Switch a queued process between the held and the pending state according
+// to the download time windows.
+func (m *MessageQueue) hold(p *Process, now time.Time) {
+	held := !p.BypassWindow && !m.windows.Open(now)
+
+	switch {
+	case held && p.Progress.Status == StatusPending:
+		p.Progress.Status = StatusHeld
+	case !held && p.Progress.Status == StatusHeld:
+		p.Progress.Status = StatusPending
+	default:
+		return
+	}
+
+	p.persist()
+}
+
+// Reports whether a queued process can be started. The processes of users
+// running as many jobs as they are allowed to keep their place, so do the
+// ones to be checked against the download index until their metadata are
+// retrieved.
+func (m *MessageQueue) ready(p *Process) bool {
+	// stale processes are taken out of the queue to be discarded
+	return p.stale() || (p.Progress.Status != StatusHeld && m.checkable(p) && m.quotas.canStart(p.Owner))
+}
+
+// Reports whether a process can be checked against the download index, if
+// it has to be
+func (m *MessageQueue) checkable(p *Process) bool {
+	if p.Force || m.index == nil || p.metadata == nil {
+		return true
+	}
+
+	select {
+	case <-p.metadata:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reports whether a user can queue more jobs, to be checked before
+// publishing them
+func (m *MessageQueue) CheckQuota(ctx context.Context, owner string, jobs int) error {
+	return m.quotas.check(ctx, owner, m.queued(owner), jobs)
+}
+
+// The limits of a user and how much of them is used
+func (m *MessageQueue) Usage(ctx context.Context, owner string) (*QuotaUsage, error) {
+	return m.quotas.Usage(ctx, owner, m.queued(owner))
+}
+
+// Change the limits of a user, nil restores the configured ones
+func (m *MessageQueue) SetQuota(ctx context.Context, owner string, limits *QuotaLimits) error {
+	if m.quotas == nil {
+		return errors.New("quotas are not available")
+	}
+
+	if err := m.quotas.SetLimits(ctx, owner, limits); err != nil {
+		return err
+	}
+
+	// the jobs held by the previous limits might be ready now
+	m.pending.Refresh(func(*Process) {})
+	return nil
+}
+
+// How many jobs of a user are waiting to be downloaded, not only the ones in
+// the queue
+func (m *MessageQueue) queued(owner string) int {
+	if m.jobs == nil {
+		return 0
+	}
+	return m.jobs.Queued(owner)
+}
+
+// Change when a waiting process is started. A nil time sends it to the queue
+// right away.
+func (m *MessageQueue) Schedule(p *Process, notBefore *time.Time) error {
+	if !waiting(p) {
+		return errors.New("process is not waiting to be started")
+	}
+
+	p.stopTimer()
+	m.pending.Remove(p.Id)
+
+	p.NotBefore = notBefore
+	m.Publish(p)
+
+	return nil
+}
+
+// Start a waiting process as soon as a download slot is free, regardless of
+// its schedule and of the download time windows.
+func (m *MessageQueue) StartNow(p *Process) error {
+	if !waiting(p) {
+		return errors.New("process is not waiting to be started")
+	}
+
+	p.stopTimer()
+	m.pending.Remove(p.Id)
+
+	p.NotBefore = nil
+	p.BypassWindow = true
+	m.Publish(p)
+
+	return m.reordered(m.pending.MoveTop(p.Id))
+}
+
+// Change the daily time windows downloads are started in.
+// An empty list lets downloads start at any time.
+func (m *MessageQueue) SetWindows(windows []string) error {
+	if err := m.windows.Set(windows); err != nil {
+		return err
+	}
+
+	slog.Info("changing download time windows", slog.Any("windows", windows))
+
+	config.Instance().DownloadWindows = windows
+	m.refreshWindows()
+
+	return nil
+}
+
+// The daily time windows downloads are started in
+func (m *MessageQueue) Windows() DownloadWindows {
+	return DownloadWindows{
+		Windows: m.windows.Get(),
+		Open:    m.windows.Open(time.Now()),
+	}
+}
+
+// Hold or release the queued processes according to the current time
+func (m *MessageQueue) refreshWindows() {
+	now := time.Now()
+
+	m.pending.Refresh(func(p *Process) {
+		if !p.stale() {
+			m.hold(p, now)
+		}
+	})
+}
+
+func (m *MessageQueue) windowWatcher() {
+	for range time.Tick(windowCheckInterval) {
+		m.refreshWindows()
+	}
+}
+
+// Pause a process, taking it out of the pending queue if it's waiting there.
+func (m *MessageQueue) Pause(p *Process) error {
+	if err := p.Pause(); err != nil {
+		return err
+	}
+
+	m.pending.Remove(p.Id)
+	return nil
+}
+
+// Resume a paused process by sending it back to the queue.
+// yt-dlp will continue the download from the partially downloaded file.
+func (m *MessageQueue) Resume(p *Process) error {
+	if p.Progress.Status != StatusPaused {
+		return errors.New("process is not paused")
+	}
+
+	// the paused yt-dlp may still be exiting, two of them would write the
+	// same file
+	if !p.waitExited(stopTimeout) {
+		return errors.New("process is still stopping, retry later")
+	}
+
+	m.Publish(p)
+	return nil
+}
+
+// Ids of the processes waiting to be downloaded, in the order they will be
+// started.
+func (m *MessageQueue) Queue() []string {
+	return m.pending.Ids()
+}
+
+// Change the priority of a pending process
+func (m *MessageQueue) SetPriority(id string, priority int) error {
+	return m.reordered(m.pending.SetPriority(id, priority))
+}
+
+// Move a pending process to the head of the queue
+func (m *MessageQueue) MoveTop(id string) error {
+	return m.reordered(m.pending.MoveTop(id))
+}
+
+// Move a pending process to the tail of the queue
+func (m *MessageQueue) MoveBottom(id string) error {
+	return m.reordered(m.pending.MoveBottom(id))
+}
+
+// Move a pending process right before another pending one
+func (m *MessageQueue) MoveBefore(id, before string) error {
+	return m.reordered(m.pending.MoveBefore(id, before))
+}
+
+// Persist the priority of a process moved in the queue
+func (m *MessageQueue) reordered(p *Process, err error) error {
+	if err != nil {
+		return err
+	}
+
+	p.persist()
+	return nil
 }
 
 func (m *MessageQueue) SetupConsumers() {
 	go m.downloadConsumer()
 	go m.metadataSubscriber()
+	go m.windowWatcher()
 }
 
-// Setup the consumer listener which subscribes to the changes to the producer
-// channel and triggers the "download" action.
+// Take processes from the pending queue, in order, and trigger the "download"
+// action as soon as a download slot is available. Held processes are
+// skipped until a download time window opens.
 func (m *MessageQueue) downloadConsumer() {
-	sem := semaphore.NewWeighted(int64(m.concurrency))
+	for {
+		m.slots.Acquire()
 
-	m.eventBus.SubscribeAsync(queueName, func(p *Process) {
-		sem.Acquire(context.Background(), 1)
-		defer sem.Release(1)
+		p := m.pending.PopReady(m.ready)
 
-		slog.Info("received process from event bus",
-			slog.String("bus", queueName),
+		slog.Info("received process from queue",
 			slog.String("consumer", "downloadConsumer"),
 			slog.String("id", p.getShortId()),
 		)
 
-		if p.Progress.Status != StatusCompleted {
-			slog.Info("started process",
-				slog.String("bus", queueName),
+		if p.stale() {
+			slog.Info("skipping process",
 				slog.String("id", p.getShortId()),
+				slog.Int("status", p.Progress.Status),
 			)
-			if p.Livestream {
-				// livestreams have higher priorty and they ignore the semaphore
-				go p.Start()
-			} else {
+			m.slots.Release()
+			continue
+		}
+
+		slog.Info("started process", slog.String("id", p.getShortId()))
+
+		m.slots.Start()
+		m.quotas.started(p.Owner)
+
+		go func() {
+			defer func() {
+				m.slots.Finish()
+				m.quotas.finished(p.Owner)
+				// the next jobs of the owner might be ready now
+				m.pending.Refresh(func(*Process) {})
+			}()
+
+			if err := m.quotas.checkBytes(context.Background(), p.Owner); err != nil {
+				p.fail(-1, err)
+				return
+			}
+
+			if m.duplicate(p) {
+				p.setDuplicate()
+				return
+			}
+
+			// it might have been stopped while its metadata was retrieved
+			if p.stale() {
+				return
+			}
+
+			m.bandwidth.add(p)
+
+			p.Start()
+			// terminated to apply a new rate limit
+			for p.restarting && !p.killed && p.Progress.Status != StatusPaused {
 				p.Start()
 			}
-		}
-	}, false)
+
+			m.bandwidth.remove(p)
+			m.index.record(p)
+			m.quotas.record(p)
+			m.scheduleRetry(p)
+		}()
+	}
+}
+
+// Reports whether a video has been downloaded before, according to the
+// download index.
+func (m *MessageQueue) Downloaded(extractor, videoId string) bool {
+	if m.index == nil {
+		return false
+	}
+
+	found, err := m.index.Contains(context.Background(), extractor, videoId)
+	if err != nil {
+		slog.Error("failed to query the download index", slog.String("err", err.Error()))
+		return false
+	}
+
+	return found
+}
+
+// Reports whether a process is going to download a video already downloaded.
+// The video id is only known once the metadata are retrieved, the process
+// isn't started before the metadata consumer is done with it.
+func (m *MessageQueue) duplicate(p *Process) bool {
+	if p.Force || m.index == nil {
+		return false
+	}
+
+	if p.Info.VideoId == "" {
+		slog.Warn("cannot check the download index without metadata",
+			slog.String("id", p.getShortId()),
+		)
+		return false
+	}
+
+	return m.Downloaded(p.Info.Extractor, p.Info.VideoId)
+}
+
+// Send a failed process back to the queue once its retry backoff has
+// elapsed, if its retry policy allows it.
+func (m *MessageQueue) scheduleRetry(p *Process) {
+	delay, ok := shouldRetry(p)
+	if !ok {
+		return
+	}
+
+	slog.Info("scheduling retry",
+		slog.String("id", p.getShortId()),
+		slog.Int("attempt", len(p.Attempts)+1),
+		slog.Duration("delay", delay),
+	)
+
+	p.retrying = true
+	p.timer = time.AfterFunc(delay, func() {
+		p.retrying = false
+		m.Publish(p)
+	})
 }
 
 // Setup the metadata consumer listener which subscribes to the changes to the
@@ -84,7 +472,13 @@ func (m *MessageQueue) metadataSubscriber() {
 	// Since there's ongoing downloads, 1 job at time seems a good compromise
 	sem := semaphore.NewWeighted(1)
 
-	m.eventBus.SubscribeAsync(queueName, func(p *Process) {
+	m.eventBus.SubscribeAsync(queueName, func(p *Process, done chan struct{}) {
+		defer func() {
+			close(done)
+			// it might be the next one to be started now
+			m.pending.Refresh(func(*Process) {})
+		}()
+
 		sem.Acquire(context.Background(), 1)
 		defer sem.Release(1)
 
@@ -110,3 +504,13 @@ func (m *MessageQueue) metadataSubscriber() {
 		}
 	}, false)
 }
+
+// Reports whether a process is waiting to be started
+func waiting(p *Process) bool {
+	switch p.Progress.Status {
+	case StatusPending, StatusScheduled, StatusHeld:
+		return !p.Livestream && !p.killed && !p.removed
+	default:
+		return false
+	}
+}
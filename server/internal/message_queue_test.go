@@ -0,0 +1,27 @@
+package internal
+
+import "testing"
+
+func TestReadyWaitsForMetadata(t *testing.T) {
+	metadata := make(chan struct{})
+
+	m := &MessageQueue{
+		index:  &DownloadIndex{},
+		quotas: NewQuotas(nil),
+		pending: queueOf(
+			&Process{Id: "a", metadata: metadata},
+			&Process{Id: "b", Force: true, metadata: make(chan struct{})},
+		),
+	}
+
+	// the first one can't be checked against the index yet: it keeps its place
+	if p := m.pending.PopReady(m.ready); p.Id != "b" {
+		t.Fatalf("PopReady() = %s, want b", p.Id)
+	}
+
+	close(metadata)
+
+	if p := m.pending.PopReady(m.ready); p.Id != "a" {
+		t.Fatalf("PopReady() = %s, want a", p.Id)
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
@@ -13,10 +14,16 @@ import (
 )
 
 type metadata struct {
-	Entries       []DownloadInfo `json:"entries"`
-	Count         int            `json:"playlist_count"`
-	PlaylistTitle string         `json:"title"`
-	Type          string         `json:"_type"`
+	Entries       []playlistEntry `json:"entries"`
+	Count         int             `json:"playlist_count"`
+	PlaylistTitle string          `json:"title"`
+	Type          string          `json:"_type"`
+}
+
+// flat playlist entries carry the extractor key as ie_key
+type playlistEntry struct {
+	DownloadInfo
+	IEKey string `json:"ie_key"`
 }
 
 func PlaylistDetect(req DownloadRequest, mq *MessageQueue, db *MemoryDB) error {
@@ -53,13 +60,25 @@ func PlaylistDetect(req DownloadRequest, mq *MessageQueue, db *MemoryDB) error {
 	}
 
 	if m.Type == "playlist" {
-		entries := slices.CompactFunc(slices.Compact(m.Entries), func(a DownloadInfo, b DownloadInfo) bool {
+		entries := slices.CompactFunc(slices.Compact(m.Entries), func(a playlistEntry, b playlistEntry) bool {
 			return a.URL == b.URL
 		})
 
 		slog.Info("playlist detected", slog.String("url", req.URL), slog.Int("count", len(entries)))
 
-		for i, meta := range entries {
+		procs := make([]*Process, 0, len(entries))
+
+		for i, entry := range entries {
+			meta := entry.DownloadInfo
+			if meta.Extractor == "" {
+				meta.Extractor = entry.IEKey
+			}
+
+			if !req.Force && mq.Downloaded(meta.Extractor, meta.VideoId) {
+				slog.Info("skipping already downloaded playlist entry", slog.String("url", meta.URL))
+				continue
+			}
+
 			// detect playlist title from metadata since each playlist entry will be
 			// treated as an individual download
 			req.Rename = strings.Replace(
@@ -77,26 +96,52 @@ func PlaylistDetect(req DownloadRequest, mq *MessageQueue, db *MemoryDB) error {
 				Progress: DownloadProgress{},
 				Output:   DownloadOutput{Filename: req.Rename},
 				Info:     meta,
-				Params:   req.Params,
+				Params:   req.DownloadParams(),
+
+				RetryPolicy: req.Retry,
+				Priority:    req.Priority,
+				RateLimit:   req.RateLimit,
+				NotBefore:   req.NotBefore,
+				Force:       req.Force,
+				Owner:       req.Owner,
+				Tags:        req.Tags,
 			}
 
 			proc.Info.URL = meta.URL
 
+			procs = append(procs, proc)
+		}
+
+		// the entries and the playlist itself
+		if err := mq.CheckQuota(context.Background(), req.Owner, len(procs)+1); err != nil {
+			return err
+		}
+
+		for _, proc := range procs {
 			time.Sleep(time.Millisecond)
 
 			db.Set(proc)
 			mq.Publish(proc)
 		}
+	} else if err := mq.CheckQuota(context.Background(), req.Owner, 1); err != nil {
+		return err
 	}
 
 	proc := &Process{
-		Url:    req.URL,
-		Params: req.Params,
+		Url:         req.URL,
+		Params:      req.DownloadParams(),
+		RetryPolicy: req.Retry,
+		Priority:    req.Priority,
+		RateLimit:   req.RateLimit,
+		NotBefore:   req.NotBefore,
+		Force:       req.Force,
+		Owner:       req.Owner,
+		Tags:        req.Tags,
 	}
 
 	db.Set(proc)
 	mq.Publish(proc)
 	slog.Info("sending new process to message queue", slog.String("url", proc.Url))
 
-	return cmd.Wait()
+	return nil
 }
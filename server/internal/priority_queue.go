@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+var errNotQueued = errors.New("process is not in the pending queue")
+
+// Ordered queue of the processes waiting to be downloaded.
+// Processes are sorted by priority, higher first. Processes sharing the same
+// priority are served in FIFO order.
+type PriorityQueue struct {
+	items []*Process
+	mu    sync.Mutex
+	cond  *sync.Cond
+}
+
+func NewPriorityQueue() *PriorityQueue {
+	q := &PriorityQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Enqueue a process after every other process with the same or a higher
+// priority. Pushing an already queued process is a no-op.
+func (q *PriorityQueue) Push(p *Process) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.indexOf(p.Id) != -1 {
+		return
+	}
+
+	q.insert(p)
+	q.cond.Broadcast()
+}
+
+// Dequeue the first process, blocking until one is available.
+func (q *PriorityQueue) Pop() *Process {
+	return q.PopReady(func(*Process) bool { return true })
+}
+
+// Dequeue the first process for which ready reports true, blocking until
+// there is one. Processes which aren't ready keep their place in the queue.
+func (q *PriorityQueue) PopReady(ready func(*Process) bool) *Process {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		i := slices.IndexFunc(q.items, ready)
+		if i != -1 {
+			p := q.items[i]
+			q.items = slices.Delete(q.items, i, i+1)
+			return p
+		}
+
+		q.cond.Wait()
+	}
+}
+
+// Call f on every queued process, then wake up the blocked consumers so
+// they can check again which processes are ready.
+func (q *PriorityQueue) Refresh(f func(*Process)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range q.items {
+		f(p)
+	}
+
+	q.cond.Broadcast()
+}
+
+// Remove a process from the queue, reporting whether it was queued.
+func (q *PriorityQueue) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexOf(id)
+	if i == -1 {
+		return false
+	}
+
+	q.items = slices.Delete(q.items, i, i+1)
+	return true
+}
+
+// Ids of the queued processes, in the order they will be served.
+// Processes stopped while waiting are left out, they will be discarded once
+// dequeued.
+func (q *PriorityQueue) Ids() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.items))
+	for _, p := range q.items {
+		if !p.stale() {
+			ids = append(ids, p.Id)
+		}
+	}
+
+	return ids
+}
+
+// Change the priority of a queued process. It's placed after the processes
+// already queued with the same priority.
+func (q *PriorityQueue) SetPriority(id string, priority int) (*Process, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, err := q.take(id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Priority = priority
+	q.insert(p)
+
+	return p, nil
+}
+
+// Move a process to the head of the queue, raising its priority to the one
+// of the current head if needed.
+func (q *PriorityQueue) MoveTop(id string) (*Process, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, err := q.take(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.items) > 0 {
+		p.Priority = max(p.Priority, q.items[0].Priority)
+	}
+
+	q.items = slices.Insert(q.items, 0, p)
+	return p, nil
+}
+
+// Move a process to the tail of the queue, lowering its priority to the one
+// of the current tail if needed.
+func (q *PriorityQueue) MoveBottom(id string) (*Process, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	p, err := q.take(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.items) > 0 {
+		p.Priority = min(p.Priority, q.items[len(q.items)-1].Priority)
+	}
+
+	q.items = append(q.items, p)
+	return p, nil
+}
+
+// Move a process right before another one, taking its priority.
+func (q *PriorityQueue) MoveBefore(id, before string) (*Process, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if id == before {
+		return nil, errors.New("cannot move a process before itself")
+	}
+
+	if q.indexOf(before) == -1 {
+		return nil, errNotQueued
+	}
+
+	p, err := q.take(id)
+	if err != nil {
+		return nil, err
+	}
+
+	i := q.indexOf(before)
+	p.Priority = q.items[i].Priority
+
+	q.items = slices.Insert(q.items, i, p)
+	return p, nil
+}
+
+// must be called with the lock held
+func (q *PriorityQueue) insert(p *Process) {
+	i := slices.IndexFunc(q.items, func(e *Process) bool {
+		return e.Priority < p.Priority
+	})
+	if i == -1 {
+		i = len(q.items)
+	}
+
+	q.items = slices.Insert(q.items, i, p)
+}
+
+// must be called with the lock held
+func (q *PriorityQueue) take(id string) (*Process, error) {
+	i := q.indexOf(id)
+	if i == -1 {
+		return nil, errNotQueued
+	}
+
+	p := q.items[i]
+	q.items = slices.Delete(q.items, i, i+1)
+
+	return p, nil
+}
+
+// must be called with the lock held
+func (q *PriorityQueue) indexOf(id string) int {
+	return slices.IndexFunc(q.items, func(e *Process) bool {
+		return e.Id == id
+	})
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+)
+
+func queueOf(processes ...*Process) *PriorityQueue {
+	q := NewPriorityQueue()
+	for _, p := range processes {
+		q.Push(p)
+	}
+	return q
+}
+
+func assertOrder(t *testing.T, q *PriorityQueue, want ...string) {
+	t.Helper()
+
+	if got := q.Ids(); !slices.Equal(got, want) {
+		t.Fatalf("queue order = %v, want %v", got, want)
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := queueOf(
+		&Process{Id: "a"},
+		&Process{Id: "b", Priority: 1},
+		&Process{Id: "c"},
+		&Process{Id: "d", Priority: 1},
+	)
+
+	assertOrder(t, q, "b", "d", "a", "c")
+
+	// pushing twice is a no-op
+	q.Push(&Process{Id: "a"})
+	assertOrder(t, q, "b", "d", "a", "c")
+
+	if p := q.Pop(); p.Id != "b" {
+		t.Fatalf("Pop() = %s, want b", p.Id)
+	}
+}
+
+func TestPriorityQueueMove(t *testing.T) {
+	q := queueOf(
+		&Process{Id: "a", Priority: 1},
+		&Process{Id: "b"},
+		&Process{Id: "c"},
+	)
+
+	if _, err := q.MoveTop("c"); err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, q, "c", "a", "b")
+
+	if _, err := q.MoveBottom("c"); err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, q, "a", "b", "c")
+
+	p, err := q.MoveBefore("c", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, q, "a", "c", "b")
+
+	if p.Priority != 0 {
+		t.Errorf("moved process priority = %d, want 0", p.Priority)
+	}
+
+	if _, err := q.SetPriority("b", 2); err != nil {
+		t.Fatal(err)
+	}
+	assertOrder(t, q, "b", "a", "c")
+
+	if _, err := q.MoveTop("missing"); err == nil {
+		t.Error("expected an error when moving a process which is not queued")
+	}
+}
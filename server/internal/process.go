@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"regexp"
 	"slices"
+	"strconv"
 	"syscall"
 
 	"os"
@@ -20,6 +21,7 @@ import (
 
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archiver"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook"
 )
 
 const downloadTemplate = `download:
@@ -41,18 +43,52 @@ const (
 	StatusDownloading
 	StatusCompleted
 	StatusErrored
+	_ // used by the web-ui for livestreams
+	StatusPaused
+	StatusScheduled // waiting for its not before time
+	StatusHeld      // waiting for a download time window to open
 )
 
+// How many lines of yt-dlp stderr are kept to describe a failure
+const maxStderrLines = 20
+
 // Process descriptor
 type Process struct {
-	Id         string
-	Url        string
-	Livestream bool
-	Params     []string
-	Info       DownloadInfo
-	Progress   DownloadProgress
-	Output     DownloadOutput
-	proc       *os.Process
+	Id           string
+	Url          string
+	Livestream   bool
+	Params       []string
+	Info         DownloadInfo
+	Progress     DownloadProgress
+	Output       DownloadOutput
+	Error        *ProcessError
+	RetryPolicy  *config.RetryPolicy // overrides the configured retry policy
+	Attempts     []Attempt
+	Priority     int        // higher priority processes are started first
+	RateLimit    string     // per process bandwidth cap, e.g. "4.2M"
+	NotBefore    *time.Time // the download isn't started before this time
+	BypassWindow bool       // start regardless of the download time windows
+	Force        bool       // download even if it's in the download index
+	Duplicate    bool       // skipped since it was in the download index
+	Owner        string     // id of the user who requested it, empty if none
+	Tags         []string   // copied to the archive entry
+	proc         *os.Process
+	timer        *time.Timer   // pending retry or scheduled start, if any
+	metadata     chan struct{} // closed once the metadata consumer is done with the last publication
+	retrying     bool          // failed, waiting for its retry backoff to elapse
+	store        *JobStore     // where state transitions are persisted, may be nil
+	events       *EventHub     // where state transitions are published, may be nil
+	lastStatus   int           // last status published to the event hub
+	exitCode     int
+	stderr       []string // last maxStderrLines lines of yt-dlp stderr
+	killed       bool
+	paused       bool          // a pause was requested, what yt-dlp prints afterwards is ignored
+	running      bool          // whether the yt-dlp process is alive
+	exited       chan struct{} // closed once the last yt-dlp process exited and was completed
+	removed      bool          // whether the process has been removed from the memoryDB
+	restarting   bool          // terminated to be started again, e.g. with a new rate limit
+	limit        int64         // rate limit in bytes/s to start yt-dlp with, 0 means unlimited
+	appliedLimit int64         // rate limit of the running yt-dlp process
 }
 
 // Starts spawns/forks a new yt-dlp process and parse its stdout.
@@ -61,6 +97,17 @@ type Process struct {
 // This approach is anyhow not perfect: quotes are not escaped properly.
 // Each process is not identified by its PID but by a UUIDv4
 func (p *Process) Start() {
+	p.restarting = false
+	p.paused = false
+
+	// a restarted process continues its current attempt
+	if len(p.Attempts) == 0 || !p.Attempts[len(p.Attempts)-1].EndedAt.IsZero() {
+		p.Attempts = append(p.Attempts, Attempt{
+			Number:    len(p.Attempts) + 1,
+			StartedAt: time.Now(),
+		})
+	}
+
 	// escape bash variable escaping and command piping, you'll never know
 	// what they might come with...
 	p.Params = slices.DeleteFunc(p.Params, func(e string) bool {
@@ -100,13 +147,19 @@ func (p *Process) Start() {
 		templateReplacer.Replace(postprocessTemplate),
 	}
 
+	params := append(baseParams, p.Params...)
+
 	// if user asked to manually override the output path...
+	// p.Params is left untouched since a process can be started more than once.
 	if !(slices.Contains(p.Params, "-P") || slices.Contains(p.Params, "--paths")) {
-		p.Params = append(p.Params, "-o")
-		p.Params = append(p.Params, fmt.Sprintf("%s/%s", out.Path, out.Filename))
+		params = append(params, "-o", fmt.Sprintf("%s/%s", out.Path, out.Filename))
 	}
 
-	params := append(baseParams, p.Params...)
+	// set last so it takes precedence over a user supplied one
+	p.appliedLimit = p.limit
+	if p.limit > 0 {
+		params = append(params, "--limit-rate", strconv.FormatInt(p.limit, 10))
+	}
 
 	slog.Info("requesting download", slog.String("url", p.Url), slog.Any("params", params))
 
@@ -116,36 +169,55 @@ func (p *Process) Start() {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		slog.Error("failed to get a stdout pipe", slog.Any("err", err))
-		panic(err)
+		p.fail(-1, err)
+		return
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		slog.Error("failed to get a stderr pipe", slog.Any("err", err))
-		panic(err)
+		p.fail(-1, err)
+		return
 	}
 
 	if err := cmd.Start(); err != nil {
 		slog.Error("failed to start yt-dlp process", slog.Any("err", err))
-		panic(err)
+		p.fail(-1, err)
+		return
 	}
 
 	p.proc = cmd.Process
+	p.running = true
+	p.exited = make(chan struct{})
+	p.exitCode = 0
+	p.stderr = nil
+	p.killed = false
+	p.Error = nil
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer func() {
 		stdout.Close()
 		p.Complete()
 		cancel()
+		close(p.exited)
 	}()
 
 	logs := make(chan []byte)
 	go produceLogs(stdout, logs)
 	go p.consumeLogs(ctx, logs)
 
-	go p.detectYtDlpErrors(stderr)
+	// stderr must be fully read before calling cmd.Wait
+	stderrDone := make(chan struct{})
+	go func() {
+		p.detectYtDlpErrors(stderr)
+		close(stderrDone)
+	}()
+	<-stderrDone
 
 	cmd.Wait()
+
+	p.running = false
+	p.exitCode = cmd.ProcessState.ExitCode()
 }
 
 func produceLogs(r io.Reader, logs chan<- []byte) {
@@ -177,7 +249,12 @@ func (p *Process) parseLogEntry(entry []byte) {
 	var progress ProgressTemplate
 	var postprocess PostprocessTemplate
 
-	if err := json.Unmarshal(entry, &progress); err == nil {
+	// a line printed after a pause or a kill mustn't revive the process
+	stopped := p.paused || p.killed
+
+	if err := json.Unmarshal(entry, &progress); err == nil && !stopped {
+		transition := p.Progress.Status != StatusDownloading
+
 		p.Progress = DownloadProgress{
 			Status:     StatusDownloading,
 			Percentage: progress.Percentage,
@@ -185,6 +262,18 @@ func (p *Process) parseLogEntry(entry []byte) {
 			ETA:        progress.Eta,
 		}
 
+		if transition {
+			p.persist()
+		}
+
+		progress := p.Progress
+		p.events.publish(Event{
+			Type:     EventProgress,
+			JobId:    p.Id,
+			Progress: &progress,
+			owner:    p.Owner,
+		})
+
 		slog.Info("progress",
 			slog.String("id", p.getShortId()),
 			slog.String("url", p.Url),
@@ -212,13 +301,45 @@ func (p *Process) detectYtDlpErrors(r io.Reader) {
 			slog.String("url", p.Url),
 			slog.String("err", scanner.Text()),
 		)
+
+		p.stderr = append(p.stderr, scanner.Text())
+		if len(p.stderr) > maxStderrLines {
+			p.stderr = p.stderr[len(p.stderr)-maxStderrLines:]
+		}
 	}
 }
 
 // Keep process in the memoryDB but marks it as complete
 // Convention: All completed processes has progress -1
 // and speed 0 bps.
+// If yt-dlp exited with a non-zero code the process is marked as errored
+// instead, unless it has been intentionally killed or paused.
 func (p *Process) Complete() {
+	// the attempt goes on once resumed, as a restarted one does: pauses
+	// mustn't use up the retries
+	if p.paused {
+		p.Progress.Status = StatusPaused
+		p.persist()
+
+		slog.Info("paused",
+			slog.String("id", p.getShortId()),
+			slog.String("url", p.Url),
+		)
+		return
+	}
+
+	// it's going to be started again right away
+	if p.restarting && !p.killed {
+		return
+	}
+
+	if p.exitCode != 0 && !p.killed {
+		p.setErrored()
+		return
+	}
+
+	p.endAttempt()
+
 	// auto archive
 	// TODO: it's not that deterministic :/
 	if p.Progress.Percentage == "" && p.Progress.Speed == 0 {
@@ -234,6 +355,8 @@ func (p *Process) Complete() {
 			Source:    p.Url,
 			Metadata:  serializedMetadata.String(),
 			CreatedAt: p.Info.CreatedAt,
+			Owner:     p.Owner,
+			Tags:      p.Tags,
 		})
 	}
 
@@ -249,6 +372,8 @@ func (p *Process) Complete() {
 		p.GetFileName(&p.Output)
 	}
 
+	p.persist()
+
 	slog.Info("finished",
 		slog.String("id", p.getShortId()),
 		slog.String("url", p.Url),
@@ -259,7 +384,65 @@ func (p *Process) Complete() {
 func (p *Process) Kill() error {
 	defer func() {
 		p.Progress.Status = StatusCompleted
+		p.persist()
 	}()
+
+	p.killed = true
+	p.stopTimer()
+
+	// not spawned yet or already exited, nothing to signal
+	if !p.running {
+		return nil
+	}
+
+	return p.terminate()
+}
+
+// Stop the download, keeping the partially downloaded file, so it can be
+// resumed later by sending the process back to the message queue.
+func (p *Process) Pause() error {
+	if p.Livestream {
+		return errors.New("livestreams cannot be paused")
+	}
+
+	switch p.Progress.Status {
+	case StatusPending, StatusDownloading, StatusErrored, StatusScheduled, StatusHeld:
+	default:
+		return errors.New("process is not waiting or downloading")
+	}
+
+	p.stopTimer()
+	p.paused = true
+	p.Progress = DownloadProgress{
+		Status:     StatusPaused,
+		Percentage: p.Progress.Percentage,
+	}
+	p.persist()
+
+	if !p.running {
+		return nil
+	}
+
+	return p.terminate()
+}
+
+// Wait until the last yt-dlp process exited and was completed, false if it
+// didn't within the timeout
+func (p *Process) waitExited(timeout time.Duration) bool {
+	if p.exited == nil {
+		return true
+	}
+
+	select {
+	case <-p.exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Send a SIGTERM to the yt-dlp process group
+func (p *Process) terminate() error {
 	// yt-dlp uses multiple child process the parent process
 	// has been spawned with setPgid = true. To properly kill
 	// all subprocesses a SIGTERM need to be sent to the correct
@@ -299,12 +482,16 @@ func (p *Process) GetFileName(o *DownloadOutput) error {
 
 func (p *Process) SetPending() {
 	// Since video's title isn't available yet, fill in with the URL.
-	p.Info = DownloadInfo{
-		URL:       p.Url,
-		Title:     p.Url,
-		CreatedAt: time.Now(),
+	// Processes sent back to the queue (e.g. resumed ones) keep their info.
+	if p.Info.Title == "" {
+		p.Info = DownloadInfo{
+			URL:       p.Url,
+			Title:     p.Url,
+			CreatedAt: time.Now(),
+		}
 	}
 	p.Progress.Status = StatusPending
+	p.persist()
 }
 
 func (p *Process) SetMetadata() error {
@@ -355,8 +542,10 @@ func (p *Process) SetMetadata() error {
 		return err
 	}
 
+	// the status is left untouched: the download might have already
+	// started (or failed) while metadata was being retrieved.
 	p.Info = info
-	p.Progress.Status = StatusPending
+	p.persist()
 
 	if err := cmd.Wait(); err != nil {
 		return errors.New(bufferedStderr.String())
@@ -365,6 +554,159 @@ func (p *Process) SetMetadata() error {
 	return nil
 }
 
+// Mark the process as completed without downloading it, since it has been
+// downloaded before.
+func (p *Process) setDuplicate() {
+	p.Duplicate = true
+	p.Progress = DownloadProgress{
+		Status:     StatusCompleted,
+		Percentage: "-1",
+	}
+	p.persist()
+
+	slog.Info("skipping already downloaded video",
+		slog.String("id", p.getShortId()),
+		slog.String("url", p.Url),
+	)
+}
+
+// Mark the process as errored, keeping the exit code and the captured stderr.
+func (p *Process) setErrored() {
+	p.Progress = DownloadProgress{
+		Status:     StatusErrored,
+		Percentage: p.Progress.Percentage,
+	}
+
+	p.Error = &ProcessError{
+		ExitCode: p.exitCode,
+		Stderr:   slices.Clone(p.stderr),
+	}
+
+	p.endAttempt()
+	p.persist()
+
+	slog.Warn("failed",
+		slog.String("id", p.getShortId()),
+		slog.String("url", p.Url),
+		slog.Int("exit_code", p.exitCode),
+	)
+}
+
+// Fill in the outcome of the current attempt
+func (p *Process) endAttempt() {
+	if len(p.Attempts) == 0 {
+		return
+	}
+
+	attempt := &p.Attempts[len(p.Attempts)-1]
+	attempt.EndedAt = time.Now()
+	attempt.ExitCode = p.exitCode
+
+	if p.Error != nil && len(p.Error.Stderr) > 0 {
+		attempt.ErrorClass = classifyError(p.Error.Stderr)
+		attempt.Error = p.Error.Stderr[len(p.Error.Stderr)-1]
+	}
+}
+
+// Cancel a pending retry or scheduled start, if any
+func (p *Process) stopTimer() {
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.retrying = false
+}
+
+// Mark the process as errored because yt-dlp couldn't be spawned at all.
+func (p *Process) fail(exitCode int, err error) {
+	p.exitCode = exitCode
+	p.stderr = []string{err.Error()}
+	p.setErrored()
+}
+
+// Reports whether a queued process has been stopped, paused or removed
+// while waiting to be started.
+func (p *Process) stale() bool {
+	if p.killed || p.removed {
+		return true
+	}
+
+	return p.Progress.Status != StatusPending && p.Progress.Status != StatusHeld
+}
+
+// Write the current state of the process to the job store, if any.
+// A status change is published to the event hub as well.
+func (p *Process) persist() {
+	p.publishState()
+
+	if p.store == nil {
+		return
+	}
+
+	if err := p.store.Save(context.Background(), p); err != nil {
+		slog.Error("failed to persist process",
+			slog.String("id", p.getShortId()),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// Publish the status of the process if it changed since the last time
+func (p *Process) publishState() {
+	if p.events == nil || p.Progress.Status == p.lastStatus {
+		return
+	}
+
+	p.lastStatus = p.Progress.Status
+
+	event := EventStateChanged
+	switch {
+	case p.Progress.Status == StatusCompleted && !p.killed:
+		event = EventCompleted
+	case p.Progress.Status == StatusErrored:
+		event = EventErrored
+	}
+
+	snapshot := p.snapshot()
+	p.events.publish(Event{
+		Type:    event,
+		JobId:   p.Id,
+		Process: &snapshot,
+		owner:   p.Owner,
+	})
+
+	// queued is only sent once, when the job is created, not when it goes
+	// back to the queue after a hold, a pause or a failed attempt
+	switch {
+	case p.Progress.Status == StatusDownloading:
+		p.notify(webhook.EventStarted)
+	case p.Progress.Status == StatusCompleted && !p.killed && !p.Duplicate:
+		p.notify(webhook.EventCompleted)
+	case p.Progress.Status == StatusErrored:
+		p.notify(webhook.EventErrored)
+	}
+}
+
+func (p *Process) snapshot() ProcessResponse {
+	return ProcessResponse{
+		Id:           p.Id,
+		Info:         p.Info,
+		Progress:     p.Progress,
+		Output:       p.Output,
+		Params:       p.Params,
+		Error:        p.Error,
+		RetryPolicy:  p.RetryPolicy,
+		Attempts:     p.Attempts,
+		Priority:     p.Priority,
+		RateLimit:    p.RateLimit,
+		NotBefore:    p.NotBefore,
+		BypassWindow: p.BypassWindow,
+		Force:        p.Force,
+		Duplicate:    p.Duplicate,
+		Owner:        p.Owner,
+		Tags:         p.Tags,
+	}
+}
+
 func (p *Process) getShortId() string { return strings.Split(p.Id, "-")[0] }
 
 func buildFilename(o *DownloadOutput) {
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPausedIsSticky(t *testing.T) {
+	p := &Process{
+		Id:       "a",
+		Progress: DownloadProgress{Status: StatusDownloading},
+		Attempts: []Attempt{{Number: 1, StartedAt: time.Now()}},
+	}
+
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	// printed by yt-dlp while it was being terminated
+	p.parseLogEntry([]byte(`{"eta":10,"percentage":"42.0%","speed":1024}`))
+	if p.Progress.Status != StatusPaused {
+		t.Fatalf("status after a late progress line = %d, want paused", p.Progress.Status)
+	}
+
+	// terminated by the SIGTERM
+	p.exitCode = 143
+	p.Complete()
+
+	if p.Progress.Status != StatusPaused || p.Error != nil {
+		t.Errorf("status after completing = %d, error %v, want paused", p.Progress.Status, p.Error)
+	}
+
+	// continued once resumed, it's not a failed attempt
+	if len(p.Attempts) != 1 || !p.Attempts[0].EndedAt.IsZero() {
+		t.Errorf("attempts after pausing = %+v, want the first one still open", p.Attempts)
+	}
+}
@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// How long the limits of a user are cached, role changes included
+const quotaCacheTTL = time.Minute
+
+// Limits of a user, zero values mean unlimited
+type QuotaLimits struct {
+	MaxConcurrent  int   `json:"max_concurrent"`
+	MaxQueued      int   `json:"max_queued"`
+	MaxBytesPerDay int64 `json:"max_bytes_per_day"`
+	DiskQuota      int64 `json:"disk_quota"`
+}
+
+// What a user is using out of its limits
+type QuotaUsage struct {
+	UserId string `json:"user_id"`
+	// admins and anonymous requests aren't limited
+	Exempt bool `json:"exempt"`
+	// the limits have been set for the user instead of the configured ones
+	Custom  bool        `json:"custom"`
+	Limits  QuotaLimits `json:"limits"`
+	Running int         `json:"running"`
+	Queued  int         `json:"queued"`
+	// downloaded in the last 24 hours
+	BytesLastDay int64 `json:"bytes_last_day"`
+	// size of the downloaded files still on disk
+	DiskUsage int64 `json:"disk_usage"`
+}
+
+// Per-user limits on the downloads. Usage is tracked from the size of the
+// downloaded files, the running jobs are only counted in memory.
+type Quotas struct {
+	db      *sql.DB
+	mu      sync.Mutex
+	running map[string]int
+	cache   map[string]quotaEntry
+}
+
+type quotaEntry struct {
+	limits QuotaLimits
+	custom bool
+	exempt bool
+	at     time.Time
+}
+
+func NewQuotas(db *sql.DB) *Quotas {
+	return &Quotas{
+		db:      db,
+		running: make(map[string]int),
+		cache:   make(map[string]quotaEntry),
+	}
+}
+
+// The configured limits, applied to the users without their own
+func DefaultQuotaLimits() (QuotaLimits, error) {
+	conf := config.Instance().Quota
+
+	bytesPerDay, err := parseRate(conf.MaxBytesPerDay)
+	if err != nil {
+		return QuotaLimits{}, fmt.Errorf("max_bytes_per_day: %w", err)
+	}
+
+	diskQuota, err := parseRate(conf.DiskQuota)
+	if err != nil {
+		return QuotaLimits{}, fmt.Errorf("disk_quota: %w", err)
+	}
+
+	return QuotaLimits{
+		MaxConcurrent:  conf.MaxConcurrent,
+		MaxQueued:      conf.MaxQueued,
+		MaxBytesPerDay: bytesPerDay,
+		DiskQuota:      diskQuota,
+	}, nil
+}
+
+// The limits of a user. Admins and the jobs without an owner are exempt.
+func (q *Quotas) limits(ctx context.Context, owner string) (quotaEntry, error) {
+	if q == nil || owner == "" {
+		return quotaEntry{exempt: true}, nil
+	}
+
+	q.mu.Lock()
+	entry, ok := q.cache[owner]
+	q.mu.Unlock()
+
+	if ok && time.Since(entry.at) < quotaCacheTTL {
+		return entry, nil
+	}
+
+	entry = quotaEntry{at: time.Now()}
+
+	if p, err := auth.Lookup(ctx, owner); err == nil && p.Role == auth.RoleAdmin {
+		entry.exempt = true
+	}
+
+	err := q.db.QueryRowContext(
+		ctx,
+		"SELECT max_concurrent, max_queued, max_bytes_per_day, disk_quota FROM quotas WHERE user_id = ?",
+		owner,
+	).Scan(
+		&entry.limits.MaxConcurrent,
+		&entry.limits.MaxQueued,
+		&entry.limits.MaxBytesPerDay,
+		&entry.limits.DiskQuota,
+	)
+
+	switch {
+	case err == nil:
+		entry.custom = true
+	case errors.Is(err, sql.ErrNoRows):
+		if entry.limits, err = DefaultQuotaLimits(); err != nil {
+			return entry, err
+		}
+	default:
+		return entry, err
+	}
+
+	q.mu.Lock()
+	q.cache[owner] = entry
+	q.mu.Unlock()
+
+	return entry, nil
+}
+
+// Set the limits of a user, nil restores the configured ones
+func (q *Quotas) SetLimits(ctx context.Context, owner string, limits *QuotaLimits) error {
+	var err error
+
+	if limits == nil {
+		_, err = q.db.ExecContext(ctx, "DELETE FROM quotas WHERE user_id = ?", owner)
+	} else {
+		if limits.MaxConcurrent < 0 || limits.MaxQueued < 0 || limits.MaxBytesPerDay < 0 || limits.DiskQuota < 0 {
+			return errors.New("limits can't be negative")
+		}
+
+		_, err = q.db.ExecContext(
+			ctx,
+			`INSERT INTO quotas (user_id, max_concurrent, max_queued, max_bytes_per_day, disk_quota)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET
+				max_concurrent = excluded.max_concurrent,
+				max_queued = excluded.max_queued,
+				max_bytes_per_day = excluded.max_bytes_per_day,
+				disk_quota = excluded.disk_quota`,
+			owner,
+			limits.MaxConcurrent,
+			limits.MaxQueued,
+			limits.MaxBytesPerDay,
+			limits.DiskQuota,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	delete(q.cache, owner)
+	q.mu.Unlock()
+
+	return nil
+}
+
+// The usage of a user given how many of its jobs are queued
+func (q *Quotas) Usage(ctx context.Context, owner string, queued int) (*QuotaUsage, error) {
+	entry, err := q.limits(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{
+		UserId: owner,
+		Exempt: entry.exempt,
+		Custom: entry.custom,
+		Limits: entry.limits,
+		Queued: queued,
+	}
+
+	if q == nil || owner == "" {
+		return usage, nil
+	}
+
+	q.mu.Lock()
+	usage.Running = q.running[owner]
+	q.mu.Unlock()
+
+	if usage.BytesLastDay, err = q.downloaded(ctx, owner); err != nil {
+		return nil, err
+	}
+
+	if usage.DiskUsage, err = q.diskUsage(ctx, owner); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// Reports whether more jobs can be queued by a user already having
+// queued ones waiting.
+func (q *Quotas) check(ctx context.Context, owner string, queued, jobs int) error {
+	entry, err := q.limits(ctx, owner)
+	if err != nil || entry.exempt {
+		return err
+	}
+
+	if max := entry.limits.MaxQueued; max > 0 && queued+jobs > max {
+		return fmt.Errorf("%w: at most %d jobs can be queued, %d already are", ErrQuotaExceeded, max, queued)
+	}
+
+	return q.checkBytes(ctx, owner)
+}
+
+// Reports whether a user can download anything more today and on disk
+func (q *Quotas) checkBytes(ctx context.Context, owner string) error {
+	entry, err := q.limits(ctx, owner)
+	if err != nil || entry.exempt {
+		return err
+	}
+
+	if max := entry.limits.MaxBytesPerDay; max > 0 {
+		downloaded, err := q.downloaded(ctx, owner)
+		if err != nil {
+			return err
+		}
+		if downloaded >= max {
+			return fmt.Errorf("%w: %d of %d bytes downloaded in the last 24 hours", ErrQuotaExceeded, downloaded, max)
+		}
+	}
+
+	if max := entry.limits.DiskQuota; max > 0 {
+		used, err := q.diskUsage(ctx, owner)
+		if err != nil {
+			return err
+		}
+		if used >= max {
+			return fmt.Errorf("%w: %d of %d bytes used on disk", ErrQuotaExceeded, used, max)
+		}
+	}
+
+	return nil
+}
+
+// Reports whether a job of the user can be started without exceeding its
+// concurrent jobs
+func (q *Quotas) canStart(owner string) bool {
+	entry, err := q.limits(context.Background(), owner)
+	if err != nil {
+		slog.Error("failed to load the quota", slog.String("owner", owner), slog.String("err", err.Error()))
+		return true
+	}
+
+	if entry.exempt || entry.limits.MaxConcurrent == 0 {
+		return true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.running[owner] < entry.limits.MaxConcurrent
+}
+
+func (q *Quotas) started(owner string) {
+	if q == nil || owner == "" {
+		return
+	}
+
+	q.mu.Lock()
+	q.running[owner]++
+	q.mu.Unlock()
+}
+
+func (q *Quotas) finished(owner string) {
+	if q == nil || owner == "" {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running[owner] <= 1 {
+		delete(q.running, owner)
+		return
+	}
+
+	q.running[owner]--
+}
+
+// Count the file downloaded by a completed process against the quota of
+// its owner
+func (q *Quotas) record(p *Process) {
+	if q == nil || p.Owner == "" || p.Duplicate || p.Progress.Status != StatusCompleted {
+		return
+	}
+
+	info, err := os.Stat(p.Output.SavedFilePath)
+	if err != nil {
+		return
+	}
+
+	_, err = q.db.Exec(
+		"INSERT INTO quota_usage (owner, path, size, created_at) VALUES (?, ?, ?, ?)",
+		p.Owner,
+		p.Output.SavedFilePath,
+		info.Size(),
+		time.Now(),
+	)
+	if err != nil {
+		slog.Error("failed to record the quota usage", slog.String("id", p.getShortId()), slog.String("err", err.Error()))
+	}
+}
+
+// Bytes downloaded by a user in the last 24 hours, deleted files included
+func (q *Quotas) downloaded(ctx context.Context, owner string) (int64, error) {
+	var total int64
+
+	err := q.db.QueryRowContext(
+		ctx,
+		"SELECT COALESCE(SUM(size), 0) FROM quota_usage WHERE owner = ? AND created_at >= ?",
+		owner,
+		time.Now().Add(-24*time.Hour),
+	).Scan(&total)
+
+	return total, err
+}
+
+// Current size of the files downloaded by a user. The files deleted since
+// are forgotten once they don't count for the daily limit anymore.
+func (q *Quotas) diskUsage(ctx context.Context, owner string) (int64, error) {
+	rows, err := q.db.QueryContext(ctx, "SELECT DISTINCT path FROM quota_usage WHERE owner = ?", owner)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		total   int64
+		missing []string
+	)
+
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			missing = append(missing, path)
+			continue
+		}
+
+		total += info.Size()
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range missing {
+		_, err := q.db.ExecContext(
+			ctx,
+			"DELETE FROM quota_usage WHERE owner = ? AND path = ? AND created_at < ?",
+			owner,
+			path,
+			time.Now().Add(-24*time.Hour),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuotaMaxConcurrent(t *testing.T) {
+	quotas := NewQuotas(nil)
+	quotas.cache["alice"] = quotaEntry{
+		limits: QuotaLimits{MaxConcurrent: 1},
+		at:     time.Now(),
+	}
+
+	quotas.cache["bob"] = quotaEntry{exempt: true, at: time.Now()}
+
+	m := &MessageQueue{
+		quotas: quotas,
+		pending: queueOf(
+			&Process{Id: "a1", Owner: "alice"},
+			&Process{Id: "a2", Owner: "alice"},
+			&Process{Id: "b1", Owner: "bob"},
+		),
+	}
+
+	if p := m.pending.PopReady(m.ready); p.Id != "a1" {
+		t.Fatalf("PopReady() = %s, want a1", p.Id)
+	}
+	quotas.started("alice")
+
+	// alice is running as many jobs as allowed: her next one keeps its place
+	if p := m.pending.PopReady(m.ready); p.Id != "b1" {
+		t.Fatalf("PopReady() = %s, want b1", p.Id)
+	}
+	assertOrder(t, m.pending, "a2")
+
+	quotas.finished("alice")
+
+	if p := m.pending.PopReady(m.ready); p.Id != "a2" {
+		t.Fatalf("PopReady() = %s, want a2", p.Id)
+	}
+}
+
+func TestQuotaMaxQueued(t *testing.T) {
+	quotas := NewQuotas(nil)
+	quotas.cache["alice"] = quotaEntry{
+		limits: QuotaLimits{MaxQueued: 2},
+		at:     time.Now(),
+	}
+
+	if err := quotas.check(context.Background(), "alice", 1, 1); err != nil {
+		t.Errorf("check() = %v, want nil", err)
+	}
+
+	if err := quotas.check(context.Background(), "alice", 1, 2); err == nil {
+		t.Error("check() should fail past the queued jobs limit")
+	}
+
+	// jobs without an owner are never limited
+	if err := quotas.check(context.Background(), "", 100, 100); err != nil {
+		t.Errorf("check() = %v, want nil", err)
+	}
+}
+
+func TestQuotaQueuedJobs(t *testing.T) {
+	mdb := NewMemoryDB(nil)
+
+	for id, p := range map[string]*Process{
+		"pending":     {Progress: DownloadProgress{Status: StatusPending}},
+		"held":        {Progress: DownloadProgress{Status: StatusHeld}},
+		"scheduled":   {Progress: DownloadProgress{Status: StatusScheduled}},
+		"paused":      {Progress: DownloadProgress{Status: StatusPaused}},
+		"retrying":    {Progress: DownloadProgress{Status: StatusErrored}, retrying: true},
+		"failed":      {Progress: DownloadProgress{Status: StatusErrored}},
+		"starting":    {Progress: DownloadProgress{Status: StatusPending}, running: true},
+		"downloading": {Progress: DownloadProgress{Status: StatusDownloading}, running: true},
+		"completed":   {Progress: DownloadProgress{Status: StatusCompleted}},
+		"killed":      {Progress: DownloadProgress{Status: StatusPending}, killed: true},
+	} {
+		p.Id, p.Owner = id, "alice"
+		mdb.table[id] = p
+	}
+
+	mdb.table["bob"] = &Process{Id: "bob", Owner: "bob", Progress: DownloadProgress{Status: StatusPending}}
+
+	quotas := NewQuotas(nil)
+	quotas.cache["alice"] = quotaEntry{
+		limits: QuotaLimits{MaxQueued: 6},
+		at:     time.Now(),
+	}
+
+	m := &MessageQueue{jobs: mdb, quotas: quotas, pending: NewPriorityQueue()}
+
+	if got := m.queued("alice"); got != 5 {
+		t.Errorf("queued() = %d, want 5", got)
+	}
+
+	if err := m.CheckQuota(context.Background(), "alice", 2); err == nil {
+		t.Error("CheckQuota() should count the scheduled, paused and retrying jobs")
+	}
+}
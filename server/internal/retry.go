@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+// Error classes a retry policy can be configured with
+const (
+	ErrorClassHTTP403  = "http_403"
+	ErrorClassHTTP429  = "http_429"
+	ErrorClassFragment = "fragment"
+	ErrorClassNetwork  = "network"
+)
+
+const defaultBaseBackoff = time.Second * 30
+
+// Matched against yt-dlp stderr, first match wins
+var errorClasses = []struct {
+	class string
+	re    *regexp.Regexp
+}{
+	{ErrorClassHTTP403, regexp.MustCompile(`HTTP Error 403`)},
+	{ErrorClassHTTP429, regexp.MustCompile(`HTTP Error 429`)},
+	{ErrorClassFragment, regexp.MustCompile(`(?i)fragment`)},
+	{ErrorClassNetwork, regexp.MustCompile(
+		`(?i)connection (reset|refused|aborted)|timed out|name resolution|network is unreachable|remote ?disconnected|incompleteread`,
+	)},
+}
+
+// Record of a single execution of yt-dlp
+type Attempt struct {
+	Number     int       `json:"number"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+	ExitCode   int       `json:"exit_code"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Detect the class of error from the captured yt-dlp stderr lines.
+// Lines are scanned starting from the last one, which is usually the
+// most relevant.
+func classifyError(stderr []string) string {
+	for _, line := range slices.Backward(stderr) {
+		for _, c := range errorClasses {
+			if c.re.MatchString(line) {
+				return c.class
+			}
+		}
+	}
+	return ""
+}
+
+// Compute the delay before the given attempt (starting from 2) following an
+// exponential backoff with optional jitter.
+func backoff(policy config.RetryPolicy, attempt int) time.Duration {
+	base, err := time.ParseDuration(policy.BaseBackoff)
+	if err != nil || base <= 0 {
+		base = defaultBaseBackoff
+	}
+
+	delay := float64(base) * math.Pow(2, float64(max(attempt-2, 0)))
+
+	if policy.Jitter > 0 {
+		jitter := min(policy.Jitter, 1)
+		delay += delay * jitter * (rand.Float64()*2 - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// Reports whether a failed process should be attempted again and after how
+// much time.
+func shouldRetry(p *Process) (time.Duration, bool) {
+	if p.Livestream || p.Error == nil || len(p.Attempts) == 0 {
+		return 0, false
+	}
+
+	policy := config.Instance().Retry.Merge(p.RetryPolicy)
+
+	if len(p.Attempts) >= policy.MaxAttempts {
+		return 0, false
+	}
+
+	last := p.Attempts[len(p.Attempts)-1]
+
+	if !slices.Contains(policy.RetryOn, last.ErrorClass) {
+		return 0, false
+	}
+
+	return backoff(policy, len(p.Attempts)+1), true
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string][]string{
+		ErrorClassHTTP403:  {"ERROR: unable to download video data: HTTP Error 403: Forbidden"},
+		ErrorClassHTTP429:  {"WARNING: retrying", "ERROR: HTTP Error 429: Too Many Requests"},
+		ErrorClassFragment: {"ERROR: fragment 3 not found, unable to continue"},
+		ErrorClassNetwork:  {"ERROR: [Errno 104] Connection reset by peer"},
+		"":                 {"ERROR: Unsupported URL: https://example.com"},
+	}
+
+	for want, stderr := range cases {
+		if got := classifyError(stderr); got != want {
+			t.Errorf("classifyError(%q) = %q, want %q", stderr, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := config.RetryPolicy{BaseBackoff: "10s"}
+
+	for attempt, want := range map[int]time.Duration{
+		2: time.Second * 10,
+		3: time.Second * 20,
+		4: time.Second * 40,
+	} {
+		if got := backoff(policy, attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+
+	for range 100 {
+		got := backoff(policy, 2)
+		if got < time.Second*5 || got > time.Second*15 {
+			t.Fatalf("backoff with jitter out of bounds: %s", got)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	config.Instance().Retry = config.RetryPolicy{
+		MaxAttempts: 2,
+		BaseBackoff: "1s",
+		RetryOn:     []string{ErrorClassHTTP403},
+	}
+
+	p := &Process{
+		Error:    &ProcessError{ExitCode: 1},
+		Attempts: []Attempt{{Number: 1, ErrorClass: ErrorClassHTTP403}},
+	}
+
+	if _, ok := shouldRetry(p); !ok {
+		t.Error("expected a retry after the first failed attempt")
+	}
+
+	p.Attempts = append(p.Attempts, Attempt{Number: 2, ErrorClass: ErrorClassHTTP403})
+
+	if _, ok := shouldRetry(p); ok {
+		t.Error("expected no retry once max attempts is reached")
+	}
+
+	p.RetryPolicy = &config.RetryPolicy{MaxAttempts: 5, RetryOn: []string{ErrorClassNetwork}}
+
+	if _, ok := shouldRetry(p); ok {
+		t.Error("expected no retry for an error class not in the overridden policy")
+	}
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Daily time span, in local time, during which downloads are allowed to
+// start. Written as "01:00-07:00", it can span across midnight
+// e.g. "22:00-06:00".
+type TimeWindow struct {
+	start int // minutes since midnight, inclusive
+	end   int // minutes since midnight, exclusive
+}
+
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", s)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+
+	end, err := parseClock(to)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: %w", s, err)
+	}
+
+	if start == end {
+		return TimeWindow{}, fmt.Errorf("invalid time window %q: empty span", s)
+	}
+
+	return TimeWindow{start: start, end: end}, nil
+}
+
+// Reports whether t falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+
+	// spans across midnight
+	return m >= w.start || m < w.end
+}
+
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.start/60, w.start%60, w.end/60, w.end%60)
+}
+
+// Parse "HH:MM", 24:00 is accepted as the end of the day
+func parseClock(s string) (int, error) {
+	var h, m int
+
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil {
+		return 0, errors.New("expected HH:MM")
+	}
+
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.New("time out of range")
+	}
+
+	return h*60 + m, nil
+}
+
+// The set of time windows the message queue starts downloads in.
+// No windows means downloads can always start.
+type downloadWindows struct {
+	windows []TimeWindow
+	mu      sync.RWMutex
+}
+
+func (d *downloadWindows) Set(windows []string) error {
+	parsed := make([]TimeWindow, 0, len(windows))
+
+	for _, s := range windows {
+		w, err := ParseTimeWindow(s)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, w)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.windows = parsed
+	return nil
+}
+
+func (d *downloadWindows) Get() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	windows := make([]string, len(d.windows))
+	for i, w := range d.windows {
+		windows[i] = w.String()
+	}
+
+	return windows
+}
+
+// Reports whether downloads can be started at t
+func (d *downloadWindows) Open(t time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.windows) == 0 {
+		return true
+	}
+
+	for _, w := range d.windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	night, err := ParseTimeWindow("22:30-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for tm, want := range map[time.Time]bool{
+		at(22, 29): false,
+		at(22, 30): true,
+		at(0, 0):   true,
+		at(5, 59):  true,
+		at(6, 0):   false,
+		at(12, 0):  false,
+	} {
+		if got := night.Contains(tm); got != want {
+			t.Errorf("%s contains %s = %t, want %t", night, tm.Format("15:04"), got, want)
+		}
+	}
+
+	day, err := ParseTimeWindow("08:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !day.Contains(at(23, 59)) || day.Contains(at(7, 59)) {
+		t.Errorf("unexpected result for %s", day)
+	}
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	for _, s := range []string{"", "01:00", "01:00-01:00", "25:00-01:00", "01:60-02:00", "a-b"} {
+		if _, err := ParseTimeWindow(s); err == nil {
+			t.Errorf("ParseTimeWindow(%q): expected an error", s)
+		}
+	}
+
+	w, err := ParseTimeWindow(" 1:00 - 07:05 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.String() != "01:00-07:05" {
+		t.Errorf("String() = %s, want 01:00-07:05", w)
+	}
+}
+
+func TestDownloadWindowsOpen(t *testing.T) {
+	var d downloadWindows
+
+	if !d.Open(at(12, 0)) {
+		t.Error("expected downloads to be allowed when no window is set")
+	}
+
+	if err := d.Set([]string{"01:00-07:00", "13:00-14:00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Open(at(12, 0)) || !d.Open(at(13, 30)) || !d.Open(at(2, 0)) {
+		t.Error("unexpected result with windows set")
+	}
+}
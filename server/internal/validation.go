@@ -0,0 +1,453 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+
+	archive "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive/domain"
+)
+
+// Codes of the validation errors
+const (
+	ErrCodeInvalidURL       = "invalid_url"
+	ErrCodeSchemeNotAllowed = "scheme_not_allowed"
+	ErrCodeHostNotAllowed   = "host_not_allowed"
+	ErrCodePathNotAllowed   = "path_not_allowed"
+	ErrCodeInvalidTemplate  = "invalid_template"
+	ErrCodeParamNotAllowed  = "param_not_allowed"
+	ErrCodeInvalidTag       = "invalid_tag"
+	ErrCodeInvalidRateLimit = "invalid_rate_limit"
+)
+
+// yt-dlp flags running commands, reading or writing arbitrary files or
+// changing the executable. Single letter flags are matched by their letter,
+// long ones by their abbreviations too.
+var deniedParams = []string{
+	"--exec",
+	"--exec-before-download",
+	"--config-location",
+	"--config-locations",
+	"--batch-file",
+	"-a",
+	"--load-info-json",
+	// the cookie jar is written back to the file on exit
+	"--cookies",
+	"--cookies-from-browser",
+	"--download-archive",
+	"--client-certificate",
+	"--client-certificate-key",
+	"--netrc-location",
+	"--netrc-cmd",
+	"--plugin-dirs",
+	"--alias",
+	"--use-postprocessor",
+	"--print-to-file",
+	"--cache-dir",
+	"--ffmpeg-location",
+	"--downloader",
+	"--external-downloader",
+	"--downloader-args",
+	"--external-downloader-args",
+	// ffmpeg arguments can name any input or output file
+	"--postprocessor-args",
+	"--ppa",
+	"-U",
+	"--update",
+	"--update-to",
+	// everything following it would be taken as an url
+	"--",
+}
+
+// Long flags with their value checked, and the ones named like the start of
+// a denied flag, so that e.g. --print isn't taken for --print-to-file
+var knownParams = []string{
+	"--output",
+	"--paths",
+	"--print",
+}
+
+// Single letter flags taking a value
+const valueShortParams = "oPfSrRNIaup2Ot"
+
+var defaultAllowedSchemes = []string{"http", "https"}
+
+// The server side cookies file, set through the cookies endpoint
+const CookiesFile = "cookies.txt"
+
+// Conversion types of the output template fields, as in python %-formatting
+// plus the yt-dlp specific ones
+const templateConversions = "diouxXeEfFgGcrsaBlSjhqDU"
+
+type FieldError struct {
+	Field   string `json:"field"` // e.g. "url" or "params[2]"
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Every problem found in a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+
+	for i, f := range e {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Check a download request against the configured validation policy.
+// Returns a ValidationError listing every invalid field, if any.
+// The path and the -P flags are replaced by the resolved absolute paths:
+// yt-dlp would take relative ones as relative to its working directory.
+func (req *DownloadRequest) Validate() error {
+	var errs ValidationError
+
+	if err := ValidateURL("url", req.URL); err != nil {
+		errs = append(errs, *err)
+	}
+
+	if req.Path != "" {
+		path, err := resolvePath("path", req.Path)
+		if err != nil {
+			errs = append(errs, *err)
+		}
+		req.Path = path
+	}
+
+	if req.Rename != "" {
+		if err := validateTemplate("rename", req.Rename); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+
+	// a rate limit that can't be parsed would leave the download unlimited
+	if req.RateLimit != "" {
+		if _, err := parseRate(req.RateLimit); err != nil {
+			errs = append(errs, FieldError{"rate_limit", ErrCodeInvalidRateLimit, err.Error()})
+		}
+	}
+
+	errs = append(errs, validateParams(req.Params)...)
+	errs = append(errs, validateTags(req.Tags)...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// The yt-dlp flags of a validated request, with the server side cookies file
+// if it's asked for
+func (req *DownloadRequest) DownloadParams() []string {
+	if !req.Cookies {
+		return req.Params
+	}
+	return append(slices.Clip(req.Params), "--cookies", CookiesFile)
+}
+
+func validateTags(tags []string) []FieldError {
+	if len(tags) > archive.MaxTags {
+		return []FieldError{{"tags", ErrCodeInvalidTag, fmt.Sprintf("at most %d tags", archive.MaxTags)}}
+	}
+
+	var errs []FieldError
+
+	for i, tag := range tags {
+		if _, err := archive.NormalizeTag(tag); err != nil {
+			errs = append(errs, FieldError{fmt.Sprintf("tags[%d]", i), ErrCodeInvalidTag, err.Error()})
+		}
+	}
+
+	return errs
+}
+
+// Check an url against the allowed schemes and the allowed and denied hosts.
+// A host matches its subdomains too.
+func ValidateURL(field, rawURL string) *FieldError {
+	policy := config.Instance().Validation
+
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Scheme == "" || strings.HasPrefix(rawURL, "-") {
+		return &FieldError{field, ErrCodeInvalidURL, "not a valid url"}
+	}
+
+	schemes := policy.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultAllowedSchemes
+	}
+
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return &FieldError{field, ErrCodeSchemeNotAllowed, fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+
+	// e.g. ytsearch:query
+	if u.Opaque != "" {
+		return nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return &FieldError{field, ErrCodeInvalidURL, "missing host"}
+	}
+
+	if matchHost(policy.DeniedHosts, host) {
+		return &FieldError{field, ErrCodeHostNotAllowed, fmt.Sprintf("host %q is not allowed", host)}
+	}
+
+	if len(policy.AllowedHosts) > 0 && !matchHost(policy.AllowedHosts, host) {
+		return &FieldError{field, ErrCodeHostNotAllowed, fmt.Sprintf("host %q is not allowed", host)}
+	}
+
+	return nil
+}
+
+func matchHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		h = strings.TrimSuffix(strings.ToLower(h), ".")
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// The path must resolve inside the download directory, relative paths are
+// relative to it. Returns the resolved path, the given one if invalid.
+func resolvePath(field, path string) (string, *FieldError) {
+	resolved, ok := ResolveDownloadPath(path)
+	if !ok {
+		return path, &FieldError{field, ErrCodePathNotAllowed, "must be inside the download directory"}
+	}
+	return resolved, nil
+}
+
+// Resolve a path against the download directory, following the symlinks.
+// Reports whether it's inside it.
+func ResolveDownloadPath(path string) (string, bool) {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return "", false
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+
+	path = filepath.Clean(path)
+
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path, true
+}
+
+// Check the syntax of a yt-dlp output template, e.g. "%(title)s.%(ext)s".
+// It can't climb out of the download directory.
+func validateTemplate(field, template string) *FieldError {
+	invalid := func(msg string) *FieldError {
+		return &FieldError{field, ErrCodeInvalidTemplate, msg}
+	}
+
+	if strings.ContainsAny(template, "\x00\n\r") {
+		return invalid("contains control characters")
+	}
+
+	if filepath.IsAbs(template) {
+		return invalid("must be relative to the download directory")
+	}
+
+	if slices.Contains(strings.Split(filepath.ToSlash(template), "/"), "..") {
+		return invalid(`".." is not allowed`)
+	}
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			continue
+		}
+
+		if template[i+1] == '%' {
+			i++
+			continue
+		}
+
+		if template[i+1] != '(' {
+			continue
+		}
+
+		// fields can be nested e.g. %(title&%(id)s|)s
+		depth, end := 0, -1
+		for j := i + 1; j < len(template) && end < 0; j++ {
+			switch template[j] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					end = j
+				}
+			}
+		}
+
+		if end < 0 {
+			return invalid(fmt.Sprintf("unclosed field at %d", i))
+		}
+
+		// flags, width and precision, then the conversion type
+		j := end + 1
+		for j < len(template) && strings.IndexByte("#0- +.123456789", template[j]) >= 0 {
+			j++
+		}
+
+		if j == len(template) || strings.IndexByte(templateConversions, template[j]) < 0 {
+			return invalid(fmt.Sprintf("missing conversion type of the field at %d, e.g. %%(title)s", i))
+		}
+
+		i = j
+	}
+
+	return nil
+}
+
+// Check the yt-dlp flags against the denied ones and the values of the
+// flags dealing with paths. The values of the -P flags are replaced by the
+// resolved paths.
+func validateParams(params []string) ValidationError {
+	var (
+		errs   ValidationError
+		policy = config.Instance().Validation
+	)
+
+	denied := slices.DeleteFunc(slices.Concat(deniedParams, policy.DeniedParams), func(p string) bool {
+		return slices.Contains(policy.AllowedParams, p)
+	})
+
+	for i := 0; i < len(params); i++ {
+		var (
+			param = strings.TrimSpace(params[i])
+			field = fmt.Sprintf("params[%d]", i)
+		)
+
+		if !strings.HasPrefix(param, "-") {
+			continue
+		}
+
+		var names []string
+
+		name, value, hasValue := strings.Cut(param, "=")
+
+		if strings.HasPrefix(param, "--") {
+			names = expandLongParam(name, denied)
+		} else {
+			names, value, hasValue = splitShortParams(param)
+		}
+
+		if j := slices.IndexFunc(names, func(n string) bool { return slices.Contains(denied, n) }); j >= 0 {
+			errs = append(errs, FieldError{field, ErrCodeParamNotAllowed, fmt.Sprintf("%s is not allowed", names[j])})
+			continue
+		}
+
+		isPath := slices.Contains(names, "-P") || slices.Contains(names, "--paths")
+
+		if !isPath && !slices.Contains(names, "-o") && !slices.Contains(names, "--output") {
+			continue
+		}
+
+		// what comes before the value in the param holding it e.g. --paths=
+		flag := param[:len(param)-len(value)]
+
+		if !hasValue {
+			if i+1 == len(params) {
+				continue
+			}
+			i++
+			value, flag = params[i], ""
+			field = fmt.Sprintf("params[%d]", i)
+		}
+
+		// both can be prefixed by the type of file e.g. -P temp:/tmp
+		if kind, rest, ok := strings.Cut(value, ":"); ok && isOutputType(kind) {
+			flag += kind + ":"
+			value = rest
+		}
+
+		if !isPath {
+			if err := validateTemplate(field, value); err != nil {
+				errs = append(errs, *err)
+			}
+			continue
+		}
+
+		path, err := resolvePath(field, value)
+		if err != nil {
+			errs = append(errs, *err)
+			continue
+		}
+
+		params[i] = flag + path
+	}
+
+	return errs
+}
+
+// yt-dlp takes any unambiguous abbreviation of a long flag e.g. --exec-b.
+// Returns the denied and known flags the name could stand for, an ambiguous
+// abbreviation of a denied flag is denied too.
+func expandLongParam(name string, denied []string) []string {
+	if slices.Contains(denied, name) || slices.Contains(deniedParams, name) || slices.Contains(knownParams, name) {
+		return []string{name}
+	}
+
+	var names []string
+
+	for _, p := range slices.Concat(denied, knownParams) {
+		if strings.HasPrefix(p, "--") && strings.HasPrefix(p, name) {
+			names = append(names, p)
+		}
+	}
+
+	return names
+}
+
+// Single letter flags can be grouped e.g. -xU, the first one taking a value
+// takes the rest of the group as its value e.g. -ofile
+func splitShortParams(param string) (flags []string, value string, hasValue bool) {
+	for i := 1; i < len(param); i++ {
+		flags = append(flags, "-"+param[i:i+1])
+
+		if strings.IndexByte(valueShortParams, param[i]) >= 0 {
+			return flags, param[i+1:], i+1 < len(param)
+		}
+	}
+
+	return flags, "", false
+}
+
+func isOutputType(kind string) bool {
+	if kind == "" {
+		return false
+	}
+
+	for _, r := range kind {
+		if (r < 'a' || r > 'z') && r != '_' && r != '+' {
+			return false
+		}
+	}
+
+	return true
+}
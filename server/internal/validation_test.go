@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+func TestValidateTemplate(t *testing.T) {
+	valid := []string{
+		"%(title)s.%(ext)s",
+		"%(playlist_title)s/%(playlist_index)03d - %(title).50s.%(ext)s",
+		"%(title&%(id)s|)s",
+		"100%% %(id)s",
+	}
+
+	for _, template := range valid {
+		if err := validateTemplate("rename", template); err != nil {
+			t.Errorf("%q: unexpected error %s", template, err.Message)
+		}
+	}
+
+	invalid := []string{
+		"%(title",
+		"%(title)",
+		"%(title)z",
+		"../%(title)s",
+		"/etc/%(title)s",
+		"a\nb",
+	}
+
+	for _, template := range invalid {
+		if err := validateTemplate("rename", template); err == nil {
+			t.Errorf("%q: expected an error", template)
+		}
+	}
+}
+
+func TestValidateDownloadRequest(t *testing.T) {
+	conf := config.Instance()
+	prev := *conf
+
+	conf.DownloadPath = t.TempDir()
+	conf.Validation = config.Validation{DeniedHosts: []string{"internal.lan"}}
+
+	t.Cleanup(func() { *conf = prev })
+
+	valid := DownloadRequest{
+		URL:    "https://www.youtube.com/watch?v=abc",
+		Path:   "music",
+		Rename: "%(title)s",
+		Params: []string{"-x", "-P", conf.DownloadPath + "/music", "--embed-thumbnail"},
+		Tags:   []string{"Research", "project x"},
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// yt-dlp would write relative paths under its working directory
+	if want := filepath.Join(conf.DownloadPath, "music"); valid.Path != want {
+		t.Errorf("path = %s, want %s", valid.Path, want)
+	}
+
+	// --cookies is denied, the server side file is what can be asked for
+	valid.Cookies = true
+	if got := valid.DownloadParams(); !slices.Equal(got[len(valid.Params):], []string{"--cookies", CookiesFile}) {
+		t.Errorf("DownloadParams() = %q, want the cookies file last", got)
+	}
+
+	cases := map[string]DownloadRequest{
+		"url:" + ErrCodeInvalidURL:              {URL: "--exec=id"},
+		"url:" + ErrCodeSchemeNotAllowed:        {URL: "file:///etc/passwd"},
+		"url:" + ErrCodeHostNotAllowed:          {URL: "http://nas.internal.lan/video"},
+		"path:" + ErrCodePathNotAllowed:         {URL: valid.URL, Path: "../.."},
+		"params[1]:" + ErrCodeParamNotAllowed:   {URL: valid.URL, Params: []string{"-x", "--exec=rm -rf ~"}},
+		"params[0]:" + ErrCodeParamNotAllowed:   {URL: valid.URL, Params: []string{"-afile.txt"}},
+		"params[1]:" + ErrCodePathNotAllowed:    {URL: valid.URL, Params: []string{"-P", "temp:/tmp"}},
+		"params[0]:" + ErrCodeInvalidTemplate:   {URL: valid.URL, Params: []string{"--output=/root/%(id)s"}},
+		"params[2]:" + ErrCodeInvalidTemplate:   {URL: valid.URL, Params: []string{"-x", "--outp", "/root/%(id)s"}},
+		"tags[1]:" + ErrCodeInvalidTag:          {URL: valid.URL, Tags: []string{"ok", "a,b"}},
+		"rate_limit:" + ErrCodeInvalidRateLimit: {URL: valid.URL, RateLimit: "fast"},
+	}
+
+	for want, req := range cases {
+		var verr ValidationError
+
+		if err := req.Validate(); !errors.As(err, &verr) || len(verr) != 1 {
+			t.Errorf("%s: expected a single validation error, got %v", want, err)
+			continue
+		}
+
+		if got := verr[0].Field + ":" + verr[0].Code; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	conf := config.Instance()
+	prev := *conf
+
+	conf.DownloadPath = t.TempDir()
+	conf.Validation = config.Validation{}
+
+	t.Cleanup(func() { *conf = prev })
+
+	music := filepath.Join(conf.DownloadPath, "music")
+
+	for _, test := range []struct {
+		params   []string
+		want     string   // code of the error, none if empty
+		resolved []string // the params once validated, if they are rewritten
+	}{
+		{params: []string{"--print", "title"}},
+		{params: []string{"-xk", "-fbestaudio"}},
+		{params: []string{"-ofile.%(ext)s"}},
+		{params: []string{"--pa", "music"}, resolved: []string{"--pa", music}},
+		{params: []string{"--paths=temp:music"}, resolved: []string{"--paths=temp:" + music}},
+		{params: []string{"-xPmusic"}, resolved: []string{"-xP" + music}},
+		{params: []string{"--exec-b", "id"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--exe=id"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--batch", "urls.txt"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--config-loc", "/tmp/conf"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--print-to", "title", "/tmp/out"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"-ia", "urls.txt"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"-xU"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--cookies=cookies.txt"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--cookies-from-browser", "firefox"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--download-archive", "/etc/passwd"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--ppa", "ffmpeg:-i /etc/passwd"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--postprocessor-args=-y /tmp/x"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--client-certificate-key", "/root/key.pem"}, want: ErrCodeParamNotAllowed},
+		{params: []string{"--outp", "/tmp/%(id)s"}, want: ErrCodeInvalidTemplate},
+		{params: []string{"--pat=/tmp"}, want: ErrCodePathNotAllowed},
+		{params: []string{"-xP", "/tmp"}, want: ErrCodePathNotAllowed},
+		{params: []string{"-kxo/tmp/%(id)s"}, want: ErrCodeInvalidTemplate},
+	} {
+		errs := validateParams(test.params)
+
+		var got string
+		if len(errs) > 0 {
+			got = errs[0].Code
+		}
+
+		if len(errs) > 1 || got != test.want {
+			t.Errorf("validateParams(%q) = %v, want %q", test.params, errs, test.want)
+		}
+
+		if test.resolved != nil && !slices.Equal(test.params, test.resolved) {
+			t.Errorf("params = %q, want %q", test.params, test.resolved)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook"
+)
+
+// Send a lifecycle event of the process to the webhooks.
+// The archive entry id is only sent with the archived event: a completed
+// download isn't always archived.
+func (p *Process) notify(event string) {
+	info := p.Info
+	if info.URL == "" {
+		// the metadata are yet to be fetched
+		info.URL = p.Url
+	}
+
+	m := &webhook.Message{
+		Type:          event,
+		JobId:         p.Id,
+		Info:          info,
+		SavedFilePath: p.Output.SavedFilePath,
+	}
+
+	if event == webhook.EventErrored && p.Error != nil {
+		m.Error = p.Error
+	}
+
+	webhook.Publish(m)
+}
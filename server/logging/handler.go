@@ -97,6 +97,7 @@ func ApplyRouter(logger *ObservableLogger) func(chi.Router) {
 		if config.Instance().UseOpenId {
 			r.Use(openid.Middleware)
 		}
+		r.Use(middlewares.RequireAdmin)
 		r.Get("/ws", webSocket(logger))
 		r.Get("/sse", sse(logger))
 	}
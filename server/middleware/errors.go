@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+)
+
+// Writes the response of a request rejected by a middleware
+type ErrorWriter func(w http.ResponseWriter, status int, err error)
+
+type errorWriterKey struct{}
+
+// The middlewares after it answer with the given writer, e.g. the one of an
+// API with JSON error bodies, instead of plain text
+func WithErrorWriter(f ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorWriterKey{}, f)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Write the error with the writer of the request, as plain text if none
+func WriteError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if f, ok := r.Context().Value(errorWriterKey{}).(ErrorWriter); ok {
+		f(w, status, err)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+)
+
+func TestWriteError(t *testing.T) {
+	jsonError := func(w http.ResponseWriter, status int, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+	}
+
+	handler := RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a user went past RequireAdmin")
+	}))
+
+	for name, h := range map[string]http.Handler{
+		"text/plain; charset=utf-8": handler,
+		"application/json":          WithErrorWriter(jsonError)(handler),
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Id: "u", Role: auth.RoleUser}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != name {
+			t.Errorf("got %d %s, want 403 %s", w.Code, w.Header().Get("Content-Type"), name)
+		}
+	}
+}
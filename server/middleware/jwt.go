@@ -1,16 +1,22 @@
 package middlewares
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 )
 
-func validateToken(tokenValue string) error {
+// Validate a JWT issued at login and resolve the user it was issued to.
+// The role is read again from the users table, the one in the claims is
+// only informative.
+func ValidateToken(ctx context.Context, tokenValue string) (*auth.Principal, error) {
 	token, err := jwt.Parse(tokenValue, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
@@ -18,37 +24,116 @@ func validateToken(tokenValue string) error {
 		return []byte(os.Getenv("JWT_SECRET")), nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		expiresAt, err := time.Parse(time.RFC3339, claims["expiresAt"].(string))
-		if err != nil {
-			return err
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
 
-		if time.Now().After(expiresAt) {
-			return errors.New("token expired")
-		}
-	} else {
-		return errors.New("invalid token")
+	expiration, _ := claims["expiresAt"].(string)
+
+	expiresAt, err := time.Parse(time.RFC3339, expiration)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if time.Now().After(expiresAt) {
+		return nil, errors.New("token expired")
+	}
+
+	// issued before the user accounts
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("outdated token, login again")
+	}
+
+	return auth.Lookup(ctx, sub)
 }
 
 // Authentication does NOT use http-Only cookies since there's not risk for XSS
 // By exposing the server through https it's completely safe to use httpheaders
 
+// API tokens are only accepted as "Authorization: Bearer <token>", never in
+// the query string, since they don't expire on their own.
+
 func Authenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearer, ok := BearerToken(r.Header.Get("Authorization")); ok {
+			principal, err := auth.LookupToken(r.Context(), bearer)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				WriteError(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+			return
+		}
+
 		token := r.Header.Get("X-Authentication")
 		if token == "" {
 			token = r.URL.Query().Get("token")
 		}
 
-		if err := validateToken(token); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		principal, err := ValidateToken(r.Context(), token)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// The token of an "Authorization: Bearer <token>" header value
+func BearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Rejects the requests authenticated with an API token lacking the scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := auth.RequireScope(r.Context(), scope); err != nil {
+				WriteError(w, r, http.StatusForbidden, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Rejects the requests of the non-admin users
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.RequireAdmin(r.Context()); err != nil {
+			WriteError(w, r, http.StatusForbidden, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejects the requests of read-only users, except the GET ones
+func Writable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := auth.CanWrite(r.Context()); err != nil {
+			WriteError(w, r, http.StatusForbidden, err)
 			return
 		}
 
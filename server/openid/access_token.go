@@ -0,0 +1,124 @@
+package openid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// The aud claim, a single string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+
+	*a = l
+	return nil
+}
+
+// Claims of an access token telling who it has been issued to
+type accessTokenClaims struct {
+	Active   *bool    `json:"active"` // set by introspection only
+	Subject  string   `json:"sub"`
+	Audience audience `json:"aud"`
+	ClientId string   `json:"client_id"`
+}
+
+// The token must have been issued to this client: the client id is its
+// audience or its client_id
+func (c *accessTokenClaims) check(clientId string) error {
+	if c.Active != nil && !*c.Active {
+		return fmt.Errorf("%w: inactive access token", ErrNotAuthorized)
+	}
+
+	if clientId == "" || (!slices.Contains(c.Audience, clientId) && c.ClientId != clientId) {
+		return fmt.Errorf("%w: access token not issued for this client", ErrNotAuthorized)
+	}
+
+	return nil
+}
+
+// Checks that the provider issued the access token to this client and
+// returns the subject it has been issued for, if known.
+// JWTs are verified with the keys of the provider, opaque tokens are
+// introspected.
+func checkAccessToken(ctx context.Context, token string) (string, error) {
+	var c accessTokenClaims
+
+	if strings.Count(token, ".") == 2 {
+		t, err := accessTokenVerifier.Verify(ctx, token)
+		if err != nil {
+			return "", err
+		}
+
+		if err := t.Claims(&c); err != nil {
+			return "", err
+		}
+	} else {
+		if introspectionURL == "" {
+			return "", fmt.Errorf("%w: opaque access tokens need an introspection endpoint", ErrNotAuthorized)
+		}
+
+		if err := introspect(ctx, introspectionURL, token, &c); err != nil {
+			return "", err
+		}
+	}
+
+	if err := c.check(oauth2Config.ClientID); err != nil {
+		return "", err
+	}
+
+	return c.Subject, nil
+}
+
+// RFC 7662 token introspection, authenticated with the client credentials
+func introspect(ctx context.Context, endpoint, token string, c *accessTokenClaims) error {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(oauth2Config.ClientID), url.QueryEscape(oauth2Config.ClientSecret))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("token introspection failed: %s", res.Status)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(c); err != nil {
+		return err
+	}
+
+	if c.Active == nil {
+		return errors.New("token introspection response without the active field")
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package openid
 
 import (
 	"context"
+	"slices"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
@@ -10,7 +11,12 @@ import (
 
 var (
 	oauth2Config oauth2.Config
+	provider     *oidc.Provider
 	verifier     *oidc.IDTokenVerifier
+	// the audience of access tokens is checked on its own, see checkAccessToken
+	accessTokenVerifier *oidc.IDTokenVerifier
+	// where opaque access tokens are checked, empty if the provider has none
+	introspectionURL string
 )
 
 func Configure() {
@@ -18,20 +24,43 @@ func Configure() {
 		return
 	}
 
-	provider, err := oidc.NewProvider(context.Background(), config.Instance().OpenIdProviderURL)
+	if err := validateRules(config.Instance()); err != nil {
+		panic(err)
+	}
+
+	var err error
+
+	provider, err = oidc.NewProvider(context.Background(), config.Instance().OpenIdProviderURL)
 	if err != nil {
 		panic(err)
 	}
 
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+
+	// needed by most providers to issue a refresh token
+	var discovery struct {
+		ScopesSupported       []string `json:"scopes_supported"`
+		IntrospectionEndpoint string   `json:"introspection_endpoint"`
+	}
+	if provider.Claims(&discovery) == nil && slices.Contains(discovery.ScopesSupported, oidc.ScopeOfflineAccess) {
+		scopes = append(scopes, oidc.ScopeOfflineAccess)
+	}
+
+	introspectionURL = discovery.IntrospectionEndpoint
+
 	oauth2Config = oauth2.Config{
 		ClientID:     config.Instance().OpenIdClientId,
 		ClientSecret: config.Instance().OpenIdClientSecret,
 		RedirectURL:  config.Instance().OpenIdRedirectURL,
 		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		Scopes:       scopes,
 	}
 
 	verifier = provider.Verifier(&oidc.Config{
 		ClientID: config.Instance().OpenIdClientId,
 	})
+
+	accessTokenVerifier = provider.Verifier(&oidc.Config{
+		SkipClientIDCheck: true,
+	})
 }
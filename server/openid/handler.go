@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -48,7 +49,12 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		Expires: time.Now().Add(time.Hour * 24 * 30), // XXX: change to MaxAge
 	})
 
-	http.Redirect(w, r, oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+	http.Redirect(
+		w,
+		r,
+		oauth2Config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.AccessTypeOffline),
+		http.StatusFound,
+	)
 }
 
 func doAuthentification(r *http.Request, setCookieCallback func(t *oauth2.Token)) (*OAuth2SuccessResponse, error) {
@@ -85,6 +91,16 @@ func doAuthentification(r *http.Request, setCookieCallback func(t *oauth2.Token)
 		return nil, errors.New("auth nonce does not match")
 	}
 
+	var c claims
+	if err := idToken.Claims(&c); err != nil {
+		return nil, err
+	}
+
+	// the users denied by the rules don't get any cookie
+	if _, err := principal(r.Context(), idToken.Subject, c); err != nil {
+		return nil, err
+	}
+
 	setCookieCallback(oauth2Token)
 
 	// redact
@@ -106,73 +122,102 @@ func SingIn(w http.ResponseWriter, r *http.Request) {
 	_, err := doAuthentification(r, func(t *oauth2.Token) {
 		idToken, _ := t.Extra("id_token").(string)
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "oid-token",
-			Value:    idToken,
-			HttpOnly: true,
-			Path:     "/",
-			Secure:   r.TLS != nil,
-			// MaxAge:   int(time.Hour * 24 * 30), XXX: overflows on 32 bit architectures.
-		})
+		setTokenCookie(w, r, idToken)
+
+		if t.RefreshToken == "" {
+			return
+		}
+
+		id, err := newSession(r.Context(), t.RefreshToken)
+		if err != nil {
+			slog.Error("failed to store the openid session", slog.String("err", err.Error()))
+			return
+		}
+
+		setSessionCookie(w, r, id)
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), statusCode(err))
 		return
 	}
 
 	w.Write([]byte("Login succesfully, you may now close this window and refresh yt-dlp-webui."))
 }
 
+// Renew the id token with the refresh token of the session. The middleware
+// already does it once the token expires, this lets clients do it ahead.
+// The tokens never leave the server, only their expiration is returned.
 func Refresh(w http.ResponseWriter, r *http.Request) {
-	refreshToken := r.URL.Query().Get("refresh-token")
-
-	ts := oauth2Config.TokenSource(r.Context(), &oauth2.Token{RefreshToken: refreshToken})
+	session, err := r.Cookie(sessionCookie)
+	if err != nil {
+		http.Error(w, errNoSession.Error(), http.StatusUnauthorized)
+		return
+	}
 
-	token, err := ts.Token()
+	token, err := refreshSession(r.Context(), session.Value)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oid-token",
-		Value:    token.AccessToken,
-		HttpOnly: true,
-		Path:     "/",
-		Secure:   r.TLS != nil,
-		// MaxAge:   int(time.Hour * 24 * 30), XXX: overflows on 32 bit architectures.
-	})
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "openid field \"id_token\" not found in oauth2 token", http.StatusBadGateway)
+		return
+	}
 
-	token.AccessToken = "*redacted*"
+	if _, err := Authenticate(r.Context(), idToken, ""); err != nil {
+		http.Error(w, err.Error(), statusCode(err))
+		return
+	}
 
-	if err := json.NewEncoder(w).Encode(token); err != nil {
+	setTokenCookie(w, r, idToken)
+
+	res := map[string]time.Time{"expiry": token.Expiry}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oid-token",
-		HttpOnly: true,
-		Path:     "/",
-		Secure:   r.TLS != nil,
-		MaxAge:   -1,
-	})
+	if session, err := r.Cookie(sessionCookie); err == nil {
+		if err := deleteSession(r.Context(), session.Value); err != nil {
+			slog.Error("failed to delete the openid session", slog.String("err", err.Error()))
+		}
+	}
 
+	for _, name := range []string{"oid-token", sessionCookie, "state", "nonce"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			HttpOnly: true,
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			MaxAge:   -1,
+		})
+	}
+}
+
+func setTokenCookie(w http.ResponseWriter, r *http.Request, idToken string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "state",
+		Name:     "oid-token",
+		Value:    idToken,
 		HttpOnly: true,
 		Path:     "/",
 		Secure:   r.TLS != nil,
-		MaxAge:   -1,
+		// MaxAge:   int(time.Hour * 24 * 30), XXX: overflows on 32 bit architectures.
 	})
+}
 
+func setSessionCookie(w http.ResponseWriter, r *http.Request, id string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "nonce",
+		Name:     sessionCookie,
+		Value:    id,
 		HttpOnly: true,
 		Path:     "/",
 		Secure:   r.TLS != nil,
-		MaxAge:   -1,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(sessionMaxAge),
 	})
 }
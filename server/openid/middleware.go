@@ -1,20 +1,179 @@
 package openid
 
-import "net/http"
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"golang.org/x/oauth2"
+
+	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+)
+
+// How long the user info of an access token is cached
+const userInfoTTL = time.Minute
+
+type userInfo struct {
+	subject string
+	claims  claims
+	expires time.Time
+}
+
+var userInfoCache = struct {
+	sync.Mutex
+	entries map[[32]byte]userInfo
+}{entries: make(map[[32]byte]userInfo)}
+
+// Accepts the id token of the "oid-token" cookie, refreshing it with the
+// server side session once it expires, or a bearer token: an API token or
+// an access token issued by the provider, for machine clients.
+// The user authenticated with the JWT issued at login, if any, is kept.
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := r.Cookie("oid-token")
+		principal, err := authenticateRequest(w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			middlewares.WriteError(w, r, statusCode(err), err)
 			return
 		}
 
-		if _, err := verifier.Verify(r.Context(), token.Value); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		ctx := r.Context()
+		if auth.FromContext(ctx) == nil {
+			ctx = auth.WithPrincipal(ctx, principal)
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func authenticateRequest(w http.ResponseWriter, r *http.Request) (*auth.Principal, error) {
+	ctx := r.Context()
+
+	if _, ok := middlewares.BearerToken(r.Header.Get("Authorization")); ok {
+		return Authenticate(ctx, "", r.Header.Get("Authorization"))
+	}
+
+	cookie, err := r.Cookie("oid-token")
+	if err == nil {
+		var principal *auth.Principal
+
+		principal, err = Authenticate(ctx, cookie.Value, "")
+		if err == nil || errors.Is(err, ErrNotAuthorized) {
+			return principal, err
+		}
+	}
+
+	// missing or expired: get a new one with the refresh token
+	session, sessionErr := r.Cookie(sessionCookie)
+	if sessionErr != nil {
+		return nil, err
+	}
+
+	token, err := refreshSession(ctx, session.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("openid field \"id_token\" not found in oauth2 token")
+	}
+
+	setTokenCookie(w, r, idToken)
+
+	return Authenticate(ctx, idToken, "")
+}
+
+// Resolve the user of an id token or, if the authorization header carries
+// a bearer token, of an API token or of an access token of the provider.
+func Authenticate(ctx context.Context, idToken, authorization string) (*auth.Principal, error) {
+	if bearer, ok := middlewares.BearerToken(authorization); ok {
+		// never sent to the provider, even if unknown or revoked
+		if strings.HasPrefix(bearer, auth.TokenPrefix) {
+			return auth.LookupToken(ctx, bearer)
+		}
+		return authenticateAccessToken(ctx, bearer)
+	}
+
+	if idToken == "" {
+		return nil, errors.New("missing oid-token")
+	}
+
+	token, err := verifier.Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var c claims
+	if err := token.Claims(&c); err != nil {
+		return nil, err
+	}
+
+	return principal(ctx, token.Subject, c)
+}
+
+// Access tokens must have been issued to this client, the claims of their
+// user come from the user info endpoint of the provider.
+func authenticateAccessToken(ctx context.Context, token string) (*auth.Principal, error) {
+	key := sha256.Sum256([]byte(token))
+
+	userInfoCache.Lock()
+	info, ok := userInfoCache.entries[key]
+	userInfoCache.Unlock()
+
+	if !ok || time.Now().After(info.expires) {
+		subject, err := checkAccessToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+		if err != nil {
+			return nil, err
+		}
+
+		if subject != "" && res.Subject != subject {
+			return nil, fmt.Errorf("%w: access token issued for another subject", ErrNotAuthorized)
+		}
+
+		info = userInfo{subject: res.Subject, expires: time.Now().Add(userInfoTTL)}
+		if err := res.Claims(&info.claims); err != nil {
+			return nil, err
+		}
+
+		userInfoCache.Lock()
+		for k, v := range userInfoCache.entries {
+			if time.Now().After(v.expires) {
+				delete(userInfoCache.entries, k)
+			}
+		}
+		userInfoCache.entries[key] = info
+		userInfoCache.Unlock()
+	}
+
+	return principal(ctx, info.subject, info.claims)
+}
+
+// The local account of a user of the provider, with the role granted by the
+// rules
+func principal(ctx context.Context, subject string, c claims) (*auth.Principal, error) {
+	role, err := authorize(c, config.Instance())
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.Provision(ctx, subject, c.username(subject), role)
+}
+
+func statusCode(err error) int {
+	if errors.Is(err, ErrNotAuthorized) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,64 @@
+package openid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+)
+
+func TestAuthenticateAPIToken(t *testing.T) {
+	errRevoked := errors.New("revoked token")
+
+	auth.SetTokenLookup(func(ctx context.Context, token string) (*auth.Principal, error) {
+		return nil, errRevoked
+	})
+	t.Cleanup(func() { auth.SetTokenLookup(nil) })
+
+	// the provider isn't configured: asking it would panic
+	if _, err := Authenticate(context.Background(), "", "Bearer "+auth.TokenPrefix+"abc"); !errors.Is(err, errRevoked) {
+		t.Errorf("Authenticate() = %v, want the lookup error", err)
+	}
+}
+
+func TestIntrospectAccessToken(t *testing.T) {
+	responses := map[string]string{
+		"mine":     `{"active": true, "sub": "u1", "aud": ["api", "webui"]}`,
+		"client":   `{"active": true, "sub": "u1", "client_id": "webui"}`,
+		"other":    `{"active": true, "sub": "u1", "aud": "other", "client_id": "other"}`,
+		"inactive": `{"active": false}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "webui" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(responses[r.FormValue("token")]))
+	}))
+	defer server.Close()
+
+	prev := oauth2Config
+	oauth2Config.ClientID, oauth2Config.ClientSecret = "webui", "secret"
+	t.Cleanup(func() { oauth2Config = prev })
+
+	for token, authorized := range map[string]bool{
+		"mine":     true,
+		"client":   true,
+		"other":    false,
+		"inactive": false,
+	} {
+		var c accessTokenClaims
+
+		if err := introspect(context.Background(), server.URL, token, &c); err != nil {
+			t.Fatalf("%s: %v", token, err)
+		}
+
+		if err := c.check(oauth2Config.ClientID); (err == nil) != authorized || (err != nil && !errors.Is(err, ErrNotAuthorized)) {
+			t.Errorf("%s: check() = %v, want authorized %t", token, err, authorized)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package openid
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+var ErrNotAuthorized = errors.New("not authorized by the OpenID rules")
+
+// Claims of an id token or of the user info of an access token
+type claims map[string]any
+
+// The value of a claim, nested ones are written with dots
+func (c claims) lookup(path string) any {
+	var value any = map[string]any(c)
+
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+
+	return value
+}
+
+// The name the provider knows the user by
+func (c claims) username(subject string) string {
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if s, ok := c[claim].(string); ok && s != "" {
+			return s
+		}
+	}
+	return subject
+}
+
+// Reports whether a claim is equal to the value or, if it's a list,
+// contains it
+func matches(claim any, value string) bool {
+	switch v := claim.(type) {
+	case nil:
+		return false
+	case []any:
+		return slices.ContainsFunc(v, func(item any) bool {
+			return matches(item, value)
+		})
+	case string:
+		return v == value
+	default:
+		return fmt.Sprint(v) == value
+	}
+}
+
+// The role granted by the rules of the config to a user, if any
+func authorize(c claims, conf *config.Config) (string, error) {
+	if err := checkEmail(c, conf.OpenIdAllowedDomains); err != nil {
+		return "", err
+	}
+
+	for _, rule := range conf.OpenIdRules {
+		if matches(c.lookup(rule.Claim), rule.Value) {
+			return rule.Role, nil
+		}
+	}
+
+	switch {
+	case conf.OpenIdDefaultRole != "":
+		return conf.OpenIdDefaultRole, nil
+	case len(conf.OpenIdRules) == 0:
+		return auth.RoleAdmin, nil
+	default:
+		return "", ErrNotAuthorized
+	}
+}
+
+// The email of the user must be verified and in one of the allowed domains,
+// if there are any
+func checkEmail(c claims, domains []string) error {
+	if len(domains) == 0 {
+		return nil
+	}
+
+	email, _ := c["email"].(string)
+
+	// some providers send it as a string
+	if verified := c["email_verified"]; verified != true && verified != "true" {
+		return fmt.Errorf("%w: unverified email", ErrNotAuthorized)
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return fmt.Errorf("%w: missing email", ErrNotAuthorized)
+	}
+
+	domain := strings.ToLower(email[at+1:])
+
+	for _, allowed := range domains {
+		if strings.ToLower(strings.TrimPrefix(allowed, "@")) == domain {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: email domain %s not allowed", ErrNotAuthorized, domain)
+}
+
+// Rules with an invalid role would lock their users out
+func validateRules(conf *config.Config) error {
+	for _, rule := range conf.OpenIdRules {
+		if rule.Claim == "" || !auth.ValidRole(rule.Role) {
+			return fmt.Errorf("invalid openid rule %+v", rule)
+		}
+	}
+
+	if conf.OpenIdDefaultRole != "" && !auth.ValidRole(conf.OpenIdDefaultRole) {
+		return fmt.Errorf("invalid openid_default_role %q", conf.OpenIdDefaultRole)
+	}
+
+	return nil
+}
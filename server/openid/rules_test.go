@@ -0,0 +1,50 @@
+package openid
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+)
+
+func TestAuthorize(t *testing.T) {
+	conf := &config.Config{
+		OpenIdRules: []config.OpenIdRule{
+			{Claim: "groups", Value: "media-admins", Role: "admin"},
+			{Claim: "realm_access.roles", Value: "media", Role: "user"},
+		},
+		OpenIdAllowedDomains: []string{"example.com"},
+	}
+
+	tests := []struct {
+		claims claims
+		role   string
+	}{
+		{claims{"email": "a@example.com", "email_verified": true, "groups": []any{"staff", "media-admins"}}, "admin"},
+		{claims{"email": "b@EXAMPLE.com", "email_verified": true, "realm_access": map[string]any{"roles": []any{"media"}}}, "user"},
+		{claims{"email": "c@example.com", "email_verified": "true", "groups": "media-admins"}, "admin"},
+		{claims{"email": "d@example.com", "email_verified": true, "groups": []any{"staff"}}, ""},
+		{claims{"email": "e@other.com", "email_verified": true, "groups": []any{"media-admins"}}, ""},
+		{claims{"email": "f@example.com", "email_verified": false, "groups": []any{"media-admins"}}, ""},
+		{claims{"email": "g@example.com", "groups": []any{"media-admins"}}, ""},
+		{claims{"email_verified": true, "groups": []any{"media-admins"}}, ""},
+	}
+
+	for _, tt := range tests {
+		role, err := authorize(tt.claims, conf)
+		if role != tt.role || (tt.role == "") != errors.Is(err, ErrNotAuthorized) {
+			t.Errorf("authorize(%v) = %q, %v, want %q", tt.claims, role, err, tt.role)
+		}
+	}
+
+	conf.OpenIdDefaultRole = "read-only"
+
+	if role, _ := authorize(claims{"email": "d@example.com", "email_verified": true}, conf); role != "read-only" {
+		t.Errorf("authorize() = %q, want the default role", role)
+	}
+
+	// without rules everyone is an admin, as before the rules existed
+	if role, _ := authorize(claims{}, &config.Config{}); role != "admin" {
+		t.Errorf("authorize() = %q, want admin", role)
+	}
+}
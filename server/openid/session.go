@@ -0,0 +1,139 @@
+package openid
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	sessionCookie = "oid-session"
+	// sessions not refreshed for this long are forgotten
+	sessionMaxAge = time.Hour * 24 * 30
+)
+
+var (
+	errNoSession = errors.New("openid session not found or expired")
+
+	// the refresh tokens are kept server side, the browser only gets the id
+	// of its session
+	sessionsDB *sql.DB
+	// concurrent requests of an expired session share the same refresh,
+	// providers rotating refresh tokens would reject the following ones
+	refreshGroup singleflight.Group
+)
+
+// Enable the OpenID sessions, forgetting the expired ones
+func Register(db *sql.DB) {
+	sessionsDB = db
+
+	_, err := db.Exec(
+		"DELETE FROM openid_sessions WHERE updated_at < ?",
+		time.Now().Add(-sessionMaxAge),
+	)
+	if err != nil {
+		slog.Error("failed to purge the openid sessions", slog.String("err", err.Error()))
+	}
+}
+
+// Store a refresh token, returning the id of its session
+func newSession(ctx context.Context, refreshToken string) (string, error) {
+	if sessionsDB == nil {
+		return "", errors.New("openid sessions are not available")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+
+	_, err := sessionsDB.ExecContext(
+		ctx,
+		"INSERT INTO openid_sessions (id_hash, refresh_token, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		hashSession(id),
+		refreshToken,
+		now,
+		now,
+	)
+
+	return id, err
+}
+
+// Get new tokens with the refresh token of a session. The refresh token is
+// replaced if the provider sends a new one.
+func refreshSession(ctx context.Context, id string) (*oauth2.Token, error) {
+	if sessionsDB == nil {
+		return nil, errNoSession
+	}
+
+	token, err, _ := refreshGroup.Do(id, func() (any, error) {
+		hash := hashSession(id)
+
+		var refreshToken string
+
+		err := sessionsDB.QueryRowContext(
+			ctx,
+			"SELECT refresh_token FROM openid_sessions WHERE id_hash = ? AND updated_at >= ?",
+			hash,
+			time.Now().Add(-sessionMaxAge),
+		).Scan(&refreshToken)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errNoSession
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := oauth2Config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+		if err != nil {
+			// revoked or expired on the provider side
+			deleteSession(ctx, id)
+			return nil, err
+		}
+
+		if token.RefreshToken != "" {
+			refreshToken = token.RefreshToken
+		}
+
+		_, err = sessionsDB.ExecContext(
+			ctx,
+			"UPDATE openid_sessions SET refresh_token = ?, updated_at = ? WHERE id_hash = ?",
+			refreshToken,
+			time.Now(),
+			hash,
+		)
+
+		return token, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token.(*oauth2.Token), nil
+}
+
+func deleteSession(ctx context.Context, id string) error {
+	if sessionsDB == nil {
+		return nil
+	}
+
+	_, err := sessionsDB.ExecContext(ctx, "DELETE FROM openid_sessions WHERE id_hash = ?", hashSession(id))
+	return err
+}
+
+func hashSession(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
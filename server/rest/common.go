@@ -4,10 +4,14 @@ import (
 	"database/sql"
 
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal/livestream"
 )
 
 type ContainerArgs struct {
 	DB  *sql.DB
 	MDB *internal.MemoryDB
 	MQ  *internal.MessageQueue
+	LM  *livestream.Monitor
+	// instance-wide index of the downloaded videos
+	Index *internal.DownloadIndex
 }
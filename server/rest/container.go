@@ -2,6 +2,7 @@ package rest
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
@@ -19,23 +20,73 @@ func ApplyRouter(args *ContainerArgs) func(chi.Router) {
 	h := Container(args)
 
 	return func(r chi.Router) {
+		// rejected requests get an ErrorResponse as the handlers' errors do
+		r.Use(middlewares.WithErrorWriter(writeError))
 		if config.Instance().RequireAuth {
 			r.Use(middlewares.Authenticated)
 		}
 		if config.Instance().UseOpenId {
 			r.Use(openid.Middleware)
 		}
-		r.Post("/exec", h.Exec())
-		r.Post("/execPlaylist", h.ExecPlaylist())
-		r.Post("/execLivestream", h.ExecLivestream())
-		r.Get("/running", h.Running())
-		r.Get("/version", h.GetVersion())
-		r.Get("/cookies", h.GetCookies())
-		r.Post("/cookies", h.SetCookies())
-		r.Delete("/cookies", h.DeleteCookies())
-		r.Post("/template", h.AddTemplate())
-		r.Patch("/template", h.UpdateTemplate())
-		r.Get("/template/all", h.GetTemplates())
-		r.Delete("/template/{id}", h.DeleteTemplate())
+		r.Use(middlewares.Writable)
+
+		// API tokens are limited to the routes of their scopes
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(auth.ScopeExec))
+			r.Post("/exec", h.Exec())
+			r.Post("/execPlaylist", h.ExecPlaylist())
+			r.Post("/execLivestream", h.ExecLivestream())
+			r.Post("/formats", h.Formats())
+			r.Post("/pause/{id}", h.Pause())
+			r.Post("/resume/{id}", h.Resume())
+			r.Post("/schedule/{id}", h.Schedule())
+			r.Post("/start/{id}", h.StartNow())
+			r.Post("/queue/{id}/priority", h.SetPriority())
+			r.Post("/queue/{id}/top", h.MoveTop())
+			r.Post("/queue/{id}/bottom", h.MoveBottom())
+			r.Post("/queue/{id}/before/{before}", h.MoveBefore())
+			r.Post("/template", h.AddTemplate())
+			r.Patch("/template", h.UpdateTemplate())
+			r.Delete("/template/{id}", h.DeleteTemplate())
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(auth.ScopeKill))
+			r.Post("/kill/{id}", h.Kill())
+			r.Post("/killall", h.KillAll())
+			r.Post("/clear/{id}", h.Clear())
+			r.Post("/killLivestream", h.KillLivestream())
+			r.Post("/killAllLivestream", h.KillAllLivestream())
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(auth.ScopeRead))
+			r.Get("/running", h.Running())
+			r.Get("/progress/{id}", h.Progress())
+			r.Get("/progressLivestream", h.ProgressLivestream())
+			r.Get("/windows", h.GetWindows())
+			r.Get("/queue", h.Queue())
+			r.Get("/concurrency", h.GetConcurrency())
+			r.Get("/index/export", h.ExportIndex())
+			r.Get("/version", h.GetVersion())
+			r.Get("/freespace", h.FreeSpace())
+			r.Get("/directoryTree", h.DirectoryTree())
+			r.Get("/template/all", h.GetTemplates())
+			r.Get("/usage", h.Usage())
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireAdmin)
+			r.Post("/windows", h.SetWindows())
+			r.Post("/concurrency", h.SetConcurrency())
+			r.Post("/index/import", h.ImportIndex())
+			r.Post("/updateExecutable", h.UpdateExecutable())
+			r.Get("/cookies", h.GetCookies())
+			r.Post("/cookies", h.SetCookies())
+			r.Delete("/cookies", h.DeleteCookies())
+			r.Get("/usage/{id}", h.Usage())
+			r.Put("/usage/{id}/limits", h.SetQuota())
+			r.Delete("/usage/{id}/limits", h.SetQuota())
+		})
 	}
 }
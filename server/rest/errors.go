@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal/livestream"
+)
+
+// Body of every error response of the REST API
+type ErrorResponse struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"` // e.g. "not_found"
+	Message string `json:"message"`
+	// the invalid fields of a request rejected with 422
+	Errors internal.ValidationError `json:"errors,omitempty"`
+}
+
+// Write err as an ErrorResponse. Errors about missing resources and invalid
+// requests are always sent as 404 and 422 regardless of the given status,
+// the ones about permissions as 403 and the exceeded quotas as 429.
+func writeError(w http.ResponseWriter, status int, err error) {
+	var invalid internal.ValidationError
+
+	if errors.Is(err, internal.ErrProcessNotFound) ||
+		errors.Is(err, livestream.ErrNotFound) ||
+		errors.Is(err, ErrTemplateNotFound) ||
+		errors.Is(err, ErrUserNotFound) {
+		status = http.StatusNotFound
+	}
+
+	if errors.Is(err, auth.ErrForbidden) || errors.Is(err, auth.ErrReadOnly) {
+		status = http.StatusForbidden
+	}
+
+	if errors.Is(err, internal.ErrQuotaExceeded) {
+		status = http.StatusTooManyRequests
+	}
+
+	if errors.As(err, &invalid) {
+		status = http.StatusUnprocessableEntity
+	}
+
+	res := ErrorResponse{
+		Status:  status,
+		Code:    strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		Message: err.Error(),
+		Errors:  invalid,
+	}
+
+	if invalid != nil {
+		res.Code = "validation_failed"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(res)
+}
@@ -2,9 +2,11 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
 )
 
@@ -25,17 +27,20 @@ func (h *Handler) Exec() http.HandlerFunc {
 		var req internal.DownloadRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
+			return
 		}
 
+		req.Owner = auth.Owner(r.Context())
+
 		id, err := h.service.Exec(req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(id); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -50,17 +55,20 @@ func (h *Handler) ExecPlaylist() http.HandlerFunc {
 		var req internal.DownloadRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
+			return
 		}
 
+		req.Owner = auth.Owner(r.Context())
+
 		err := h.service.ExecPlaylist(req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -75,14 +83,17 @@ func (h *Handler) ExecLivestream() http.HandlerFunc {
 		var req internal.DownloadRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
-		h.service.ExecLivestream(req)
+		if err := h.service.ExecLivestream(req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -96,12 +107,571 @@ func (h *Handler) Running() http.HandlerFunc {
 
 		res, err := h.service.Running(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(res); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Progress() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Progress(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Kill() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.Kill(r.Context(), chi.URLParam(r, "id")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) KillAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		h.service.KillAll(r.Context())
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Clear() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.Clear(r.Context(), chi.URLParam(r, "id")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Formats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.DownloadRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		req.Owner = auth.Owner(r.Context())
+
+		res, err := h.service.Formats(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) ProgressLivestream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(h.service.ProgressLivestream(r.Context())); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) KillLivestream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.DownloadRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := h.service.KillLivestream(r.Context(), req.URL); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) KillAllLivestream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.KillAllLivestream(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Pause() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.service.Pause(r.Context(), id); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Resume() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.service.Resume(r.Context(), id); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Queue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(h.service.Queue(r.Context())); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) SetPriority() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.PriorityRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		req.Id = chi.URLParam(r, "id")
+
+		if err := h.service.SetPriority(r.Context(), req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) MoveTop() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.MoveTop(r.Context(), chi.URLParam(r, "id")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) MoveBottom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.MoveBottom(r.Context(), chi.URLParam(r, "id")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) MoveBefore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		req := internal.MoveRequest{
+			Id:     chi.URLParam(r, "id"),
+			Before: chi.URLParam(r, "before"),
+		}
+
+		if err := h.service.MoveBefore(r.Context(), req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) GetConcurrency() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(h.service.Concurrency(r.Context())); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) Schedule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.ScheduleRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		req.Id = chi.URLParam(r, "id")
+
+		if err := h.service.Schedule(r.Context(), req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) StartNow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		id := chi.URLParam(r, "id")
+
+		if err := h.service.StartNow(r.Context(), id); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode("ok"); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) GetWindows() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(h.service.Windows(r.Context())); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) SetWindows() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.DownloadWindows
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		res, err := h.service.SetWindows(r.Context(), req.Windows)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) SetConcurrency() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var req internal.Concurrency
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		res, err := h.service.SetConcurrency(r.Context(), req.Size)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+// Usage of the current user, or of the one given by id
+func (h *Handler) Usage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Usage(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+// Set the limits of a user, DELETE restores the configured ones
+func (h *Handler) SetQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		var limits *internal.QuotaLimits
+
+		if r.Method != http.MethodDelete {
+			limits = &internal.QuotaLimits{}
+
+			if err := json.NewDecoder(r.Body).Decode(limits); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		res, err := h.service.SetQuota(r.Context(), chi.URLParam(r, "id"), limits)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) ExportIndex() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="download-archive.txt"`)
+
+		if err := h.service.ExportIndex(r.Context(), w); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+// Accepts a yt-dlp --download-archive file as the request body
+func (h *Handler) ImportIndex() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		imported, err := h.service.ImportIndex(r.Context(), r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(imported); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) FreeSpace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		free, err := h.service.FreeSpace(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(free); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) DirectoryTree() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		tree, err := h.service.DirectoryTree(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(tree); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+}
+
+func (h *Handler) UpdateExecutable() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.UpdateExecutable(r.Context()); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(true); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -113,7 +683,7 @@ func (h *Handler) GetCookies() http.HandlerFunc {
 
 		cookies, err := h.service.GetCookies(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -122,7 +692,7 @@ func (h *Handler) GetCookies() http.HandlerFunc {
 		}
 
 		if err := json.NewEncoder(w).Encode(res); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -137,17 +707,17 @@ func (h *Handler) SetCookies() http.HandlerFunc {
 		req := new(internal.SetCookiesRequest)
 
 		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		if err := h.service.SetCookies(r.Context(), req.Cookies); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -158,12 +728,12 @@ func (h *Handler) DeleteCookies() http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 
 		if err := h.service.SetCookies(r.Context(), ""); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -178,22 +748,22 @@ func (h *Handler) AddTemplate() http.HandlerFunc {
 		req := new(internal.CustomTemplate)
 
 		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		if req.Name == "" || req.Content == "" {
-			http.Error(w, "Invalid template", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, errors.New("invalid template"))
 			return
 		}
 
 		if err := h.service.SaveTemplate(r.Context(), req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -207,13 +777,13 @@ func (h *Handler) GetTemplates() http.HandlerFunc {
 
 		templates, err := h.service.GetTemplates(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		err = json.NewEncoder(w).Encode(templates)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 		}
 	}
 }
@@ -227,19 +797,19 @@ func (h *Handler) UpdateTemplate() http.HandlerFunc {
 		req := &internal.CustomTemplate{}
 
 		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, err)
 			return
 		}
 
 		res, err := h.service.UpdateTemplate(r.Context(), req)
 
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(res); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -254,12 +824,12 @@ func (h *Handler) DeleteTemplate() http.HandlerFunc {
 		id := chi.URLParam(r, "id")
 
 		if err := h.service.DeleteTemplate(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode("ok"); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -278,7 +848,7 @@ func (h *Handler) GetVersion() http.HandlerFunc {
 
 		rpcVersion, ytdlpVersion, err := h.service.GetVersion(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 
@@ -288,7 +858,7 @@ func (h *Handler) GetVersion() http.HandlerFunc {
 		}
 
 		if err := json.NewEncoder(w).Encode(res); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, err)
 			return
 		}
 	}
@@ -18,6 +18,8 @@ func ProvideService(args *ContainerArgs) *Service {
 			mdb: args.MDB,
 			db:  args.DB,
 			mq:  args.MQ,
+			lm:  args.LM,
+			idx: args.Index,
 		}
 	})
 	return service
@@ -5,31 +5,57 @@ import (
 	"database/sql"
 	"errors"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/formats"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal/livestream"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/sys"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/updater"
 )
 
+// Also returned to non-admins trying to change a template they don't own
+var ErrTemplateNotFound = errors.New("no template found for the given id")
+
+var ErrUserNotFound = errors.New("no user found for the given id")
+
 type Service struct {
 	mdb *internal.MemoryDB
 	db  *sql.DB
 	mq  *internal.MessageQueue
 	lm  *livestream.Monitor
+	idx *internal.DownloadIndex
 }
 
 func (s *Service) Exec(req internal.DownloadRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", err
+	}
+
+	if err := s.mq.CheckQuota(context.Background(), req.Owner, 1); err != nil {
+		return "", err
+	}
+
 	p := &internal.Process{
 		Url:    req.URL,
-		Params: req.Params,
+		Params: req.DownloadParams(),
 		Output: internal.DownloadOutput{
 			Path:     req.Path,
 			Filename: req.Rename,
 		},
+		RetryPolicy: req.Retry,
+		Priority:    req.Priority,
+		RateLimit:   req.RateLimit,
+		NotBefore:   req.NotBefore,
+		Force:       req.Force,
+		Owner:       req.Owner,
+		Tags:        req.Tags,
 	}
 
 	id := s.mdb.Set(p)
@@ -39,11 +65,20 @@ func (s *Service) Exec(req internal.DownloadRequest) (string, error) {
 }
 
 func (s *Service) ExecPlaylist(req internal.DownloadRequest) error {
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
 	return internal.PlaylistDetect(req, s.mq, s.mdb)
 }
 
-func (s *Service) ExecLivestream(req internal.DownloadRequest) {
+func (s *Service) ExecLivestream(req internal.DownloadRequest) error {
+	if err := internal.ValidateURL("url", req.URL); err != nil {
+		return internal.ValidationError{*err}
+	}
+
 	s.lm.Add(req.URL)
+	return nil
 }
 
 func (s *Service) Running(ctx context.Context) (*[]internal.ProcessResponse, error) {
@@ -51,12 +86,273 @@ func (s *Service) Running(ctx context.Context) (*[]internal.ProcessResponse, err
 	case <-ctx.Done():
 		return nil, context.Canceled
 	default:
-		return s.mdb.All(), nil
+		return s.mdb.AllOwnedBy(auth.OwnerFilter(ctx)), nil
+	}
+}
+
+// The process of the given id, if visible to the user of the request
+func (s *Service) process(ctx context.Context, id string) (*internal.Process, error) {
+	return s.mdb.GetOwnedBy(id, auth.OwnerFilter(ctx))
+}
+
+func (s *Service) Progress(ctx context.Context, id string) (internal.DownloadProgress, error) {
+	p, err := s.process(ctx, id)
+	if err != nil {
+		return internal.DownloadProgress{}, err
+	}
+
+	return p.Progress, nil
+}
+
+// Kill a process and remove it from the memory db
+func (s *Service) Kill(ctx context.Context, id string) error {
+	p, err := s.process(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Kill(); err != nil {
+		slog.Info("failed killing process", slog.String("id", id), slog.Any("err", err))
+		return err
+	}
+
+	s.mdb.Delete(id)
+	slog.Info("succesfully killed process", slog.String("id", id))
+
+	return nil
+}
+
+// Kill every process and remove them from the memory db, the ones failing to
+// be killed are removed anyway. Non-admins only kill their own.
+func (s *Service) KillAll(ctx context.Context) {
+	for _, id := range *s.mdb.Keys() {
+		p, err := s.process(ctx, id)
+		if err != nil {
+			continue
+		}
+
+		if err := p.Kill(); err != nil {
+			slog.Info("failed killing process", slog.String("id", id), slog.Any("err", err))
+		}
+
+		s.mdb.Delete(id)
+	}
+}
+
+// Remove a process from the memory db without killing it
+func (s *Service) Clear(ctx context.Context, id string) error {
+	if _, err := s.process(ctx, id); err != nil {
+		return err
+	}
+
+	s.mdb.Delete(id)
+	return nil
+}
+
+// Available formats of a resource. Playlists are sent to the download queue
+// as well.
+func (s *Service) Formats(ctx context.Context, req internal.DownloadRequest) (*formats.Metadata, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	metadata, err := formats.ParseURL(req.URL)
+	if err != nil && metadata == nil {
+		return nil, err
+	}
+
+	if metadata.IsPlaylist() {
+		go internal.PlaylistDetect(req, s.mq, s.mdb)
+	}
+
+	return metadata, nil
+}
+
+func (s *Service) ProgressLivestream(ctx context.Context) livestream.LiveStreamStatus {
+	return s.lm.Status()
+}
+
+func (s *Service) KillLivestream(ctx context.Context, url string) error {
+	slog.Info("killing livestream", slog.String("url", url))
+	return s.lm.Remove(url)
+}
+
+func (s *Service) KillAllLivestream(ctx context.Context) error {
+	return s.lm.RemoveAll()
+}
+
+func (s *Service) Pause(ctx context.Context, id string) error {
+	p, err := s.process(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.mq.Pause(p)
+}
+
+func (s *Service) Resume(ctx context.Context, id string) error {
+	p, err := s.process(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.mq.Resume(p)
+}
+
+func (s *Service) Queue(ctx context.Context) []string {
+	queue := []string{}
+
+	for _, id := range s.mq.Queue() {
+		if _, err := s.process(ctx, id); err == nil {
+			queue = append(queue, id)
+		}
+	}
+
+	return queue
+}
+
+func (s *Service) SetPriority(ctx context.Context, req internal.PriorityRequest) error {
+	if _, err := s.process(ctx, req.Id); err != nil {
+		return err
+	}
+
+	return s.mq.SetPriority(req.Id, req.Priority)
+}
+
+func (s *Service) MoveTop(ctx context.Context, id string) error {
+	if _, err := s.process(ctx, id); err != nil {
+		return err
+	}
+
+	return s.mq.MoveTop(id)
+}
+
+func (s *Service) MoveBottom(ctx context.Context, id string) error {
+	if _, err := s.process(ctx, id); err != nil {
+		return err
+	}
+
+	return s.mq.MoveBottom(id)
+}
+
+func (s *Service) MoveBefore(ctx context.Context, req internal.MoveRequest) error {
+	for _, id := range []string{req.Id, req.Before} {
+		if _, err := s.process(ctx, id); err != nil {
+			return err
+		}
 	}
+
+	return s.mq.MoveBefore(req.Id, req.Before)
+}
+
+func (s *Service) Schedule(ctx context.Context, req internal.ScheduleRequest) error {
+	p, err := s.process(ctx, req.Id)
+	if err != nil {
+		return err
+	}
+
+	return s.mq.Schedule(p, req.NotBefore)
+}
+
+func (s *Service) StartNow(ctx context.Context, id string) error {
+	p, err := s.process(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.mq.StartNow(p)
+}
+
+func (s *Service) Windows(ctx context.Context) internal.DownloadWindows {
+	return s.mq.Windows()
+}
+
+func (s *Service) SetWindows(ctx context.Context, windows []string) (internal.DownloadWindows, error) {
+	if err := s.mq.SetWindows(windows); err != nil {
+		return internal.DownloadWindows{}, err
+	}
+
+	return s.mq.Windows(), nil
+}
+
+func (s *Service) Concurrency(ctx context.Context) internal.Concurrency {
+	return s.mq.Concurrency()
+}
+
+func (s *Service) SetConcurrency(ctx context.Context, size int) (internal.Concurrency, error) {
+	if err := s.mq.SetConcurrency(size); err != nil {
+		return internal.Concurrency{}, err
+	}
+
+	return s.mq.Concurrency(), nil
+}
+
+// The quota of a user and how much of it is used. An empty id is the
+// current user.
+func (s *Service) Usage(ctx context.Context, id string) (*internal.QuotaUsage, error) {
+	if id == "" {
+		return s.mq.Usage(ctx, auth.Owner(ctx))
+	}
+
+	if _, err := auth.Lookup(ctx, id); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.mq.Usage(ctx, id)
+}
+
+// Change the limits of a user, nil restores the configured ones
+func (s *Service) SetQuota(ctx context.Context, id string, limits *internal.QuotaLimits) (*internal.QuotaUsage, error) {
+	if _, err := auth.Lookup(ctx, id); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.mq.SetQuota(ctx, id, limits); err != nil {
+		return nil, err
+	}
+
+	return s.mq.Usage(ctx, id)
+}
+
+// Write the download index in the yt-dlp --download-archive format
+func (s *Service) ExportIndex(ctx context.Context, w io.Writer) error {
+	return s.idx.Export(ctx, w)
+}
+
+// Merge a yt-dlp --download-archive file into the download index
+func (s *Service) ImportIndex(ctx context.Context, r io.Reader) (int, error) {
+	return s.idx.Import(ctx, r)
+}
+
+func (s *Service) FreeSpace(ctx context.Context) (uint64, error) {
+	return sys.FreeSpace()
+}
+
+// Flattened tree of the download directory
+func (s *Service) DirectoryTree(ctx context.Context) ([]string, error) {
+	tree, err := sys.DirectoryTree()
+	if err != nil || tree == nil {
+		return []string{}, err
+	}
+
+	return *tree, nil
+}
+
+// Update the yt-dlp binary using its builtin function
+func (s *Service) UpdateExecutable(ctx context.Context) error {
+	slog.Info("Updating yt-dlp executable to the latest release")
+
+	if err := updater.UpdateExecutable(); err != nil {
+		slog.Error("Failed updating yt-dlp", slog.String("err", err.Error()))
+		return err
+	}
+
+	slog.Info("Succesfully updated yt-dlp")
+	return nil
 }
 
 func (s *Service) GetCookies(ctx context.Context) ([]byte, error) {
-	fd, err := os.Open("cookies.txt")
+	fd, err := os.Open(internal.CookiesFile)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +368,7 @@ func (s *Service) GetCookies(ctx context.Context) ([]byte, error) {
 }
 
 func (s *Service) SetCookies(ctx context.Context, cookies string) error {
-	fd, err := os.Create("cookies.txt")
+	fd, err := os.Create(internal.CookiesFile)
 	if err != nil {
 		return err
 	}
@@ -93,15 +389,17 @@ func (s *Service) SaveTemplate(ctx context.Context, template *internal.CustomTem
 
 	_, err = conn.ExecContext(
 		ctx,
-		"INSERT INTO templates (id, name, content) VALUES (?, ?, ?)",
+		"INSERT INTO templates (id, name, content, owner) VALUES (?, ?, ?, ?)",
 		uuid.NewString(),
 		template.Name,
 		template.Content,
+		auth.Owner(ctx),
 	)
 
 	return err
 }
 
+// Non-admins get their own templates and the ones without an owner
 func (s *Service) GetTemplates(ctx context.Context) (*[]internal.CustomTemplate, error) {
 	conn, err := s.db.Conn(ctx)
 	if err != nil {
@@ -110,7 +408,14 @@ func (s *Service) GetTemplates(ctx context.Context) (*[]internal.CustomTemplate,
 
 	defer conn.Close()
 
-	rows, err := conn.QueryContext(ctx, "SELECT * FROM templates")
+	owner := auth.OwnerFilter(ctx)
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT id, name, content, owner FROM templates WHERE ? = '' OR owner IN ('', ?)",
+		owner,
+		owner,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +427,7 @@ func (s *Service) GetTemplates(ctx context.Context) (*[]internal.CustomTemplate,
 	for rows.Next() {
 		t := internal.CustomTemplate{}
 
-		err := rows.Scan(&t.Id, &t.Name, &t.Content)
+		err := rows.Scan(&t.Id, &t.Name, &t.Content, &t.Owner)
 		if err != nil {
 			return nil, err
 		}
@@ -141,11 +446,25 @@ func (s *Service) UpdateTemplate(ctx context.Context, t *internal.CustomTemplate
 
 	defer conn.Close()
 
-	_, err = conn.ExecContext(ctx, "UPDATE templates SET name = ?, content = ? WHERE id = ?", t.Name, t.Content, t.Id)
+	owner := auth.OwnerFilter(ctx)
+
+	res, err := conn.ExecContext(
+		ctx,
+		"UPDATE templates SET name = ?, content = ? WHERE id = ? AND (? = '' OR owner = ?)",
+		t.Name,
+		t.Content,
+		t.Id,
+		owner,
+		owner,
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, ErrTemplateNotFound
+	}
+
 	return t, nil
 }
 
@@ -157,9 +476,24 @@ func (s *Service) DeleteTemplate(ctx context.Context, id string) error {
 
 	defer conn.Close()
 
-	_, err = conn.ExecContext(ctx, "DELETE FROM templates WHERE id = ?", id)
+	owner := auth.OwnerFilter(ctx)
 
-	return err
+	res, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM templates WHERE id = ? AND (? = '' OR owner = ?)",
+		id,
+		owner,
+		owner,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrTemplateNotFound
+	}
+
+	return nil
 }
 
 func (s *Service) GetVersion(ctx context.Context) (string, string, error) {
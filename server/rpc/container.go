@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"context"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
@@ -12,14 +14,14 @@ import (
 // Dependency injection container.
 func Container(db *internal.MemoryDB, mq *internal.MessageQueue, lm *livestream.Monitor) *Service {
 	return &Service{
-		db: db,
-		mq: mq,
-		lm: lm,
+		db:  db,
+		mq:  mq,
+		lm:  lm,
+		ctx: context.Background(),
 	}
 }
 
-// RPC service must be registered before applying this router!
-func ApplyRouter() func(chi.Router) {
+func ApplyRouter(service *Service) func(chi.Router) {
 	return func(r chi.Router) {
 		if config.Instance().RequireAuth {
 			r.Use(middlewares.Authenticated)
@@ -27,7 +29,7 @@ func ApplyRouter() func(chi.Router) {
 		if config.Instance().UseOpenId {
 			r.Use(openid.Middleware)
 		}
-		r.Get("/ws", WebSocket)
-		r.Post("/http", Post)
+		r.Get("/ws", service.WebSocket)
+		r.Post("/http", service.Post)
 	}
 }
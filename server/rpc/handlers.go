@@ -3,6 +3,7 @@ package rpc
 import (
 	"io"
 	"net/http"
+	"net/rpc"
 
 	"github.com/gorilla/websocket"
 )
@@ -13,8 +14,15 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// The RPC server of the service acting on behalf of the user of the request
+func (s *Service) server(r *http.Request) *rpc.Server {
+	server := rpc.NewServer()
+	server.RegisterName("Service", s.forRequest(r.Context()))
+	return server
+}
+
 // WebSockets JSON-RPC handler
-func WebSocket(w http.ResponseWriter, r *http.Request) {
+func (s *Service) WebSocket(w http.ResponseWriter, r *http.Request) {
 	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -23,6 +31,8 @@ func WebSocket(w http.ResponseWriter, r *http.Request) {
 
 	defer c.Close()
 
+	server := s.server(r)
+
 	// notify client that conn is open and ok
 	c.WriteJSON(struct{ Status string }{Status: "connected"})
 
@@ -32,7 +42,7 @@ func WebSocket(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		res := newRequest(reader).Call()
+		res := newRequest(reader).Call(server)
 
 		writer, err := c.NextWriter(mtype)
 		if err != nil {
@@ -45,10 +55,10 @@ func WebSocket(w http.ResponseWriter, r *http.Request) {
 }
 
 // HTTP-POST JSON-RPC handler
-func Post(w http.ResponseWriter, r *http.Request) {
+func (s *Service) Post(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	res := newRequest(r.Body).Call()
+	res := newRequest(r.Body).Call(s.server(r))
 	_, err := io.Copy(w, res)
 
 	if err != nil {
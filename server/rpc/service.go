@@ -1,9 +1,11 @@
 package rpc
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/formats"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal/livestream"
@@ -15,6 +17,8 @@ type Service struct {
 	db *internal.MemoryDB
 	mq *internal.MessageQueue
 	lm *livestream.Monitor
+	// of the request being served, net/rpc doesn't carry one
+	ctx context.Context
 }
 
 type Running []internal.ProcessResponse
@@ -22,16 +26,73 @@ type Pending []string
 
 type NoArgs struct{}
 
+// A copy of the service acting on behalf of the user of the request
+func (s *Service) forRequest(ctx context.Context) *Service {
+	return &Service{
+		db:  s.db,
+		mq:  s.mq,
+		lm:  s.lm,
+		ctx: ctx,
+	}
+}
+
+// The process of the given id, if visible to the user
+func (s *Service) process(id string) (*internal.Process, error) {
+	return s.db.GetOwnedBy(id, auth.OwnerFilter(s.ctx))
+}
+
+// The request must have the scope, the processes of the given ids must be
+// visible to the user and, unless only reading, it must be able to act on
+// them
+func (s *Service) allowed(scope string, ids ...string) error {
+	if err := auth.RequireScope(s.ctx, scope); err != nil {
+		return err
+	}
+
+	if scope != auth.ScopeRead {
+		if err := auth.CanWrite(s.ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := s.process(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Exec spawns a Process.
 // The result of the execution is the newly spawned process Id.
 func (s *Service) Exec(args internal.DownloadRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec); err != nil {
+		return err
+	}
+
+	if err := args.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.mq.CheckQuota(s.ctx, auth.Owner(s.ctx), 1); err != nil {
+		return err
+	}
+
 	p := &internal.Process{
 		Url:    args.URL,
-		Params: args.Params,
+		Params: args.DownloadParams(),
 		Output: internal.DownloadOutput{
 			Path:     args.Path,
 			Filename: args.Rename,
 		},
+		RetryPolicy: args.Retry,
+		Priority:    args.Priority,
+		RateLimit:   args.RateLimit,
+		NotBefore:   args.NotBefore,
+		Force:       args.Force,
+		Owner:       auth.Owner(s.ctx),
+		Tags:        args.Tags,
 	}
 
 	s.db.Set(p)
@@ -44,6 +105,16 @@ func (s *Service) Exec(args internal.DownloadRequest, result *string) error {
 // Exec spawns a Process.
 // The result of the execution is the newly spawned process Id.
 func (s *Service) ExecPlaylist(args internal.DownloadRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec); err != nil {
+		return err
+	}
+
+	if err := args.Validate(); err != nil {
+		return err
+	}
+
+	args.Owner = auth.Owner(s.ctx)
+
 	err := internal.PlaylistDetect(args, s.mq, s.db)
 	if err != nil {
 		return err
@@ -55,6 +126,14 @@ func (s *Service) ExecPlaylist(args internal.DownloadRequest, result *string) er
 
 // TODO: docs
 func (s *Service) ExecLivestream(args internal.DownloadRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec); err != nil {
+		return err
+	}
+
+	if err := internal.ValidateURL("url", args.URL); err != nil {
+		return internal.ValidationError{*err}
+	}
+
 	s.lm.Add(args.URL)
 
 	*result = args.URL
@@ -63,12 +142,20 @@ func (s *Service) ExecLivestream(args internal.DownloadRequest, result *string)
 
 // TODO: docs
 func (s *Service) ProgressLivestream(args NoArgs, result *livestream.LiveStreamStatus) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
 	*result = s.lm.Status()
 	return nil
 }
 
 // TODO: docs
 func (s *Service) KillLivestream(args string, result *struct{}) error {
+	if err := s.allowed(auth.ScopeKill); err != nil {
+		return err
+	}
+
 	slog.Info("killing livestream", slog.String("url", args))
 
 	err := s.lm.Remove(args)
@@ -82,12 +169,20 @@ func (s *Service) KillLivestream(args string, result *struct{}) error {
 
 // TODO: docs
 func (s *Service) KillAllLivestream(args NoArgs, result *struct{}) error {
+	if err := s.allowed(auth.ScopeKill); err != nil {
+		return err
+	}
+
 	return s.lm.RemoveAll()
 }
 
 // Progess retrieves the Progress of a specific Process given its Id
 func (s *Service) Progess(args internal.DownloadRequest, progress *internal.DownloadProgress) error {
-	proc, err := s.db.Get(args.Id)
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	proc, err := s.process(args.Id)
 	if err != nil {
 		return err
 	}
@@ -100,12 +195,22 @@ func (s *Service) Progess(args internal.DownloadRequest, progress *internal.Down
 func (s *Service) Formats(args internal.DownloadRequest, meta *formats.Metadata) error {
 	var err error
 
+	// playlists are sent to the download queue
+	if err := s.allowed(auth.ScopeExec); err != nil {
+		return err
+	}
+
+	if err := args.Validate(); err != nil {
+		return err
+	}
+
 	metadata, err := formats.ParseURL(args.URL)
 	if err != nil && metadata == nil {
 		return err
 	}
 
 	if metadata.IsPlaylist() {
+		args.Owner = auth.Owner(s.ctx)
 		go internal.PlaylistDetect(args, s.mq, s.db)
 	}
 
@@ -115,13 +220,28 @@ func (s *Service) Formats(args internal.DownloadRequest, meta *formats.Metadata)
 
 // Pending retrieves a slice of all Pending/Running processes ids
 func (s *Service) Pending(args NoArgs, pending *Pending) error {
-	*pending = *s.db.Keys()
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	running := s.db.AllOwnedBy(auth.OwnerFilter(s.ctx))
+
+	ids := make(Pending, len(*running))
+	for i, p := range *running {
+		ids[i] = p.Id
+	}
+
+	*pending = ids
 	return nil
 }
 
 // Running retrieves a slice of all Processes progress
 func (s *Service) Running(args NoArgs, running *Running) error {
-	*running = *s.db.All()
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	*running = *s.db.AllOwnedBy(auth.OwnerFilter(s.ctx))
 	return nil
 }
 
@@ -129,6 +249,10 @@ func (s *Service) Running(args NoArgs, running *Running) error {
 func (s *Service) Kill(args string, killed *string) error {
 	slog.Info("Trying killing process with id", slog.String("id", args))
 
+	if err := s.allowed(auth.ScopeKill, args); err != nil {
+		return err
+	}
+
 	proc, err := s.db.Get(args)
 	if err != nil {
 		return err
@@ -149,13 +273,233 @@ func (s *Service) Kill(args string, killed *string) error {
 	return nil
 }
 
+// Pause stops a process keeping its partially downloaded file and its entry
+// in the memoryDB
+func (s *Service) Pause(args string, paused *string) error {
+	slog.Info("pausing process", slog.String("id", args))
+
+	if err := s.allowed(auth.ScopeExec, args); err != nil {
+		return err
+	}
+
+	proc, err := s.db.Get(args)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mq.Pause(proc); err != nil {
+		slog.Error("failed pausing process", slog.String("id", args), slog.Any("err", err))
+		return err
+	}
+
+	*paused = proc.Id
+	return nil
+}
+
+// Resume sends a paused process back to the download queue, the download
+// continues from the partially downloaded file
+func (s *Service) Resume(args string, resumed *string) error {
+	slog.Info("resuming process", slog.String("id", args))
+
+	if err := s.allowed(auth.ScopeExec, args); err != nil {
+		return err
+	}
+
+	proc, err := s.db.Get(args)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mq.Resume(proc); err != nil {
+		return err
+	}
+
+	*resumed = proc.Id
+	return nil
+}
+
+// Queue retrieves the ids of the pending processes in the order they will
+// be started
+func (s *Service) Queue(args NoArgs, queue *Pending) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	owner := auth.OwnerFilter(s.ctx)
+
+	ids := Pending{}
+	for _, id := range s.mq.Queue() {
+		if _, err := s.db.GetOwnedBy(id, owner); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	*queue = ids
+	return nil
+}
+
+// SetPriority changes the priority of a pending process
+func (s *Service) SetPriority(args internal.PriorityRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args.Id); err != nil {
+		return err
+	}
+
+	if err := s.mq.SetPriority(args.Id, args.Priority); err != nil {
+		return err
+	}
+
+	*result = args.Id
+	return nil
+}
+
+// MoveTop moves a pending process to the head of the queue
+func (s *Service) MoveTop(args string, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args); err != nil {
+		return err
+	}
+
+	if err := s.mq.MoveTop(args); err != nil {
+		return err
+	}
+
+	*result = args
+	return nil
+}
+
+// MoveBottom moves a pending process to the tail of the queue
+func (s *Service) MoveBottom(args string, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args); err != nil {
+		return err
+	}
+
+	if err := s.mq.MoveBottom(args); err != nil {
+		return err
+	}
+
+	*result = args
+	return nil
+}
+
+// MoveBefore moves a pending process right before another pending one
+func (s *Service) MoveBefore(args internal.MoveRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args.Id, args.Before); err != nil {
+		return err
+	}
+
+	if err := s.mq.MoveBefore(args.Id, args.Before); err != nil {
+		return err
+	}
+
+	*result = args.Id
+	return nil
+}
+
+// Schedule changes when a waiting process is started, a null not_before
+// sends it to the download queue right away
+func (s *Service) Schedule(args internal.ScheduleRequest, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args.Id); err != nil {
+		return err
+	}
+
+	proc, err := s.db.Get(args.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mq.Schedule(proc, args.NotBefore); err != nil {
+		return err
+	}
+
+	*result = proc.Id
+	return nil
+}
+
+// StartNow starts a scheduled or held process as soon as a download slot is
+// free, ignoring its schedule and the download time windows
+func (s *Service) StartNow(args string, result *string) error {
+	if err := s.allowed(auth.ScopeExec, args); err != nil {
+		return err
+	}
+
+	proc, err := s.db.Get(args)
+	if err != nil {
+		return err
+	}
+
+	if err := s.mq.StartNow(proc); err != nil {
+		return err
+	}
+
+	*result = proc.Id
+	return nil
+}
+
+// Windows retrieves the daily time windows downloads are started in
+func (s *Service) Windows(args NoArgs, result *internal.DownloadWindows) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	*result = s.mq.Windows()
+	return nil
+}
+
+// SetWindows changes the daily time windows downloads are started in,
+// e.g. ["01:00-07:00"]. An empty list lets downloads start at any time.
+// The change lasts until restart, download_windows in the config file is
+// the permanent setting
+func (s *Service) SetWindows(args []string, result *internal.DownloadWindows) error {
+	if err := auth.RequireAdmin(s.ctx); err != nil {
+		return err
+	}
+
+	if err := s.mq.SetWindows(args); err != nil {
+		return err
+	}
+
+	*result = s.mq.Windows()
+	return nil
+}
+
+// Concurrency retrieves the number of concurrent download slots and how many
+// of them are in use
+func (s *Service) Concurrency(args NoArgs, result *internal.Concurrency) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
+	*result = s.mq.Concurrency()
+	return nil
+}
+
+// SetConcurrency changes the number of concurrent downloads without
+// restarting: raising it starts waiting processes right away, lowering it
+// lets the running ones finish
+func (s *Service) SetConcurrency(args int, result *internal.Concurrency) error {
+	if err := auth.RequireAdmin(s.ctx); err != nil {
+		return err
+	}
+
+	if err := s.mq.SetConcurrency(args); err != nil {
+		return err
+	}
+
+	*result = s.mq.Concurrency()
+	return nil
+}
+
 // KillAll kills all process unconditionally and removes them from
-// the memory db
+// the memory db. Non-admins only kill their own.
 func (s *Service) KillAll(args NoArgs, killed *string) error {
+	if err := s.allowed(auth.ScopeKill); err != nil {
+		return err
+	}
+
 	slog.Info("Killing all spawned processes")
 
 	var (
 		keys       = s.db.Keys()
+		owner      = auth.OwnerFilter(s.ctx)
 		removeFunc = func(p *internal.Process) error {
 			defer s.db.Delete(p.Id)
 			return p.Kill()
@@ -168,6 +512,10 @@ func (s *Service) KillAll(args NoArgs, killed *string) error {
 			return err
 		}
 
+		if owner != "" && proc.Owner != owner {
+			continue
+		}
+
 		if proc == nil {
 			s.db.Delete(key)
 			continue
@@ -191,12 +539,21 @@ func (s *Service) KillAll(args NoArgs, killed *string) error {
 // Remove a process from the db rendering it unusable if active
 func (s *Service) Clear(args string, killed *string) error {
 	slog.Info("Clearing process with id", slog.String("id", args))
+
+	if err := s.allowed(auth.ScopeKill, args); err != nil {
+		return err
+	}
+
 	s.db.Delete(args)
 	return nil
 }
 
 // FreeSpace gets the available from package sys util
 func (s *Service) FreeSpace(args NoArgs, free *uint64) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
 	freeSpace, err := sys.FreeSpace()
 	if err != nil {
 		return err
@@ -208,6 +565,10 @@ func (s *Service) FreeSpace(args NoArgs, free *uint64) error {
 
 // Return a flattned tree of the download directory
 func (s *Service) DirectoryTree(args NoArgs, tree *[]string) error {
+	if err := s.allowed(auth.ScopeRead); err != nil {
+		return err
+	}
+
 	dfsTree, err := sys.DirectoryTree()
 
 	if err != nil {
@@ -224,6 +585,10 @@ func (s *Service) DirectoryTree(args NoArgs, tree *[]string) error {
 
 // Updates the yt-dlp binary using its builtin function
 func (s *Service) UpdateExecutable(args NoArgs, updated *bool) error {
+	if err := auth.RequireAdmin(s.ctx); err != nil {
+		return err
+	}
+
 	slog.Info("Updating yt-dlp executable to the latest release")
 
 	if err := updater.UpdateExecutable(); err != nil {
@@ -3,6 +3,7 @@ package rpc
 import (
 	"bytes"
 	"io"
+	"net/rpc"
 	"net/rpc/jsonrpc"
 )
 
@@ -35,8 +36,8 @@ func (r *rpcRequest) Close() error {
 	return nil
 }
 
-func (r *rpcRequest) Call() io.Reader {
-	go jsonrpc.ServeConn(r)
+func (r *rpcRequest) Call(server *rpc.Server) io.Reader {
+	go server.ServeCodec(jsonrpc.NewServerCodec(r))
 	<-r.done
 	return r.rw
 }
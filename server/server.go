@@ -10,7 +10,6 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"net/rpc"
 	"os"
 	"os/signal"
 	"strings"
@@ -21,8 +20,12 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archive"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/archiver"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/cleanup"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/dbutil"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/events"
+	ytdlpGRPC "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/grpc"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/handlers"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal/livestream"
@@ -32,6 +35,12 @@ import (
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/rest"
 	ytdlpRPC "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/rpc"
 	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/status"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook"
+	"google.golang.org/grpc"
 
 	_ "modernc.org/sqlite"
 )
@@ -48,14 +57,13 @@ type serverConfig struct {
 	db       *sql.DB
 	mq       *internal.MessageQueue
 	lm       *livestream.Monitor
+	index    *internal.DownloadIndex
 }
 
 // TODO: change scope
 var observableLogger = logging.NewObservableLogger()
 
 func RunBlocking(rc *RunConfig) {
-	mdb := internal.NewMemoryDB()
-
 	// ---- LOGGING ---------------------------------------------------
 	logWriters := []io.Writer{
 		os.Stdout,
@@ -91,7 +99,7 @@ func RunBlocking(rc *RunConfig) {
 	slog.SetDefault(logger)
 	// ----------------------------------------------------------------
 
-	db, err := sql.Open("sqlite", conf.LocalDatabasePath)
+	db, err := openDatabase()
 	if err != nil {
 		slog.Error("failed to open database", slog.String("err", err.Error()))
 	}
@@ -100,7 +108,20 @@ func RunBlocking(rc *RunConfig) {
 		slog.Error("failed to init database", slog.String("err", err.Error()))
 	}
 
-	mq, err := internal.NewMessageQueue()
+	mdb := internal.NewMemoryDB(internal.NewJobStore(db))
+
+	index := internal.NewDownloadIndex(db)
+
+	go func() {
+		added, err := index.Backfill(context.Background())
+		if err != nil {
+			slog.Error("failed to index the archive", slog.String("err", err.Error()))
+			return
+		}
+		slog.Info("indexed the archive", slog.Int("added", added))
+	}()
+
+	mq, err := internal.NewMessageQueue(mdb, index, internal.NewQuotas(db))
 	if err != nil {
 		panic(err)
 	}
@@ -111,6 +132,11 @@ func RunBlocking(rc *RunConfig) {
 	go lm.Schedule()
 	go lm.Restore()
 
+	go subscription.Schedule(context.Background(), db, mdb, mq)
+	go archive.Schedule(context.Background(), db)
+	go trash.Schedule(context.Background(), db)
+	go cleanup.Schedule(context.Background(), db)
+
 	srv := newServer(serverConfig{
 		frontend: rc.App,
 		swagger:  rc.Swagger,
@@ -118,9 +144,19 @@ func RunBlocking(rc *RunConfig) {
 		mq:       mq,
 		db:       db,
 		lm:       lm,
+		index:    index,
 	})
 
-	go gracefulShutdown(srv, mdb)
+	grpcServer := ytdlpGRPC.Container(mdb, mq)
+
+	// without a dedicated port gRPC shares the web server listener
+	if conf.GRPCPort > 0 {
+		go serveGRPC(grpcServer, conf.GRPCPort)
+	} else {
+		srv.Handler = ytdlpGRPC.Multiplex(grpcServer, srv.Handler)
+	}
+
+	go gracefulShutdown(srv, grpcServer, mdb)
 	go autoPersist(time.Minute*5, mdb, lm)
 
 	var (
@@ -147,11 +183,22 @@ func RunBlocking(rc *RunConfig) {
 	}
 }
 
+// jobs, archive and subscriptions are written concurrently: wait for the
+// lock instead of failing right away with SQLITE_BUSY
+func openDatabase() (*sql.DB, error) {
+	return sql.Open("sqlite", config.Instance().LocalDatabasePath+"?_pragma=busy_timeout(5000)")
+}
+
 func newServer(c serverConfig) *http.Server {
 	archiver.Register(c.db)
+	webhook.Register(c.db)
+	users := user.Register(c.db)
+	token.Register(c.db)
+	openid.Register(c.db)
+	_, bin := trash.Container(c.db)
+	_, archived := archive.Container(c.db)
 
 	service := ytdlpRPC.Container(c.mdb, c.mq, c.lm)
-	rpc.Register(service)
 
 	r := chi.NewRouter()
 
@@ -187,48 +234,94 @@ func newServer(c serverConfig) *http.Server {
 		if config.Instance().UseOpenId {
 			r.Use(openid.Middleware)
 		}
+		r.Use(middlewares.RequireScope(auth.ScopeFiles))
 		r.Post("/downloaded", handlers.ListDownloaded)
-		r.Post("/delete", handlers.DeleteFile)
-		r.Get("/d/{id}", handlers.DownloadFile)
-		r.Get("/v/{id}", handlers.SendFile)
+		r.With(middlewares.RequireAdmin).Post("/delete", handlers.DeleteFile(bin))
+		r.Get("/d/{id}", handlers.DownloadFile(archived))
+		r.Get("/v/{id}", handlers.SendFile(archived))
 		r.Get("/bulk", handlers.BulkDownload(c.mdb))
 	})
 
 	// Archive routes
 	r.Route("/archive", archive.ApplyRouter(c.db))
 
+	// Recycle bin routes
+	r.Route("/trash", trash.ApplyRouter(c.db))
+
+	// Cleanup policies routes
+	r.Route("/cleanup", cleanup.ApplyRouter(c.db))
+
+	// Subscriptions routes
+	r.Route("/subscriptions", subscription.ApplyRouter(c.db, c.mdb, c.mq))
+
+	// Webhooks routes
+	r.Route("/webhooks", webhook.ApplyRouter(c.db))
+
+	// Users routes
+	r.Route("/users", user.ApplyRouter(c.db))
+
+	// API tokens routes
+	r.Route("/tokens", token.ApplyRouter(c.db))
+
 	// Authentication routes
 	r.Route("/auth", func(r chi.Router) {
-		r.Post("/login", handlers.Login)
+		r.Post("/login", handlers.Login(users))
 		r.Get("/logout", handlers.Logout)
 
 		r.Route("/openid", func(r chi.Router) {
 			r.Get("/login", openid.Login)
 			r.Get("/signin", openid.SingIn)
+			r.Post("/refresh", openid.Refresh)
 			r.Get("/logout", openid.Logout)
 		})
 	})
 
 	// RPC handlers
-	r.Route("/rpc", ytdlpRPC.ApplyRouter())
+	r.Route("/rpc", ytdlpRPC.ApplyRouter(service))
 
 	// REST API handlers
 	r.Route("/api/v1", rest.ApplyRouter(&rest.ContainerArgs{
-		DB:  c.db,
-		MDB: c.mdb,
-		MQ:  c.mq,
+		DB:    c.db,
+		MDB:   c.mdb,
+		MQ:    c.mq,
+		LM:    c.lm,
+		Index: c.index,
 	}))
 
 	// Logging
 	r.Route("/log", logging.ApplyRouter(observableLogger))
 
+	// Downloads events
+	r.Route("/events", events.ApplyRouter(c.mdb.Events()))
+
 	// Status
 	r.Route("/status", status.ApplyRouter(c.mdb))
 
 	return &http.Server{Handler: r}
 }
 
-func gracefulShutdown(srv *http.Server, db *internal.MemoryDB) {
+func serveGRPC(srv *grpc.Server, port int) {
+	host := config.Instance().Host
+	if strings.HasPrefix(host, "/") {
+		host = ""
+	}
+
+	address := fmt.Sprintf("%s:%d", host, port)
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		slog.Error("failed to listen", slog.String("err", err.Error()))
+		return
+	}
+
+	slog.Info("gRPC server started", slog.String("address", address))
+
+	if err := srv.Serve(listener); err != nil {
+		slog.Warn("gRPC server stopped", slog.String("err", err.Error()))
+	}
+}
+
+func gracefulShutdown(srv *http.Server, grpcSrv *grpc.Server, db *internal.MemoryDB) {
 	ctx, stop := signal.NotifyContext(context.Background(),
 		os.Interrupt,
 		syscall.SIGTERM,
@@ -243,6 +336,7 @@ func gracefulShutdown(srv *http.Server, db *internal.MemoryDB) {
 			db.Persist()
 
 			stop()
+			grpcSrv.Stop()
 			srv.Shutdown(context.Background())
 		}()
 	}()
@@ -0,0 +1,18 @@
+package subscription
+
+import (
+	"database/sql"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+)
+
+func Container(db *sql.DB, mdb *internal.MemoryDB, mq *internal.MessageQueue) (domain.RestHandler, domain.TaskRunner) {
+	var (
+		r = provideRepository(db)
+		s = provideService(r, mdb, mq)
+		h = provideHandler(s)
+		t = provideRunner(s)
+	)
+	return h, t
+}
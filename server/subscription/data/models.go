@@ -0,0 +1,21 @@
+package data
+
+import "time"
+
+type Subscription struct {
+	Id         string
+	URL        string
+	Template   string
+	Path       string
+	StartDate  string
+	Interval   string
+	LastPolled *time.Time
+	CreatedAt  time.Time
+}
+
+type SeenEntry struct {
+	SubscriptionId string
+	EntryId        string
+	URL            string
+	SeenAt         time.Time
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/data"
+)
+
+var ErrNotFound = errors.New("subscription not found")
+
+type Subscription struct {
+	Id  string `json:"id"`
+	URL string `json:"url"`
+	// yt-dlp arguments the entries are downloaded with, e.g. "-x --no-mtime"
+	Template string `json:"template"`
+	Path     string `json:"path"`
+	// entries uploaded before this date (YYYY-MM-DD) are not downloaded
+	StartDate string `json:"start_date"`
+	// how often the subscription is polled e.g. "6h"
+	Interval   string     `json:"interval"`
+	LastPolled *time.Time `json:"last_polled,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Outcome of a subscription poll
+type PollResult struct {
+	Listed   int `json:"listed"`
+	Enqueued int `json:"enqueued"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, model *data.Subscription) error
+	Update(ctx context.Context, model *data.Subscription) error
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*data.Subscription, error)
+	List(ctx context.Context) (*[]data.Subscription, error)
+	SetLastPolled(ctx context.Context, id string, t time.Time) error
+	SeenSet(ctx context.Context, id string) (map[string]struct{}, error)
+	MarkSeen(ctx context.Context, entries []data.SeenEntry) error
+}
+
+type Service interface {
+	Create(ctx context.Context, entity *Subscription) (*Subscription, error)
+	Update(ctx context.Context, entity *Subscription) (*Subscription, error)
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*Subscription, error)
+	List(ctx context.Context) (*[]Subscription, error)
+	Poll(ctx context.Context, id string) (*PollResult, error)
+	PollDue(ctx context.Context)
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Get() http.HandlerFunc
+	Create() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Poll() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
+
+type TaskRunner interface {
+	Run(ctx context.Context)
+}
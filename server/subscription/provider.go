@@ -0,0 +1,53 @@
+package subscription
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/repository"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/rest"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/service"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/task"
+)
+
+var (
+	repo   domain.Repository
+	svc    domain.Service
+	hand   domain.RestHandler
+	runner domain.TaskRunner
+
+	repoOnce   sync.Once
+	svcOnce    sync.Once
+	handOnce   sync.Once
+	runnerOnce sync.Once
+)
+
+func provideRepository(db *sql.DB) domain.Repository {
+	repoOnce.Do(func() {
+		repo = repository.New(db)
+	})
+	return repo
+}
+
+func provideService(r domain.Repository, mdb *internal.MemoryDB, mq *internal.MessageQueue) domain.Service {
+	svcOnce.Do(func() {
+		svc = service.New(r, mdb, mq)
+	})
+	return svc
+}
+
+func provideHandler(s domain.Service) domain.RestHandler {
+	handOnce.Do(func() {
+		hand = rest.New(s)
+	})
+	return hand
+}
+
+func provideRunner(s domain.Service) domain.TaskRunner {
+	runnerOnce.Do(func() {
+		runner = task.New(s)
+	})
+	return runner
+}
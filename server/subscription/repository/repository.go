@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.Subscription) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		`INSERT INTO subscriptions (id, url, template, path, start_date, interval, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		model.Id,
+		model.URL,
+		model.Template,
+		model.Path,
+		model.StartDate,
+		model.Interval,
+		model.CreatedAt,
+	)
+
+	return err
+}
+
+// Update implements domain.Repository.
+func (r *Repository) Update(ctx context.Context, model *data.Subscription) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(
+		ctx,
+		`UPDATE subscriptions SET url = ?, template = ?, path = ?, start_date = ?, interval = ?
+		WHERE id = ?`,
+		model.URL,
+		model.Template,
+		model.Path,
+		model.StartDate,
+		model.Interval,
+		model.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return mustAffect(res)
+}
+
+// Delete implements domain.Repository.
+// The seen-set of the subscription is deleted as well.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM subscriptions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if err := mustAffect(res); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM subscription_entries WHERE subscription_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get implements domain.Repository.
+func (r *Repository) Get(ctx context.Context, id string) (*data.Subscription, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	row := conn.QueryRowContext(
+		ctx,
+		`SELECT id, url, template, path, start_date, interval, last_polled, created_at
+		FROM subscriptions WHERE id = ?`,
+		id,
+	)
+
+	model, err := scan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+
+	return model, err
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context) (*[]data.Subscription, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		`SELECT id, url, template, path, start_date, interval, last_polled, created_at
+		FROM subscriptions ORDER BY rowid`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subscriptions := []data.Subscription{}
+
+	for rows.Next() {
+		model, err := scan(rows)
+		if err != nil {
+			return &subscriptions, err
+		}
+
+		subscriptions = append(subscriptions, *model)
+	}
+
+	return &subscriptions, rows.Err()
+}
+
+// SetLastPolled implements domain.Repository.
+func (r *Repository) SetLastPolled(ctx context.Context, id string, t time.Time) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "UPDATE subscriptions SET last_polled = ? WHERE id = ?", t, id)
+	return err
+}
+
+// SeenSet implements domain.Repository.
+func (r *Repository) SeenSet(ctx context.Context, id string) (map[string]struct{}, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT entry_id FROM subscription_entries WHERE subscription_id = ?",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	seen := make(map[string]struct{})
+
+	for rows.Next() {
+		var entryId string
+
+		if err := rows.Scan(&entryId); err != nil {
+			return nil, err
+		}
+
+		seen[entryId] = struct{}{}
+	}
+
+	return seen, rows.Err()
+}
+
+// MarkSeen implements domain.Repository.
+func (r *Repository) MarkSeen(ctx context.Context, entries []data.SeenEntry) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range entries {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO subscription_entries (subscription_id, entry_id, url, seen_at)
+			VALUES (?, ?, ?, ?)`,
+			e.SubscriptionId,
+			e.EntryId,
+			e.URL,
+			e.SeenAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (*data.Subscription, error) {
+	var (
+		model      data.Subscription
+		lastPolled sql.NullTime
+	)
+
+	if err := row.Scan(
+		&model.Id,
+		&model.URL,
+		&model.Template,
+		&model.Path,
+		&model.StartDate,
+		&model.Interval,
+		&lastPolled,
+		&model.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if lastPolled.Valid {
+		model.LastPolled = &lastPolled.Time
+	}
+
+	return &model, nil
+}
+
+func mustAffect(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
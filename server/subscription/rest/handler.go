@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/openid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+
+	middlewares "github.com/marcopeocchi/yt-dlp-web-ui/v3/server/middleware"
+)
+
+type Handler struct {
+	service domain.Service
+}
+
+func New(service domain.Service) domain.RestHandler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// List implements domain.RestHandler.
+func (h *Handler) List() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Get implements domain.RestHandler.
+func (h *Handler) Get() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Create implements domain.RestHandler.
+func (h *Handler) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req domain.Subscription
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.service.Create(r.Context(), &req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Update implements domain.RestHandler.
+func (h *Handler) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		var req domain.Subscription
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req.Id = chi.URLParam(r, "id")
+
+		res, err := h.service.Update(r.Context(), &req)
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Delete implements domain.RestHandler.
+func (h *Handler) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := h.service.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode("ok")
+	}
+}
+
+// Poll implements domain.RestHandler.
+func (h *Handler) Poll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+
+		res, err := h.service.Poll(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// ApplyRouter implements domain.RestHandler.
+func (h *Handler) ApplyRouter() func(chi.Router) {
+	return func(r chi.Router) {
+		if config.Instance().RequireAuth {
+			r.Use(middlewares.Authenticated)
+		}
+		if config.Instance().UseOpenId {
+			r.Use(openid.Middleware)
+		}
+		r.Use(middlewares.RequireAdmin)
+
+		r.Get("/", h.List())
+		r.Post("/", h.Create())
+		r.Get("/{id}", h.Get())
+		r.Patch("/{id}", h.Update())
+		r.Delete("/{id}", h.Delete())
+		r.Post("/{id}/poll", h.Poll())
+	}
+}
+
+func statusCode(err error) int {
+	if errors.Is(err, domain.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+)
+
+const (
+	startDateLayout = "2006-01-02"
+	minInterval     = time.Minute
+)
+
+type Service struct {
+	repository domain.Repository
+	mdb        *internal.MemoryDB
+	mq         *internal.MessageQueue
+	// serializes polls so an entry can't be enqueued twice
+	mu sync.Mutex
+}
+
+func New(repository domain.Repository, mdb *internal.MemoryDB, mq *internal.MessageQueue) domain.Service {
+	return &Service{
+		repository: repository,
+		mdb:        mdb,
+		mq:         mq,
+	}
+}
+
+// Create implements domain.Service.
+func (s *Service) Create(ctx context.Context, entity *domain.Subscription) (*domain.Subscription, error) {
+	if err := validate(entity); err != nil {
+		return nil, err
+	}
+
+	model := &data.Subscription{
+		Id:        uuid.NewString(),
+		URL:       entity.URL,
+		Template:  entity.Template,
+		Path:      entity.Path,
+		StartDate: entity.StartDate,
+		Interval:  entity.Interval,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// Update implements domain.Service.
+// The seen-set is kept: entries already seen aren't downloaded again.
+func (s *Service) Update(ctx context.Context, entity *domain.Subscription) (*domain.Subscription, error) {
+	if err := validate(entity); err != nil {
+		return nil, err
+	}
+
+	err := s.repository.Update(ctx, &data.Subscription{
+		Id:        entity.Id,
+		URL:       entity.URL,
+		Template:  entity.Template,
+		Path:      entity.Path,
+		StartDate: entity.StartDate,
+		Interval:  entity.Interval,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, entity.Id)
+}
+
+// Delete implements domain.Service.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repository.Delete(ctx, id)
+}
+
+// Get implements domain.Service.
+func (s *Service) Get(ctx context.Context, id string) (*domain.Subscription, error) {
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// List implements domain.Service.
+func (s *Service) List(ctx context.Context) (*[]domain.Subscription, error) {
+	res, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]domain.Subscription, len(*res))
+
+	for i := range *res {
+		entities[i] = *toEntity(&(*res)[i])
+	}
+
+	return &entities, nil
+}
+
+// Poll implements domain.Service.
+// The subscription is listed and the entries not seen before are sent to the
+// message queue.
+func (s *Service) Poll(ctx context.Context, id string) (*domain.PollResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.poll(ctx, model)
+}
+
+// PollDue implements domain.Service.
+// Polls the subscriptions whose interval has elapsed since the last poll.
+func (s *Service) PollDue(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions, err := s.repository.List(ctx)
+	if err != nil {
+		slog.Error("failed to list subscriptions", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, model := range *subscriptions {
+		interval, err := time.ParseDuration(model.Interval)
+		if err != nil {
+			continue
+		}
+
+		if model.LastPolled != nil && time.Since(*model.LastPolled) < interval {
+			continue
+		}
+
+		if _, err := s.poll(ctx, &model); err != nil {
+			slog.Error("failed to poll subscription",
+				slog.String("id", model.Id),
+				slog.String("url", model.URL),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+}
+
+// must be called with the lock held
+func (s *Service) poll(ctx context.Context, model *data.Subscription) (*domain.PollResult, error) {
+	slog.Info("polling subscription", slog.String("id", model.Id), slog.String("url", model.URL))
+
+	// the poll is recorded even if it fails, so a broken subscription
+	// is retried at its next interval instead of every minute
+	now := time.Now()
+	if err := s.repository.SetLastPolled(ctx, model.Id, now); err != nil {
+		return nil, err
+	}
+
+	entries, err := listEntries(ctx, model.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	seen, err := s.repository.SeenSet(ctx, model.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var startDate time.Time
+	if model.StartDate != "" {
+		startDate, _ = time.ParseInLocation(startDateLayout, model.StartDate, time.Local)
+	}
+
+	var (
+		result  = &domain.PollResult{Listed: len(entries)}
+		newSeen []data.SeenEntry
+	)
+
+	for _, e := range entries {
+		key := e.key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		newSeen = append(newSeen, data.SeenEntry{
+			SubscriptionId: model.Id,
+			EntryId:        key,
+			URL:            e.url(),
+			SeenAt:         now,
+		})
+
+		params := strings.Fields(model.Template)
+
+		if !startDate.IsZero() {
+			uploaded, ok := e.uploadDate()
+			if ok && uploaded.Before(startDate) {
+				continue
+			}
+			// flat listings often lack the upload date, let yt-dlp check it
+			if !ok {
+				params = append(params, "--dateafter", startDate.Format("20060102"))
+			}
+		}
+
+		if s.mq.Downloaded(e.extractor(), e.Id) {
+			continue
+		}
+
+		title := e.Title
+		if title == "" {
+			title = e.url()
+		}
+
+		p := &internal.Process{
+			Url:    e.url(),
+			Params: params,
+			Info: internal.DownloadInfo{
+				URL:       e.url(),
+				Title:     title,
+				VideoId:   e.Id,
+				Extractor: e.extractor(),
+				CreatedAt: time.Now(),
+			},
+			Output: internal.DownloadOutput{
+				Path: model.Path,
+			},
+		}
+
+		s.mdb.Set(p)
+		s.mq.Publish(p)
+
+		result.Enqueued++
+	}
+
+	if err := s.repository.MarkSeen(ctx, newSeen); err != nil {
+		return nil, err
+	}
+
+	slog.Info("polled subscription",
+		slog.String("id", model.Id),
+		slog.Int("listed", result.Listed),
+		slog.Int("enqueued", result.Enqueued),
+	)
+
+	return result, nil
+}
+
+type entry struct {
+	Id         string  `json:"id"`
+	Title      string  `json:"title"`
+	IEKey      string  `json:"ie_key"`
+	Extractor  string  `json:"extractor_key"`
+	URL        string  `json:"url"`
+	WebpageURL string  `json:"webpage_url"`
+	UploadDate string  `json:"upload_date"`
+	Timestamp  float64 `json:"timestamp"`
+}
+
+// The seen-set key: the extractor id, the URL if missing
+func (e entry) key() string {
+	if e.Id != "" {
+		return e.Id
+	}
+	return e.url()
+}
+
+func (e entry) url() string {
+	if e.URL != "" {
+		return e.URL
+	}
+	return e.WebpageURL
+}
+
+func (e entry) extractor() string {
+	if e.Extractor != "" {
+		return e.Extractor
+	}
+	return e.IEKey
+}
+
+func (e entry) uploadDate() (time.Time, bool) {
+	if e.UploadDate != "" {
+		t, err := time.ParseInLocation("20060102", e.UploadDate, time.Local)
+		return t, err == nil
+	}
+
+	if e.Timestamp > 0 {
+		return time.Unix(int64(e.Timestamp), 0), true
+	}
+
+	return time.Time{}, false
+}
+
+// List a channel or a playlist with yt-dlp, a single video is listed as
+// a playlist of one entry.
+func listEntries(ctx context.Context, source string) ([]entry, error) {
+	cmd := exec.CommandContext(ctx, config.Instance().DownloaderPath, source, "--flat-playlist", "-J")
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+
+	var listing struct {
+		entry
+		Type    string  `json:"_type"`
+		Entries []entry `json:"entries"`
+	}
+
+	if err := json.Unmarshal(out, &listing); err != nil {
+		return nil, err
+	}
+
+	switch listing.Type {
+	case "playlist":
+		return listing.Entries, nil
+	case "":
+		return nil, errors.New("probably not a valid URL")
+	default:
+		if listing.entry.url() == "" {
+			listing.entry.WebpageURL = source
+		}
+		return []entry{listing.entry}, nil
+	}
+}
+
+func validate(entity *domain.Subscription) error {
+	// the entries are downloaded with the same url, path and flags
+	req := internal.DownloadRequest{
+		URL:    entity.URL,
+		Path:   entity.Path,
+		Params: strings.Fields(entity.Template),
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	// with the paths resolved against the download directory
+	entity.Path = req.Path
+	entity.Template = strings.Join(req.Params, " ")
+
+	interval, err := time.ParseDuration(entity.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid interval: %w", err)
+	}
+
+	if interval < minInterval {
+		return fmt.Errorf("interval must be at least %s", minInterval)
+	}
+
+	if entity.StartDate != "" {
+		if _, err := time.Parse(startDateLayout, entity.StartDate); err != nil {
+			return errors.New("invalid start date, expected YYYY-MM-DD")
+		}
+	}
+
+	return nil
+}
+
+func toEntity(model *data.Subscription) *domain.Subscription {
+	return &domain.Subscription{
+		Id:         model.Id,
+		URL:        model.URL,
+		Template:   model.Template,
+		Path:       model.Path,
+		StartDate:  model.StartDate,
+		Interval:   model.Interval,
+		LastPolled: model.LastPolled,
+		CreatedAt:  model.CreatedAt,
+	}
+}
@@ -0,0 +1,20 @@
+package subscription
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/internal"
+)
+
+func ApplyRouter(db *sql.DB, mdb *internal.MemoryDB, mq *internal.MessageQueue) func(chi.Router) {
+	handler, _ := Container(db, mdb, mq)
+	return handler.ApplyRouter()
+}
+
+// Periodically poll the subscriptions, blocks until ctx is done
+func Schedule(ctx context.Context, db *sql.DB, mdb *internal.MemoryDB, mq *internal.MessageQueue) {
+	_, runner := Container(db, mdb, mq)
+	runner.Run(ctx)
+}
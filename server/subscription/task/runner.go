@@ -0,0 +1,39 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/subscription/domain"
+)
+
+// How often the subscriptions are checked for a due poll
+const checkInterval = time.Minute
+
+type TaskRunner struct {
+	service domain.Service
+}
+
+func New(service domain.Service) domain.TaskRunner {
+	return &TaskRunner{
+		service: service,
+	}
+}
+
+// Run implements domain.TaskRunner.
+// Polls the due subscriptions right away and then every minute, until ctx
+// is done.
+func (t *TaskRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		t.service.PollDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
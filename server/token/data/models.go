@@ -0,0 +1,19 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Token struct {
+	Id     string
+	UserId string
+	Name   string
+	// SHA-256 of the token, the token itself isn't stored
+	Hash string
+	// comma separated
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	CreatedAt  time.Time
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token/data"
+)
+
+var (
+	ErrNotFound     = errors.New("token not found")
+	ErrInvalidToken = errors.New("invalid or revoked token")
+	ErrExpired      = errors.New("token expired")
+)
+
+type Token struct {
+	Id     string   `json:"id"`
+	UserId string   `json:"user_id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// only sent back once, when the token is created
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, model *data.Token) error
+	// an empty userId matches the tokens of every user
+	Delete(ctx context.Context, id, userId string) error
+	List(ctx context.Context, userId string) (*[]data.Token, error)
+	GetByHash(ctx context.Context, hash string) (*data.Token, error)
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+}
+
+type Service interface {
+	Create(ctx context.Context, entity *Token) (*Token, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) (*[]Token, error)
+	Authenticate(ctx context.Context, token string) (*auth.Principal, error)
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Create() http.HandlerFunc
+	Delete() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
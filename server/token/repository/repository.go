@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token/domain"
+)
+
+const columns = "id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at"
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.Token) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO api_tokens ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		model.Id,
+		model.UserId,
+		model.Name,
+		model.Hash,
+		model.Scopes,
+		model.ExpiresAt,
+		model.LastUsedAt,
+		model.CreatedAt,
+	)
+
+	return err
+}
+
+// Delete implements domain.Repository.
+func (r *Repository) Delete(ctx context.Context, id, userId string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(
+		ctx,
+		"DELETE FROM api_tokens WHERE id = ? AND (? = '' OR user_id = ?)",
+		id,
+		userId,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context, userId string) (*[]data.Token, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT "+columns+" FROM api_tokens WHERE ? = '' OR user_id = ? ORDER BY created_at",
+		userId,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tokens := []data.Token{}
+
+	for rows.Next() {
+		model, err := scan(rows)
+		if err != nil {
+			return &tokens, err
+		}
+
+		tokens = append(tokens, *model)
+	}
+
+	return &tokens, rows.Err()
+}
+
+// GetByHash implements domain.Repository.
+func (r *Repository) GetByHash(ctx context.Context, hash string) (*data.Token, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	model, err := scan(conn.QueryRowContext(
+		ctx,
+		"SELECT "+columns+" FROM api_tokens WHERE token_hash = ?",
+		hash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	return model, err
+}
+
+// Touch implements domain.Repository.
+func (r *Repository) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", usedAt, id)
+	return err
+}
+
+func scan(row interface{ Scan(...any) error }) (*data.Token, error) {
+	var model data.Token
+
+	err := row.Scan(
+		&model.Id,
+		&model.UserId,
+		&model.Name,
+		&model.Hash,
+		&model.Scopes,
+		&model.ExpiresAt,
+		&model.LastUsedAt,
+		&model.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/token/domain"
+)
+
+const (
+	maxNameLength = 255
+	// the last use isn't written more often than this
+	touchInterval = time.Minute
+)
+
+type Service struct {
+	repository domain.Repository
+}
+
+func New(repository domain.Repository) domain.Service {
+	return &Service{
+		repository: repository,
+	}
+}
+
+// Create implements domain.Service.
+// A token is issued to the current user and can't be granted scopes the
+// current request doesn't have.
+func (s *Service) Create(ctx context.Context, entity *domain.Token) (*domain.Token, error) {
+	owner := auth.Owner(ctx)
+	if owner == "" {
+		return nil, errors.New("API tokens require authentication to be enabled")
+	}
+
+	name := strings.TrimSpace(entity.Name)
+	if name == "" {
+		return nil, errors.New("missing token name")
+	}
+
+	if len(name) > maxNameLength {
+		return nil, fmt.Errorf("token name longer than %d characters", maxNameLength)
+	}
+
+	scopes, err := normalizeScopes(entity.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		if err := auth.RequireScope(ctx, scope); err != nil {
+			return nil, err
+		}
+		if scope == auth.ScopeAdmin {
+			if err := auth.RequireAdmin(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if entity.ExpiresAt != nil && entity.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("expiration date in the past")
+	}
+
+	secret, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	model := &data.Token{
+		Id:        uuid.NewString(),
+		UserId:    owner,
+		Name:      name,
+		Hash:      hash(secret),
+		Scopes:    strings.Join(scopes, ","),
+		CreatedAt: time.Now(),
+	}
+
+	if entity.ExpiresAt != nil {
+		model.ExpiresAt.Time, model.ExpiresAt.Valid = *entity.ExpiresAt, true
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		return nil, err
+	}
+
+	token := toEntity(model)
+	token.Token = secret
+
+	return token, nil
+}
+
+// Delete implements domain.Service.
+// Users can revoke their own tokens, admins any token.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repository.Delete(ctx, id, auth.OwnerFilter(ctx))
+}
+
+// List implements domain.Service.
+// Admins see the tokens of every user.
+func (s *Service) List(ctx context.Context) (*[]domain.Token, error) {
+	models, err := s.repository.List(ctx, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]domain.Token, len(*models))
+
+	for i, model := range *models {
+		tokens[i] = *toEntity(&model)
+	}
+
+	return &tokens, nil
+}
+
+// Authenticate implements domain.Service.
+// The principal has the current role of the user the token was issued to
+// and the scopes of the token.
+func (s *Service) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+	if !strings.HasPrefix(token, auth.TokenPrefix) {
+		return nil, domain.ErrInvalidToken
+	}
+
+	model, err := s.repository.GetByHash(ctx, hash(token))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if model.ExpiresAt.Valid && now.After(model.ExpiresAt.Time) {
+		return nil, domain.ErrExpired
+	}
+
+	principal, err := auth.Lookup(ctx, model.UserId)
+	if err != nil {
+		return nil, domain.ErrInvalidToken
+	}
+
+	principal.Scopes = strings.Split(model.Scopes, ",")
+
+	if !model.LastUsedAt.Valid || now.Sub(model.LastUsedAt.Time) > touchInterval {
+		if err := s.repository.Touch(ctx, model.Id, now); err != nil {
+			slog.Warn("failed to record the use of an API token",
+				slog.String("id", model.Id),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+
+	return principal, nil
+}
+
+// Deduplicate the scopes and sort them as auth.Scopes
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("a token needs at least one scope")
+	}
+
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return nil, fmt.Errorf("invalid scope %q, must be one of %s", scope, strings.Join(auth.Scopes, ", "))
+		}
+	}
+
+	normalized := make([]string, 0, len(scopes))
+
+	for _, scope := range auth.Scopes {
+		if slices.Contains(scopes, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+
+	return normalized, nil
+}
+
+func generate() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return auth.TokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Tokens are random enough for a fast hash to be safe
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func toEntity(model *data.Token) *domain.Token {
+	token := &domain.Token{
+		Id:        model.Id,
+		UserId:    model.UserId,
+		Name:      model.Name,
+		Scopes:    strings.Split(model.Scopes, ","),
+		CreatedAt: model.CreatedAt,
+	}
+
+	if model.ExpiresAt.Valid {
+		token.ExpiresAt = &model.ExpiresAt.Time
+	}
+
+	if model.LastUsedAt.Valid {
+		token.LastUsedAt = &model.LastUsedAt.Time
+	}
+
+	return token
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes([]string{"read", "exec", "read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(scopes, []string{"exec", "read"}) {
+		t.Errorf("normalizeScopes() = %v", scopes)
+	}
+
+	for _, invalid := range [][]string{nil, {"delete"}, {"exec", ""}} {
+		if _, err := normalizeScopes(invalid); err == nil {
+			t.Errorf("normalizeScopes(%q) should fail", invalid)
+		}
+	}
+}
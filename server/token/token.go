@@ -0,0 +1,19 @@
+package token
+
+import (
+	"database/sql"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+)
+
+func ApplyRouter(db *sql.DB) func(chi.Router) {
+	handler, _ := Container(db)
+	return handler.ApplyRouter()
+}
+
+// Accept the API tokens as credentials
+func Register(db *sql.DB) {
+	_, s := Container(db)
+	auth.SetTokenLookup(s.Authenticate)
+}
@@ -0,0 +1,16 @@
+package trash
+
+import (
+	"database/sql"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
+)
+
+func Container(db *sql.DB) (domain.RestHandler, domain.Service) {
+	var (
+		r = provideRepository(db)
+		s = provideService(r)
+		h = provideHandler(s)
+	)
+	return h, s
+}
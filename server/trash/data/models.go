@@ -0,0 +1,14 @@
+package data
+
+import "time"
+
+type Item struct {
+	Id           string
+	OriginalPath string
+	Size         int64
+	IsDir        bool
+	Kind         string
+	Payload      string
+	DeletedBy    string
+	DeletedAt    time.Time
+}
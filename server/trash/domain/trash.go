@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/data"
+)
+
+// Where the deleted files come from
+const (
+	KindArchive     = "archive"
+	KindFilebrowser = "filebrowser"
+)
+
+// Directory of the recycle bin, inside the download directory
+const Dir = ".trash"
+
+var (
+	ErrNotFound    = errors.New("trash item not found")
+	ErrInvalidPath = errors.New("invalid path")
+	ErrExists      = errors.New("the original path is taken")
+)
+
+type Item struct {
+	Id string `json:"id"`
+	// where the file was, and is restored to
+	OriginalPath string `json:"original_path"`
+	Size         int64  `json:"size"`
+	IsDir        bool   `json:"is_dir"`
+	Kind         string `json:"kind"`
+	// restored along with the file, e.g. the archive entry
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	DeletedBy string          `json:"deleted_by,omitempty"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	// when it will be purged, unset if it's kept until emptied
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Called once the file of an item of its kind is restored
+type RestoreHook func(ctx context.Context, item *Item) error
+
+type Repository interface {
+	Create(ctx context.Context, model *data.Item) error
+	// an empty owner matches the items deleted by anyone
+	Get(ctx context.Context, id string, owner string) (*data.Item, error)
+	List(ctx context.Context, owner string) (*[]data.Item, error)
+	Delete(ctx context.Context, id string) error
+	// items deleted before the time
+	Expired(ctx context.Context, before time.Time) (*[]data.Item, error)
+}
+
+type Service interface {
+	// Move a file or directory of the download directory into the bin
+	Trash(ctx context.Context, path string, kind string, payload any) (*Item, error)
+	List(ctx context.Context) (*[]Item, error)
+	// Move an item back to where it was
+	Restore(ctx context.Context, id string) (*Item, error)
+	// Delete an item for good
+	Delete(ctx context.Context, id string) error
+	// Delete every item the current user can see, returning how many
+	Empty(ctx context.Context) (int, error)
+	// Delete the items older than the retention
+	Purge(ctx context.Context) (int, error)
+	OnRestore(kind string, hook RestoreHook)
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Restore() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Empty() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
+)
+
+const columns = "id, original_path, size, is_dir, kind, payload, deleted_by, deleted_at"
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.Item) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO trash ("+columns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		model.Id,
+		model.OriginalPath,
+		model.Size,
+		model.IsDir,
+		model.Kind,
+		model.Payload,
+		model.DeletedBy,
+		model.DeletedAt,
+	)
+
+	return err
+}
+
+// Get implements domain.Repository.
+func (r *Repository) Get(ctx context.Context, id string, owner string) (*data.Item, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	row := conn.QueryRowContext(
+		ctx,
+		"SELECT "+columns+" FROM trash WHERE id = ? AND (? = '' OR deleted_by = ?)",
+		id,
+		owner,
+		owner,
+	)
+
+	model, err := scan(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+
+	return model, err
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context, owner string) (*[]data.Item, error) {
+	return r.query(
+		ctx,
+		"SELECT "+columns+" FROM trash WHERE ? = '' OR deleted_by = ? ORDER BY deleted_at DESC",
+		owner,
+		owner,
+	)
+}
+
+// Expired implements domain.Repository.
+func (r *Repository) Expired(ctx context.Context, before time.Time) (*[]data.Item, error) {
+	return r.query(ctx, "SELECT "+columns+" FROM trash WHERE deleted_at < ?", before)
+}
+
+// Delete implements domain.Repository.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "DELETE FROM trash WHERE id = ?", id)
+	return err
+}
+
+func (r *Repository) query(ctx context.Context, query string, args ...any) (*[]data.Item, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []data.Item{}
+
+	for rows.Next() {
+		model, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, *model)
+	}
+
+	return &items, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (*data.Item, error) {
+	var model data.Item
+
+	err := row.Scan(
+		&model.Id,
+		&model.OriginalPath,
+		&model.Size,
+		&model.IsDir,
+		&model.Kind,
+		&model.Payload,
+		&model.DeletedBy,
+		&model.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
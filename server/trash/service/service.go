@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
+)
+
+// How long the items are kept when the retention isn't set
+const defaultRetention = 30 * 24 * time.Hour
+
+type Service struct {
+	repository domain.Repository
+
+	mu    sync.Mutex
+	hooks map[string]domain.RestoreHook
+}
+
+func New(repository domain.Repository) domain.Service {
+	return &Service{
+		repository: repository,
+		hooks:      make(map[string]domain.RestoreHook),
+	}
+}
+
+// Trash implements domain.Service.
+func (s *Service) Trash(ctx context.Context, path string, kind string, payload any) (*domain.Item, error) {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPath(root, path); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []byte
+	if payload != nil {
+		if raw, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	model := &data.Item{
+		Id:           uuid.NewString(),
+		OriginalPath: path,
+		Size:         size(path, info),
+		IsDir:        info.IsDir(),
+		Kind:         kind,
+		Payload:      string(raw),
+		DeletedBy:    auth.Owner(ctx),
+		// stored as text, compared with the retention
+		DeletedAt: time.Now().Round(0).Local(),
+	}
+
+	dst := itemPath(root, model)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := move(path, dst); err != nil {
+		os.Remove(filepath.Dir(dst))
+		return nil, err
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		if err := move(dst, path); err == nil {
+			os.Remove(filepath.Dir(dst))
+		}
+		return nil, err
+	}
+
+	slog.Info(
+		"moved to the trash",
+		slog.String("path", path),
+		slog.String("kind", kind),
+		slog.String("by", model.DeletedBy),
+	)
+
+	return toEntity(model), nil
+}
+
+// List implements domain.Service.
+func (s *Service) List(ctx context.Context) (*[]domain.Item, error) {
+	models, err := s.repository.List(ctx, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]domain.Item, len(*models))
+	for i, model := range *models {
+		items[i] = *toEntity(&model)
+	}
+
+	return &items, nil
+}
+
+// Restore implements domain.Service.
+func (s *Service) Restore(ctx context.Context, id string) (*domain.Item, error) {
+	model, err := s.repository.Get(ctx, id, auth.OwnerFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(model.OriginalPath); err == nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrExists, model.OriginalPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(model.OriginalPath), 0755); err != nil {
+		return nil, err
+	}
+
+	src := itemPath(root, model)
+
+	if err := move(src, model.OriginalPath); err != nil {
+		return nil, err
+	}
+
+	os.Remove(filepath.Dir(src))
+
+	if err := s.repository.Delete(ctx, model.Id); err != nil {
+		return nil, err
+	}
+
+	item := toEntity(model)
+	item.ExpiresAt = nil
+
+	s.mu.Lock()
+	hook := s.hooks[model.Kind]
+	s.mu.Unlock()
+
+	// the file is back anyway
+	if hook != nil {
+		if err := hook(ctx, item); err != nil {
+			slog.Error(
+				"failed to restore what was deleted with the file",
+				slog.String("path", model.OriginalPath),
+				slog.String("kind", model.Kind),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+
+	return item, nil
+}
+
+// Delete implements domain.Service.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	model, err := s.repository.Get(ctx, id, auth.OwnerFilter(ctx))
+	if err != nil {
+		return err
+	}
+
+	return s.remove(ctx, model)
+}
+
+// Empty implements domain.Service.
+func (s *Service) Empty(ctx context.Context) (int, error) {
+	models, err := s.repository.List(ctx, auth.OwnerFilter(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	return s.removeAll(ctx, *models)
+}
+
+// Purge implements domain.Service.
+func (s *Service) Purge(ctx context.Context) (int, error) {
+	ttl, err := retention()
+	if err != nil || ttl == 0 {
+		return 0, err
+	}
+
+	models, err := s.repository.Expired(ctx, time.Now().Add(-ttl).Round(0).Local())
+	if err != nil {
+		return 0, err
+	}
+
+	return s.removeAll(ctx, *models)
+}
+
+// OnRestore implements domain.Service.
+func (s *Service) OnRestore(kind string, hook domain.RestoreHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks[kind] = hook
+}
+
+func (s *Service) removeAll(ctx context.Context, models []data.Item) (int, error) {
+	var removed int
+
+	for _, model := range models {
+		if err := s.remove(ctx, &model); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (s *Service) remove(ctx context.Context, model *data.Item) error {
+	root, err := filepath.Abs(config.Instance().DownloadPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(filepath.Dir(itemPath(root, model))); err != nil {
+		return err
+	}
+
+	return s.repository.Delete(ctx, model.Id)
+}
+
+// How long the items are kept, 0 if until emptied
+func retention() (time.Duration, error) {
+	conf := config.Instance().Trash.Retention
+	if conf == "" {
+		return defaultRetention, nil
+	}
+
+	d, err := time.ParseDuration(conf)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid trash retention %q", conf)
+	}
+
+	return d, nil
+}
+
+// Only what's in the download directory can be trashed, neither the
+// directory itself nor the bin
+func checkPath(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil ||
+		rel == "." ||
+		rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) ||
+		strings.Split(filepath.ToSlash(rel), "/")[0] == domain.Dir {
+		return fmt.Errorf("%w: only what's in the download directory can be moved to the trash", domain.ErrInvalidPath)
+	}
+
+	return nil
+}
+
+// Each item has its own directory in the bin, the name of the file is kept
+func itemPath(root string, model *data.Item) string {
+	return filepath.Join(root, domain.Dir, model.Id, filepath.Base(model.OriginalPath))
+}
+
+func size(path string, info fs.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+
+	var total int64
+
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+
+	return total
+}
+
+// Rename, or copy when the paths are on different file systems, e.g. a
+// subdirectory of the download directory being a mount point
+func move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("can't move %s to another file system", src)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	return os.Remove(src)
+}
+
+func toEntity(model *data.Item) *domain.Item {
+	item := &domain.Item{
+		Id:           model.Id,
+		OriginalPath: model.OriginalPath,
+		Size:         model.Size,
+		IsDir:        model.IsDir,
+		Kind:         model.Kind,
+		DeletedBy:    model.DeletedBy,
+		DeletedAt:    model.DeletedAt,
+	}
+
+	if model.Payload != "" {
+		item.Payload = json.RawMessage(model.Payload)
+	}
+
+	if ttl, err := retention(); err == nil && ttl > 0 {
+		expiresAt := model.DeletedAt.Add(ttl)
+		item.ExpiresAt = &expiresAt
+	}
+
+	return item
+}
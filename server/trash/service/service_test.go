@@ -0,0 +1,22 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	root := filepath.FromSlash("/downloads")
+
+	for _, path := range []string{"a.mp4", "sub/a.mp4", "sub", ".hidden.mp4", ".trashy/a.mp4"} {
+		if err := checkPath(root, filepath.Join(root, filepath.FromSlash(path))); err != nil {
+			t.Errorf("%q: %v", path, err)
+		}
+	}
+
+	for _, path := range []string{"/downloads", "/", "/etc/passwd", "/downloads-other/a.mp4", "/downloads/.trash", "/downloads/.trash/id/a.mp4"} {
+		if err := checkPath(root, filepath.FromSlash(path)); err == nil {
+			t.Errorf("%q can be trashed", path)
+		}
+	}
+}
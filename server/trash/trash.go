@@ -0,0 +1,52 @@
+package trash
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/trash/domain"
+)
+
+// How often the items past the retention are purged
+const purgeInterval = time.Hour
+
+type Service = domain.Service
+type Item = domain.Item
+
+const (
+	KindArchive     = domain.KindArchive
+	KindFilebrowser = domain.KindFilebrowser
+)
+
+func ApplyRouter(db *sql.DB) func(chi.Router) {
+	handler, _ := Container(db)
+	return handler.ApplyRouter()
+}
+
+// Purge the items past the retention right away and then every hour, until
+// ctx is done
+func Schedule(ctx context.Context, db *sql.DB) {
+	_, s := Container(db)
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.Purge(ctx)
+		if err != nil {
+			slog.Error("failed to purge the trash", slog.String("err", err.Error()))
+		}
+		if purged > 0 {
+			slog.Info("purged the trash", slog.Int("items", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
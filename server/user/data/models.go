@@ -0,0 +1,12 @@
+package data
+
+import "time"
+
+type User struct {
+	Id           string
+	Username     string
+	PasswordHash string
+	Role         string
+	Subject      string // OpenID subject, empty for the local users
+	CreatedAt    time.Time
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/data"
+)
+
+var (
+	ErrNotFound           = errors.New("user not found")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLastAdmin          = errors.New("at least one admin is required")
+	ErrExternalUser       = errors.New("the user is managed by the OpenID provider")
+)
+
+type User struct {
+	Id       string `json:"id"`
+	Username string `json:"username"`
+	// only accepted, never sent back
+	Password  string    `json:"password,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// set for the users signed in with OpenID, their role follows the claims
+	Subject string `json:"openid_subject,omitempty"`
+}
+
+type PasswordRequest struct {
+	// required unless an admin is changing it
+	Current  string `json:"current_password"`
+	Password string `json:"password"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, model *data.User) error
+	Update(ctx context.Context, model *data.User) error
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*data.User, error)
+	GetByUsername(ctx context.Context, username string) (*data.User, error)
+	GetBySubject(ctx context.Context, subject string) (*data.User, error)
+	List(ctx context.Context) (*[]data.User, error)
+	CountByRole(ctx context.Context, role string) (int, error)
+}
+
+type Service interface {
+	Create(ctx context.Context, entity *User) (*User, error)
+	Update(ctx context.Context, entity *User) (*User, error)
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*User, error)
+	List(ctx context.Context) (*[]User, error)
+	Login(ctx context.Context, username, password string) (*User, error)
+	ChangePassword(ctx context.Context, id string, req *PasswordRequest) error
+	Bootstrap(ctx context.Context, username, password string) error
+	Provision(ctx context.Context, subject, username, role string) (*User, error)
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Get() http.HandlerFunc
+	Create() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Me() http.HandlerFunc
+	ChangePassword() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
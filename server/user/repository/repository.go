@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/domain"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.User) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		"INSERT INTO users (id, username, password_hash, role, created_at, subject) VALUES (?, ?, ?, ?, ?, ?)",
+		model.Id,
+		model.Username,
+		model.PasswordHash,
+		model.Role,
+		model.CreatedAt,
+		model.Subject,
+	)
+
+	return uniqueViolation(err)
+}
+
+// Update implements domain.Repository.
+func (r *Repository) Update(ctx context.Context, model *data.User) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(
+		ctx,
+		"UPDATE users SET username = ?, password_hash = ?, role = ? WHERE id = ?",
+		model.Username,
+		model.PasswordHash,
+		model.Role,
+		model.Id,
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	return mustAffect(res)
+}
+
+// Delete implements domain.Repository.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return mustAffect(res)
+}
+
+// Get implements domain.Repository.
+func (r *Repository) Get(ctx context.Context, id string) (*data.User, error) {
+	return r.getBy(ctx, "id", id)
+}
+
+// GetByUsername implements domain.Repository.
+func (r *Repository) GetByUsername(ctx context.Context, username string) (*data.User, error) {
+	return r.getBy(ctx, "username", username)
+}
+
+// GetBySubject implements domain.Repository.
+func (r *Repository) GetBySubject(ctx context.Context, subject string) (*data.User, error) {
+	return r.getBy(ctx, "subject", subject)
+}
+
+func (r *Repository) getBy(ctx context.Context, column, value string) (*data.User, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	row := conn.QueryRowContext(
+		ctx,
+		"SELECT id, username, password_hash, role, created_at, subject FROM users WHERE "+column+" = ?",
+		value,
+	)
+
+	var model data.User
+
+	err = row.Scan(
+		&model.Id,
+		&model.Username,
+		&model.PasswordHash,
+		&model.Role,
+		&model.CreatedAt,
+		&model.Subject,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &model, nil
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context) (*[]data.User, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT id, username, password_hash, role, created_at, subject FROM users ORDER BY username",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []data.User{}
+
+	for rows.Next() {
+		var model data.User
+
+		if err := rows.Scan(
+			&model.Id,
+			&model.Username,
+			&model.PasswordHash,
+			&model.Role,
+			&model.CreatedAt,
+			&model.Subject,
+		); err != nil {
+			return &users, err
+		}
+
+		users = append(users, model)
+	}
+
+	return &users, rows.Err()
+}
+
+// CountByRole implements domain.Repository.
+// An empty role counts every user.
+func (r *Repository) CountByRole(ctx context.Context, role string) (int, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Close()
+
+	var count int
+
+	err = conn.
+		QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE ? = '' OR role = ?", role, role).
+		Scan(&count)
+
+	return count, err
+}
+
+func mustAffect(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func uniqueViolation(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return domain.ErrUsernameTaken
+	}
+	return err
+}
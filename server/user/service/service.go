@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	maxUsernameLength = 64
+)
+
+// compared against when the username doesn't exist, so that a login takes
+// the same time either way
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+type Service struct {
+	repository domain.Repository
+}
+
+func New(repository domain.Repository) domain.Service {
+	return &Service{
+		repository: repository,
+	}
+}
+
+// Create implements domain.Service.
+func (s *Service) Create(ctx context.Context, entity *domain.User) (*domain.User, error) {
+	if entity.Role == "" {
+		entity.Role = auth.RoleUser
+	}
+
+	if err := validate(entity); err != nil {
+		return nil, err
+	}
+
+	if err := validatePassword(entity.Password); err != nil {
+		return nil, err
+	}
+
+	hash, err := hashPassword(entity.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	model := &data.User{
+		Id:           uuid.NewString(),
+		Username:     strings.TrimSpace(entity.Username),
+		PasswordHash: hash,
+		Role:         entity.Role,
+		CreatedAt:    time.Now(),
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// Update implements domain.Service.
+// The fields left empty are kept.
+func (s *Service) Update(ctx context.Context, entity *domain.User) (*domain.User, error) {
+	model, err := s.repository.Get(ctx, entity.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity.Username != "" {
+		model.Username = strings.TrimSpace(entity.Username)
+	}
+
+	if entity.Role != "" && entity.Role != model.Role {
+		if err := s.keepAnAdmin(ctx, model); err != nil {
+			return nil, err
+		}
+		model.Role = entity.Role
+	}
+
+	if err := validate(&domain.User{Username: model.Username, Role: model.Role}); err != nil {
+		return nil, err
+	}
+
+	if entity.Password != "" {
+		if model.Subject != "" {
+			return nil, domain.ErrExternalUser
+		}
+
+		if err := validatePassword(entity.Password); err != nil {
+			return nil, err
+		}
+
+		hash, err := hashPassword(entity.Password)
+		if err != nil {
+			return nil, err
+		}
+		model.PasswordHash = hash
+	}
+
+	if err := s.repository.Update(ctx, model); err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// Delete implements domain.Service.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.keepAnAdmin(ctx, model); err != nil {
+		return err
+	}
+
+	return s.repository.Delete(ctx, id)
+}
+
+// Get implements domain.Service.
+func (s *Service) Get(ctx context.Context, id string) (*domain.User, error) {
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// List implements domain.Service.
+func (s *Service) List(ctx context.Context) (*[]domain.User, error) {
+	models, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]domain.User, len(*models))
+
+	for i, model := range *models {
+		users[i] = *toEntity(&model)
+	}
+
+	return &users, nil
+}
+
+// Login implements domain.Service.
+func (s *Service) Login(ctx context.Context, username, password string) (*domain.User, error) {
+	model, err := s.repository.GetByUsername(ctx, strings.TrimSpace(username))
+	if errors.Is(err, domain.ErrNotFound) {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte(uuid.NewString()), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, domain.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(model.PasswordHash), []byte(password)); err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	return toEntity(model), nil
+}
+
+// ChangePassword implements domain.Service.
+// Admins can change the password of anyone without knowing it.
+func (s *Service) ChangePassword(ctx context.Context, id string, req *domain.PasswordRequest) error {
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if model.Subject != "" {
+		return domain.ErrExternalUser
+	}
+
+	if !auth.IsAdmin(ctx) || auth.Owner(ctx) == id {
+		if err := bcrypt.CompareHashAndPassword([]byte(model.PasswordHash), []byte(req.Current)); err != nil {
+			return errors.New("wrong current password")
+		}
+	}
+
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		return err
+	}
+
+	model.PasswordHash = hash
+
+	return s.repository.Update(ctx, model)
+}
+
+// Bootstrap implements domain.Service.
+// Creates the first admin from the configured credentials, if there are no
+// users yet. The configured password isn't checked against the policy.
+func (s *Service) Bootstrap(ctx context.Context, username, password string) error {
+	count, err := s.repository.CountByRole(ctx, "")
+	if err != nil || count > 0 || username == "" {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.Create(ctx, &data.User{
+		Id:           uuid.NewString(),
+		Username:     username,
+		PasswordHash: hash,
+		Role:         auth.RoleAdmin,
+		CreatedAt:    time.Now(),
+	})
+}
+
+// Provision implements domain.Service.
+// Creates or updates a user signed in with OpenID. Its role is the one given
+// by the claims, the username the one of the provider unless it's taken by
+// another user.
+func (s *Service) Provision(ctx context.Context, subject, username, role string) (*domain.User, error) {
+	model, err := s.repository.GetBySubject(ctx, subject)
+	if err == nil {
+		if model.Role != role {
+			model.Role = role
+			if err := s.repository.Update(ctx, model); err != nil {
+				return nil, err
+			}
+		}
+		return toEntity(model), nil
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	fallback := "openid-" + shortHash(subject)
+
+	username = strings.TrimSpace(username)
+	if validate(&domain.User{Username: username, Role: role}) != nil {
+		username = fallback
+	}
+
+	model = &data.User{
+		Id:        uuid.NewString(),
+		Username:  username,
+		Role:      role,
+		Subject:   subject,
+		CreatedAt: time.Now(),
+	}
+
+	err = s.repository.Create(ctx, model)
+	if errors.Is(err, domain.ErrUsernameTaken) && username != fallback {
+		model.Username = fallback
+		err = s.repository.Create(ctx, model)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(model), nil
+}
+
+// The last admin can't be demoted or deleted
+func (s *Service) keepAnAdmin(ctx context.Context, model *data.User) error {
+	if model.Role != auth.RoleAdmin {
+		return nil
+	}
+
+	admins, err := s.repository.CountByRole(ctx, auth.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	if admins <= 1 {
+		return domain.ErrLastAdmin
+	}
+
+	return nil
+}
+
+func validate(entity *domain.User) error {
+	username := strings.TrimSpace(entity.Username)
+
+	if username == "" {
+		return errors.New("missing username")
+	}
+
+	if len(username) > maxUsernameLength {
+		return fmt.Errorf("username longer than %d characters", maxUsernameLength)
+	}
+
+	if strings.ContainsFunc(username, unicode.IsControl) {
+		return errors.New("username contains control characters")
+	}
+
+	if !auth.ValidRole(entity.Role) {
+		return fmt.Errorf("invalid role %q, must be one of %s", entity.Role, strings.Join(auth.Roles, ", "))
+	}
+
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password shorter than %d characters", minPasswordLength)
+	}
+
+	// bcrypt ignores the following bytes
+	if len(password) > 72 {
+		return errors.New("password longer than 72 bytes")
+	}
+
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func toEntity(model *data.User) *domain.User {
+	return &domain.User{
+		Id:        model.Id,
+		Username:  model.Username,
+		Role:      model.Role,
+		CreatedAt: model.CreatedAt,
+		Subject:   model.Subject,
+	}
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/domain"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		user  domain.User
+		valid bool
+	}{
+		{domain.User{Username: "alice", Role: "user"}, true},
+		{domain.User{Username: "bob", Role: "read-only"}, true},
+		{domain.User{Username: "  ", Role: "user"}, false},
+		{domain.User{Username: "alice", Role: "root"}, false},
+		{domain.User{Username: "al\nice", Role: "admin"}, false},
+		{domain.User{Username: strings.Repeat("a", 65), Role: "admin"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := validate(&tt.user); (err == nil) != tt.valid {
+			t.Errorf("validate(%q, %q) = %v", tt.user.Username, tt.user.Role, err)
+		}
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	for password, valid := range map[string]bool{
+		"short":                 false,
+		"long enough":           true,
+		strings.Repeat("x", 72): true,
+		strings.Repeat("x", 73): false,
+	} {
+		if err := validatePassword(password); (err == nil) != valid {
+			t.Errorf("validatePassword(%q) = %v", password, err)
+		}
+	}
+}
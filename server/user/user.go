@@ -0,0 +1,53 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/auth"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/config"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/user/domain"
+)
+
+type Service = domain.Service
+
+func ApplyRouter(db *sql.DB) func(chi.Router) {
+	handler, _ := Container(db)
+	return handler.ApplyRouter()
+}
+
+// Enable the user accounts. If there are none yet the configured username
+// and password become the first admin.
+func Register(db *sql.DB) Service {
+	_, s := Container(db)
+
+	conf := config.Instance()
+
+	if err := s.Bootstrap(context.Background(), conf.Username, conf.Password); err != nil {
+		slog.Error("failed to create the first admin", slog.String("err", err.Error()))
+	}
+
+	auth.SetLookup(func(ctx context.Context, id string) (*auth.Principal, error) {
+		return toPrincipal(s.Get(ctx, id))
+	})
+
+	auth.SetProvision(func(ctx context.Context, subject, username, role string) (*auth.Principal, error) {
+		return toPrincipal(s.Provision(ctx, subject, username, role))
+	})
+
+	return s
+}
+
+func toPrincipal(u *domain.User, err error) (*auth.Principal, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{
+		Id:       u.Id,
+		Username: u.Username,
+		Role:     u.Role,
+	}, nil
+}
@@ -0,0 +1,25 @@
+package data
+
+import "time"
+
+type Webhook struct {
+	Id        string
+	URL       string
+	Secret    string
+	Events    []string
+	Enabled   bool
+	CreatedAt time.Time
+}
+
+type Delivery struct {
+	Id           string
+	WebhookId    string
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	ResponseCode int
+	Error        string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
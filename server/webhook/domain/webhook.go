@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/data"
+)
+
+const (
+	EventQueued    = "queued"
+	EventStarted   = "started"
+	EventCompleted = "completed"
+	EventErrored   = "errored"
+	EventArchived  = "archived"
+)
+
+var Events = []string{EventQueued, EventStarted, EventCompleted, EventErrored, EventArchived}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var ErrNotFound = errors.New("webhook not found")
+
+type Webhook struct {
+	Id  string `json:"id"`
+	URL string `json:"url"`
+	// used to sign the payloads, generated if left empty
+	Secret string `json:"secret,omitempty"`
+	// the events the webhook is subscribed to, every event if empty
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	Id           string    `json:"id"`
+	WebhookId    string    `json:"webhook_id"`
+	Event        string    `json:"event"`
+	Payload      string    `json:"payload"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	ResponseCode int       `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// The payload POSTed to the webhooks
+type Event struct {
+	Type          string    `json:"event"`
+	JobId         string    `json:"job_id"`
+	Info          any       `json:"info"`
+	SavedFilePath string    `json:"saved_file_path,omitempty"`
+	ArchiveId     string    `json:"archive_id,omitempty"`
+	Error         any       `json:"error,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type Repository interface {
+	Create(ctx context.Context, model *data.Webhook) error
+	Update(ctx context.Context, model *data.Webhook) error
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*data.Webhook, error)
+	List(ctx context.Context) (*[]data.Webhook, error)
+	SaveDelivery(ctx context.Context, model *data.Delivery) error
+	Deliveries(ctx context.Context, webhookId string, limit int) (*[]data.Delivery, error)
+	PendingDeliveries(ctx context.Context) (*[]data.Delivery, error)
+}
+
+type Service interface {
+	Create(ctx context.Context, entity *Webhook) (*Webhook, error)
+	Update(ctx context.Context, entity *Webhook) (*Webhook, error)
+	Delete(ctx context.Context, id string) error
+	Get(ctx context.Context, id string) (*Webhook, error)
+	List(ctx context.Context) (*[]Webhook, error)
+	Deliveries(ctx context.Context, id string, limit int) (*[]Delivery, error)
+	Dispatch(ctx context.Context, event *Event) error
+	ResumeDeliveries(ctx context.Context) error
+}
+
+type RestHandler interface {
+	List() http.HandlerFunc
+	Get() http.HandlerFunc
+	Create() http.HandlerFunc
+	Update() http.HandlerFunc
+	Delete() http.HandlerFunc
+	Deliveries() http.HandlerFunc
+	ApplyRouter() func(chi.Router)
+}
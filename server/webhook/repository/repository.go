@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/domain"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) domain.Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Create implements domain.Repository.
+func (r *Repository) Create(ctx context.Context, model *data.Webhook) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		`INSERT INTO webhooks (id, url, secret, events, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		model.Id,
+		model.URL,
+		model.Secret,
+		strings.Join(model.Events, ","),
+		model.Enabled,
+		model.CreatedAt,
+	)
+
+	return err
+}
+
+// Update implements domain.Repository.
+func (r *Repository) Update(ctx context.Context, model *data.Webhook) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	res, err := conn.ExecContext(
+		ctx,
+		"UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ? WHERE id = ?",
+		model.URL,
+		model.Secret,
+		strings.Join(model.Events, ","),
+		model.Enabled,
+		model.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return mustAffect(res)
+}
+
+// Delete implements domain.Repository.
+// The delivery log of the webhook is deleted as well.
+func (r *Repository) Delete(ctx context.Context, id string) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if err := mustAffect(res); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get implements domain.Repository.
+func (r *Repository) Get(ctx context.Context, id string) (*data.Webhook, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	row := conn.QueryRowContext(
+		ctx,
+		"SELECT id, url, secret, events, enabled, created_at FROM webhooks WHERE id = ?",
+		id,
+	)
+
+	model, err := scanWebhook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+
+	return model, err
+}
+
+// List implements domain.Repository.
+func (r *Repository) List(ctx context.Context) (*[]data.Webhook, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(
+		ctx,
+		"SELECT id, url, secret, events, enabled, created_at FROM webhooks ORDER BY rowid",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := []data.Webhook{}
+
+	for rows.Next() {
+		model, err := scanWebhook(rows)
+		if err != nil {
+			return &webhooks, err
+		}
+
+		webhooks = append(webhooks, *model)
+	}
+
+	return &webhooks, rows.Err()
+}
+
+// SaveDelivery implements domain.Repository.
+func (r *Repository) SaveDelivery(ctx context.Context, model *data.Delivery) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(
+		ctx,
+		`INSERT INTO webhook_deliveries
+			(id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			attempts = excluded.attempts,
+			response_code = excluded.response_code,
+			error = excluded.error,
+			updated_at = excluded.updated_at`,
+		model.Id,
+		model.WebhookId,
+		model.Event,
+		model.Payload,
+		model.Status,
+		model.Attempts,
+		model.ResponseCode,
+		model.Error,
+		model.CreatedAt,
+		model.UpdatedAt,
+	)
+
+	return err
+}
+
+// Deliveries implements domain.Repository.
+// The most recent deliveries come first.
+func (r *Repository) Deliveries(ctx context.Context, webhookId string, limit int) (*[]data.Delivery, error) {
+	return r.queryDeliveries(
+		ctx,
+		`SELECT id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at
+		FROM webhook_deliveries WHERE webhook_id = ? ORDER BY rowid DESC LIMIT ?`,
+		webhookId,
+		limit,
+	)
+}
+
+// PendingDeliveries implements domain.Repository.
+func (r *Repository) PendingDeliveries(ctx context.Context) (*[]data.Delivery, error) {
+	return r.queryDeliveries(
+		ctx,
+		`SELECT id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at
+		FROM webhook_deliveries WHERE status = ? ORDER BY rowid`,
+		domain.DeliveryPending,
+	)
+}
+
+func (r *Repository) queryDeliveries(ctx context.Context, query string, args ...any) (*[]data.Delivery, error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []data.Delivery{}
+
+	for rows.Next() {
+		var model data.Delivery
+
+		if err := rows.Scan(
+			&model.Id,
+			&model.WebhookId,
+			&model.Event,
+			&model.Payload,
+			&model.Status,
+			&model.Attempts,
+			&model.ResponseCode,
+			&model.Error,
+			&model.CreatedAt,
+			&model.UpdatedAt,
+		); err != nil {
+			return &deliveries, err
+		}
+
+		deliveries = append(deliveries, model)
+	}
+
+	return &deliveries, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row scanner) (*data.Webhook, error) {
+	var (
+		model  data.Webhook
+		events string
+	)
+
+	if err := row.Scan(
+		&model.Id,
+		&model.URL,
+		&model.Secret,
+		&events,
+		&model.Enabled,
+		&model.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if events != "" {
+		model.Events = strings.Split(events, ",")
+	}
+
+	return &model, nil
+}
+
+func mustAffect(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
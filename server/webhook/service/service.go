@@ -0,0 +1,369 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/domain"
+)
+
+const (
+	maxDeliveryAttempts = 5
+	// doubled after every failed attempt
+	deliveryBackoff = time.Second * 10
+	deliveryTimeout = time.Second * 10
+)
+
+type Service struct {
+	repository domain.Repository
+	client     *http.Client
+	// wait after the first failed attempt
+	backoff time.Duration
+}
+
+func New(repository domain.Repository) domain.Service {
+	return &Service{
+		repository: repository,
+		client:     &http.Client{Timeout: deliveryTimeout},
+		backoff:    deliveryBackoff,
+	}
+}
+
+// Create implements domain.Service.
+func (s *Service) Create(ctx context.Context, entity *domain.Webhook) (*domain.Webhook, error) {
+	if err := validate(entity); err != nil {
+		return nil, err
+	}
+
+	if entity.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		entity.Secret = secret
+	}
+
+	model := &data.Webhook{
+		Id:        uuid.NewString(),
+		URL:       entity.URL,
+		Secret:    entity.Secret,
+		Events:    entity.Events,
+		Enabled:   entity.Enabled,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.repository.Create(ctx, model); err != nil {
+		return nil, err
+	}
+
+	// the secret is only disclosed once
+	return toEntity(model, true), nil
+}
+
+// Update implements domain.Service.
+// The secret is kept if left empty.
+func (s *Service) Update(ctx context.Context, entity *domain.Webhook) (*domain.Webhook, error) {
+	if err := validate(entity); err != nil {
+		return nil, err
+	}
+
+	model, err := s.repository.Get(ctx, entity.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	model.URL = entity.URL
+	model.Events = entity.Events
+	model.Enabled = entity.Enabled
+
+	if entity.Secret != "" {
+		model.Secret = entity.Secret
+	}
+
+	if err := s.repository.Update(ctx, model); err != nil {
+		return nil, err
+	}
+
+	return toEntity(model, false), nil
+}
+
+// Delete implements domain.Service.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	return s.repository.Delete(ctx, id)
+}
+
+// Get implements domain.Service.
+func (s *Service) Get(ctx context.Context, id string) (*domain.Webhook, error) {
+	model, err := s.repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toEntity(model, false), nil
+}
+
+// List implements domain.Service.
+func (s *Service) List(ctx context.Context) (*[]domain.Webhook, error) {
+	res, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]domain.Webhook, len(*res))
+
+	for i := range *res {
+		entities[i] = *toEntity(&(*res)[i], false)
+	}
+
+	return &entities, nil
+}
+
+// Deliveries implements domain.Service.
+func (s *Service) Deliveries(ctx context.Context, id string, limit int) (*[]domain.Delivery, error) {
+	if _, err := s.repository.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	res, err := s.repository.Deliveries(ctx, id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]domain.Delivery, len(*res))
+
+	for i, model := range *res {
+		entities[i] = domain.Delivery{
+			Id:           model.Id,
+			WebhookId:    model.WebhookId,
+			Event:        model.Event,
+			Payload:      model.Payload,
+			Status:       model.Status,
+			Attempts:     model.Attempts,
+			ResponseCode: model.ResponseCode,
+			Error:        model.Error,
+			CreatedAt:    model.CreatedAt,
+			UpdatedAt:    model.UpdatedAt,
+		}
+	}
+
+	return &entities, nil
+}
+
+// Dispatch implements domain.Service.
+// A delivery is recorded for every enabled webhook subscribed to the event,
+// then sent in background.
+func (s *Service) Dispatch(ctx context.Context, event *domain.Event) error {
+	webhooks, err := s.repository.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range *webhooks {
+		if !hook.Enabled || (len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Type)) {
+			continue
+		}
+
+		now := time.Now()
+
+		delivery := &data.Delivery{
+			Id:        uuid.NewString(),
+			WebhookId: hook.Id,
+			Event:     event.Type,
+			Payload:   string(payload),
+			Status:    domain.DeliveryPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+
+		if err := s.repository.SaveDelivery(ctx, delivery); err != nil {
+			return err
+		}
+
+		go s.deliver(hook, delivery)
+	}
+
+	return nil
+}
+
+// ResumeDeliveries implements domain.Service.
+// Deliveries interrupted by a restart are sent again.
+func (s *Service) ResumeDeliveries(ctx context.Context) error {
+	deliveries, err := s.repository.PendingDeliveries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range *deliveries {
+		hook, err := s.repository.Get(ctx, delivery.WebhookId)
+		if err != nil {
+			delivery.Status = domain.DeliveryFailed
+			delivery.Error = err.Error()
+			delivery.UpdatedAt = time.Now()
+			s.save(&delivery)
+			continue
+		}
+
+		go s.deliver(*hook, &delivery)
+	}
+
+	return nil
+}
+
+// POST the payload until the webhook accepts it or the attempts run out,
+// doubling the wait after each failure.
+func (s *Service) deliver(hook data.Webhook, delivery *data.Delivery) {
+	for delivery.Status == domain.DeliveryPending {
+		if delivery.Attempts > 0 {
+			time.Sleep(s.retryDelay(delivery.Attempts))
+		}
+
+		delivery.Attempts++
+
+		code, err := s.post(hook, delivery)
+
+		delivery.ResponseCode = code
+		delivery.Error = ""
+		delivery.UpdatedAt = time.Now()
+
+		switch {
+		case err == nil:
+			delivery.Status = domain.DeliveryDelivered
+		case delivery.Attempts >= maxDeliveryAttempts:
+			delivery.Status = domain.DeliveryFailed
+			delivery.Error = err.Error()
+		default:
+			delivery.Error = err.Error()
+		}
+
+		if err != nil {
+			slog.Warn("webhook delivery failed",
+				slog.String("webhook", hook.Id),
+				slog.String("delivery", delivery.Id),
+				slog.Int("attempt", delivery.Attempts),
+				slog.String("err", err.Error()),
+			)
+		}
+
+		s.save(delivery)
+	}
+}
+
+// How long to wait before the attempt following the failed ones
+func (s *Service) retryDelay(failed int) time.Duration {
+	return s.backoff << (failed - 1)
+}
+
+func (s *Service) post(hook data.Webhook, delivery *data.Delivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "yt-dlp-webui")
+	req.Header.Set("X-Webhook-Id", hook.Id)
+	req.Header.Set("X-Webhook-Delivery", delivery.Id)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(hook.Secret, timestamp, delivery.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func (s *Service) save(delivery *data.Delivery) {
+	if err := s.repository.SaveDelivery(context.Background(), delivery); err != nil {
+		slog.Error("failed to save webhook delivery",
+			slog.String("delivery", delivery.Id),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
+// Sign a payload: hex encoded HMAC-SHA256 of "timestamp.payload".
+// The timestamp is signed as well so a delivery can't be replayed later on.
+func Sign(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func validate(entity *domain.Webhook) error {
+	u, err := url.Parse(entity.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid webhook url")
+	}
+
+	for _, event := range entity.Events {
+		if !slices.Contains(domain.Events, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	return nil
+}
+
+func toEntity(model *data.Webhook, withSecret bool) *domain.Webhook {
+	entity := &domain.Webhook{
+		Id:        model.Id,
+		URL:       model.URL,
+		Events:    model.Events,
+		Enabled:   model.Enabled,
+		CreatedAt: model.CreatedAt,
+	}
+
+	if entity.Events == nil {
+		entity.Events = []string{}
+	}
+
+	if withSecret {
+		entity.Secret = model.Secret
+	}
+
+	return entity
+}
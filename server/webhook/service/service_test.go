@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/data"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/domain"
+)
+
+func TestSign(t *testing.T) {
+	const want = "676f90e8af78f8238c3e041e70bfaf5b49dd6cc1159c66134662420b525bdc11"
+
+	if got := Sign("secret", "1700000000", `{"event":"completed"}`); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	if Sign("secret", "1700000001", `{"event":"completed"}`) == want {
+		t.Fatal("the timestamp must be part of the signature")
+	}
+}
+
+// Keeps the webhooks and the last saved state of each delivery in memory
+type memoryRepository struct {
+	domain.Repository
+
+	mu         sync.Mutex
+	webhooks   []data.Webhook
+	deliveries map[string]data.Delivery
+}
+
+func (r *memoryRepository) List(ctx context.Context) (*[]data.Webhook, error) {
+	webhooks := slices.Clone(r.webhooks)
+	return &webhooks, nil
+}
+
+func (r *memoryRepository) SaveDelivery(ctx context.Context, model *data.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries[model.Id] = *model
+	return nil
+}
+
+func (r *memoryRepository) snapshot() []data.Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []data.Delivery
+	for _, d := range r.deliveries {
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+// Wait until no delivery is pending anymore
+func (r *memoryRepository) settled(t *testing.T) []data.Delivery {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		deliveries := r.snapshot()
+
+		if !slices.ContainsFunc(deliveries, func(d data.Delivery) bool {
+			return d.Status == domain.DeliveryPending
+		}) {
+			return deliveries
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("deliveries still pending")
+	return nil
+}
+
+func newTestService(repository domain.Repository) *Service {
+	s := New(repository).(*Service)
+	s.backoff = time.Millisecond
+	return s
+}
+
+func TestDispatchFiltersEvents(t *testing.T) {
+	received := make(chan string, 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("X-Webhook-Id")
+	}))
+	defer server.Close()
+
+	repository := &memoryRepository{
+		deliveries: make(map[string]data.Delivery),
+		webhooks: []data.Webhook{
+			{Id: "all", URL: server.URL, Enabled: true},
+			{Id: "completed", URL: server.URL, Enabled: true, Events: []string{domain.EventCompleted}},
+			{Id: "archived", URL: server.URL, Enabled: true, Events: []string{domain.EventArchived}},
+			{Id: "disabled", URL: server.URL},
+		},
+	}
+
+	s := newTestService(repository)
+
+	if err := s.Dispatch(context.Background(), &domain.Event{Type: domain.EventCompleted, JobId: "job"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range repository.settled(t) {
+		if d.Status != domain.DeliveryDelivered {
+			t.Errorf("delivery to %s: %s", d.WebhookId, d.Status)
+		}
+		got = append(got, d.WebhookId)
+	}
+
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"all", "completed"}) {
+		t.Errorf("delivered to %q, want all and completed", got)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+
+	hook := data.Webhook{Id: "hook", Secret: "secret", Enabled: true}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		want := "sha256=" + Sign(hook.Secret, r.Header.Get("X-Webhook-Timestamp"), string(body))
+		if got := r.Header.Get("X-Webhook-Signature"); got != want {
+			t.Errorf("signature = %s, want %s", got, want)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// fails twice, then accepts it
+		if attempts++; attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	hook.URL = server.URL
+
+	repository := &memoryRepository{deliveries: make(map[string]data.Delivery)}
+	s := newTestService(repository)
+
+	delivery := &data.Delivery{Id: "d", WebhookId: hook.Id, Payload: `{}`, Status: domain.DeliveryPending}
+	s.deliver(hook, delivery)
+
+	if delivery.Status != domain.DeliveryDelivered || delivery.Attempts != 3 || delivery.ResponseCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want delivered at the third attempt", delivery)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repository := &memoryRepository{deliveries: make(map[string]data.Delivery)}
+	s := newTestService(repository)
+
+	delivery := &data.Delivery{Id: "d", WebhookId: "hook", Payload: `{}`, Status: domain.DeliveryPending}
+	s.deliver(data.Webhook{Id: "hook", URL: server.URL}, delivery)
+
+	if delivery.Status != domain.DeliveryFailed || delivery.Attempts != maxDeliveryAttempts || delivery.Error == "" {
+		t.Errorf("delivery = %+v, want failed after %d attempts", delivery, maxDeliveryAttempts)
+	}
+
+	if saved := repository.snapshot(); len(saved) != 1 || saved[0].Status != domain.DeliveryFailed {
+		t.Errorf("saved = %+v, want the failed delivery", saved)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := &Service{backoff: 10 * time.Second}
+
+	for failed, want := range map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		4: 80 * time.Second,
+	} {
+		if got := s.retryDelay(failed); got != want {
+			t.Errorf("retryDelay(%d) = %s, want %s", failed, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	evbus "github.com/asaskevich/EventBus"
+	"github.com/go-chi/chi/v5"
+	"github.com/marcopeocchi/yt-dlp-web-ui/v3/server/webhook/domain"
+)
+
+const QueueName = "process:webhook"
+
+const (
+	EventQueued    = domain.EventQueued
+	EventStarted   = domain.EventStarted
+	EventCompleted = domain.EventCompleted
+	EventErrored   = domain.EventErrored
+	EventArchived  = domain.EventArchived
+)
+
+var (
+	eventBus       = evbus.New()
+	webhookService domain.Service
+)
+
+type Message = domain.Event
+
+func ApplyRouter(db *sql.DB) func(chi.Router) {
+	handler, _ := Container(db)
+	return handler.ApplyRouter()
+}
+
+// Enable the webhooks deliveries, the ones interrupted by a restart are
+// resumed.
+func Register(db *sql.DB) {
+	_, s := Container(db)
+	webhookService = s
+
+	if err := s.ResumeDeliveries(context.Background()); err != nil {
+		slog.Error("failed to resume webhook deliveries", slog.String("err", err.Error()))
+	}
+}
+
+func init() {
+	eventBus.SubscribeAsync(QueueName, func(m *Message) {
+		if err := webhookService.Dispatch(context.Background(), m); err != nil {
+			slog.Error("failed to dispatch webhooks",
+				slog.String("event", m.Type),
+				slog.String("job", m.JobId),
+				slog.String("err", err.Error()),
+			)
+		}
+	}, true)
+}
+
+// Send an event to the webhooks subscribed to it
+func Publish(m *Message) {
+	if webhookService == nil {
+		return
+	}
+
+	m.Timestamp = time.Now()
+	eventBus.Publish(QueueName, m)
+}